@@ -1,10 +1,17 @@
 package cli
 
 import (
+	"os"
 	"fmt"
+	"sort"
+	"time"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"../errors"
 	"../internal"
+	"../process/wrapper"
 	"../util"
 )
 
@@ -13,8 +20,26 @@ const (
 	COMMAND_DESTROY		string = "DESTROY"
 	COMMAND_START		string = "START"
 	COMMAND_STOP		string = "STOP"
+	COMMAND_LIST		string = "LIST"
+	COMMAND_TOP			string = "TOP"
+	COMMAND_LOGS		string = "LOGS"
+	COMMAND_SEND		string = "SEND"
+	COMMAND_SIGNAL		string = "SIGNAL"
 )
 
+const (
+	TOP_INTERVAL		time.Duration = 2 * time.Second
+	TOP_SORT_CPU		string = "cpu"
+	TOP_SORT_MEM		string = "mem"
+)
+
+const (
+	LOGS_TAIL			int = 100
+	LOGS_POLL			time.Duration = 250 * time.Millisecond
+)
+
+var argPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.]*=`)
+
 /**
  * Command struct
  */
@@ -22,6 +47,7 @@ type Command struct {
 	Env		*internal.Environment
 	Action	string
 	Args	map[string]string
+	Params	[]string
 }
 
 /**
@@ -37,11 +63,27 @@ func CreateCommand(env *internal.Environment, args []string) *Command {
 	command.Env	   = env
 	command.Action = args[0]
 	command.Args   = make(map[string]string)
+	command.Params = []string{}
+
+	// leading arguments are given as key=value, flags without value are set to true; first other token or -- starts
+	// positional ones, which are taken as they are even when they look like arguments
+	i := 1
+	for ; i < len(args); i++ {
+		if args[i] == "--" {
+			i++
+			break
+		}
+		if !strings.HasPrefix(args[i], "-") && !argPattern.MatchString(args[i]) {
+			break
+		}
 
-	for i := 1; i < len(args); i++ {
-		tmp := strings.Split(args[i], "=")
+		tmp := strings.SplitN(args[i], "=", 2)
+		if len(tmp) < 2 {
+			tmp = append(tmp, "true")
+		}
 		command.Args[strings.Replace(tmp[0], "-", "", -1)] = tmp[1]
 	}
+	command.Params = append(command.Params, args[i:]...)
 
 	return command
 }
@@ -59,6 +101,16 @@ func (c *Command) Execute() errors.Error {
 			return c.Start()
 		case COMMAND_STOP:
 			return c.Stop()
+		case COMMAND_LIST:
+			return c.List()
+		case COMMAND_TOP:
+			return c.Top()
+		case COMMAND_LOGS:
+			return c.Logs()
+		case COMMAND_SEND:
+			return c.Send()
+		case COMMAND_SIGNAL:
+			return c.Signal()
 		default:
 			return errors.New(28, "Undefined command specified.")
 	}
@@ -74,19 +126,17 @@ func (c *Command) Create() errors.Error {
 		return errors.New(27, "Not enough input argument.")
 	}
 
-	// create process manager
-	pm := internal.CreateProcManager(c.Env)
-	if pm == nil {
-		return errors.New(26, "Process manager couldnt been initalized.")
-	}
-
-	// create process
-	_, err := pm.CreateProcess(args["alias"], args["project"], args["component"], args["process"], false)
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
 
-	return nil
+	// create process
+	_, err = client.Create(args["alias"], args["project"], args["component"], args["process"], args["force"] == "true")
+
+	return err
 }
 
 /**
@@ -99,35 +149,367 @@ func (c *Command) Destroy() errors.Error {
 		return errors.New(27, "Not enough input argument.")
 	}
 
-	// create process manager
-	pm := internal.CreateProcManager(c.Env)
-	if pm == nil {
-		return errors.New(26, "Process manager couldnt been initalized.")
-	}
-
-	// destroy process
-	err := pm.DestroyProcess(args["alias"], false)
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
 
-	return nil
+	// destroy process
+	return client.Destroy(args["alias"], args["force"] == "true")
 }
 
 /**
  * Command.Start() errors.Error
  */
 func (c *Command) Start() errors.Error {
-	return nil
+	// check if arguments are valid
+	args := c.Args
+	if !util.KeyExists(args, "alias") {
+		return errors.New(27, "Not enough input argument.")
+	}
+
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// start process
+	_, err = client.Start(args["alias"])
+
+	return err
 }
 
 /**
  * Command.Stop() errors.Error
  */
 func (c *Command) Stop() errors.Error {
+	// check if arguments are valid
+	args := c.Args
+	if !util.KeyExists(args, "alias") {
+		return errors.New(27, "Not enough input argument.")
+	}
+
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// stop process
+	return client.Stop(args["alias"])
+}
+
+/**
+ * Command.List() errors.Error
+ */
+func (c *Command) List() errors.Error {
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// list processes
+	entries, err := client.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tPROJECT\tCOMPONENT\tPROCESS\tPID\tSTATE\tRESTARTS\tUPTIME")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\n", entry.Alias, entry.Project, entry.Component, entry.Process, entry.Pid, entry.State, entry.Restarts, entry.GetUptime() / time.Second * time.Second)
+	}
+	w.Flush()
+
+	return nil
+}
+
+/**
+ * Command.Top() errors.Error
+ *
+ * Shows resource usage of running processes, refreshed every interval seconds until interrupted or count refreshes
+ * have been shown. Rows are sorted by cpu or mem.
+ */
+func (c *Command) Top() errors.Error {
+	// check if arguments are valid
+	args := c.Args
+	order := TOP_SORT_CPU
+	if util.KeyExists(args, "sort") {
+		order = args["sort"]
+	}
+	if order != TOP_SORT_CPU && order != TOP_SORT_MEM {
+		return errors.New(27, "Sort has to be either cpu or mem.")
+	}
+
+	interval := TOP_INTERVAL
+	if util.KeyExists(args, "interval") {
+		seconds, perr := strconv.ParseFloat(args["interval"], 64)
+		if perr != nil || seconds <= 0 {
+			return errors.New(27, "Interval has to be positive number of seconds.")
+		}
+		interval = time.Duration(seconds * float64(time.Second))
+	}
+
+	count := 0
+	if util.KeyExists(args, "count") {
+		n, perr := strconv.Atoi(args["count"])
+		if perr != nil || n < 0 {
+			return errors.New(27, "Count has to be non-negative number.")
+		}
+		count = n
+	}
+
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// refresh view until done
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+
+		samples, err := client.Top()
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(samples, func(a, b int) bool {
+			if order == TOP_SORT_MEM && samples[a].ResidentBytes != samples[b].ResidentBytes {
+				return samples[a].ResidentBytes > samples[b].ResidentBytes
+			}
+			if samples[a].CpuPercent != samples[b].CpuPercent {
+				return samples[a].CpuPercent > samples[b].CpuPercent
+			}
+			return samples[a].Alias < samples[b].Alias
+		})
+
+		// clear screen and move cursor home
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("kraken top - %s, %d processes, sorted by %s\n\n", time.Now().Format("15:04:05"), len(samples), order)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ALIAS\tPID\tPROCS\tCPU%\tRSS\tFDS\tTHREADS\tREAD\tWRITE")
+		for _, sample := range samples {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%d\t%d\t%s\t%s\n", sample.Alias, sample.Pid, sample.Processes, sample.CpuPercent, formatBytes(sample.ResidentBytes), sample.OpenFiles, sample.Threads, formatBytes(sample.ReadBytes), formatBytes(sample.WriteBytes))
+		}
+		w.Flush()
+	}
+
 	return nil
 }
 
+/**
+ * Command.Logs() errors.Error
+ *
+ * Prints captured output of process given by alias, or of every process matching project and optionally component.
+ * Lines of several processes are interleaved by time and prefixed with alias. Supports tail=N, since=duration,
+ * stream=stdout|stderr, grep=pattern and follow, which keeps printing new lines until interrupted.
+ */
+func (c *Command) Logs() errors.Error {
+	// check if arguments are valid
+	args := c.Args
+	if !util.KeyExists(args, "alias") && !util.KeyExists(args, "project") {
+		return errors.New(27, "Not enough input argument, alias or project is required.")
+	}
+
+	filter := internal.CreateLogFilter()
+	if util.KeyExists(args, "stream") {
+		if args["stream"] != wrapper.LOG_STREAM_STDOUT && args["stream"] != wrapper.LOG_STREAM_STDERR {
+			return errors.New(27, "Stream has to be either stdout or stderr.")
+		}
+		filter.Streams = []string{args["stream"]}
+	}
+
+	tail := LOGS_TAIL
+	if util.KeyExists(args, "since") {
+		since, perr := time.ParseDuration(args["since"])
+		if perr != nil || since < 0 {
+			return errors.New(27, "Since has to be duration like 90s or 2h.")
+		}
+		filter.Since = time.Now().Add(-since)
+		tail = -1
+	}
+	if util.KeyExists(args, "tail") {
+		n, perr := strconv.Atoi(args["tail"])
+		if perr != nil || n < 0 {
+			return errors.New(27, "Tail has to be non-negative number.")
+		}
+		tail = n
+	}
+
+	if util.KeyExists(args, "grep") {
+		grep, perr := regexp.Compile(args["grep"])
+		if perr != nil {
+			return errors.New(27, "Invalid grep pattern, " + perr.Error())
+		}
+		filter.Grep = grep
+	}
+
+	config := internal.LoadLogConfig(c.Env)
+	if !config.Enabled {
+		return errors.New(38, "Output of processes is not captured.")
+	}
+
+	// resolve processes
+	aliases, err := c.selectAliases()
+	if err != nil {
+		return err
+	}
+
+	follower := internal.CreateLogFollower(config, aliases, filter)
+	defer follower.Close()
+
+	prefix := len(aliases) > 1 || !util.KeyExists(args, "alias")
+	lines, err := follower.Tail(tail)
+	for err == nil {
+		for _, line := range lines {
+			if prefix {
+				fmt.Print("[" + line.Alias + "] ")
+			}
+			fmt.Println(line.String())
+		}
+
+		if args["follow"] != "true" {
+			return nil
+		}
+
+		time.Sleep(LOGS_POLL)
+		lines, err = follower.Poll()
+	}
+
+	return err
+}
+
+/**
+ * Command.Send() errors.Error
+ *
+ * Writes text, given as text argument or as positional ones, to stdin of running process. Text which starts with what
+ * looks like an argument has to follow --, as in SEND alias=app -- key=value.
+ */
+func (c *Command) Send() errors.Error {
+	// check if arguments are valid
+	args := c.Args
+	text := strings.Join(c.Params, " ")
+	if util.KeyExists(args, "text") {
+		text = args["text"]
+	}
+	if !util.KeyExists(args, "alias") || text == "" {
+		return errors.New(27, "Not enough input argument, alias and text are required.")
+	}
+
+	// connect to process
+	client, err := internal.ConnectWrapper(c.Env, args["alias"])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// send text
+	return client.Send(text)
+}
+
+/**
+ * Command.Signal() errors.Error
+ *
+ * Sends signal, given as signal argument or as positional one, to running process.
+ */
+func (c *Command) Signal() errors.Error {
+	// check if arguments are valid
+	args := c.Args
+	signal := ""
+	if len(c.Params) > 0 {
+		signal = c.Params[0]
+	}
+	if util.KeyExists(args, "signal") {
+		signal = args["signal"]
+	}
+	if !util.KeyExists(args, "alias") || signal == "" {
+		return errors.New(27, "Not enough input argument, alias and signal are required.")
+	}
+
+	// connect to process
+	client, err := internal.ConnectWrapper(c.Env, args["alias"])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// send signal
+	return client.Signal(signal)
+}
+
+/**
+ * Command.selectAliases() ([]string, errors.Error)
+ *
+ * Resolves alias, or project and component arguments, to aliases of existing processes.
+ */
+func (c *Command) selectAliases() ([]string, errors.Error) {
+	args := c.Args
+
+	// connect to daemon
+	client, err := internal.ConnectDaemon(c.Env)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	entries, err := client.List()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := []string{}
+	for _, entry := range entries {
+		if util.KeyExists(args, "alias") && entry.Alias != args["alias"] {
+			continue
+		}
+		if util.KeyExists(args, "project") && entry.Project != args["project"] {
+			continue
+		}
+		if util.KeyExists(args, "component") && entry.Component != args["component"] {
+			continue
+		}
+		aliases = append(aliases, entry.Alias)
+	}
+
+	if len(aliases) == 0 {
+		return nil, errors.New(28, "No process matches given selector.")
+	}
+
+	return aliases, nil
+}
+
+/**
+ * formatBytes(uint64) string
+ */
+func formatBytes(bytes uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	size := float64(bytes)
+
+	i := 0
+	for size >= 1024 && i < len(units) - 1 {
+		size /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return strconv.FormatUint(bytes, 10) + units[0]
+	}
+
+	return strconv.FormatFloat(size, 'f', 1, 64) + units[i]
+}
+
 func fmtDummy() {
 	fmt.Printf("")
 }
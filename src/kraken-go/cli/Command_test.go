@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateCommandParsesArguments(t *testing.T) {
+	cases := []struct {
+		input		string
+		args		map[string]string
+		params		[]string
+	}{
+		{"LIST", map[string]string{}, []string{}},
+		{"CREATE alias=app project=shop component=api process=worker --force", map[string]string{"alias": "app", "project": "shop", "component": "api", "process": "worker", "force": "true"}, []string{}},
+		{"LOGS alias=app grep=a=b -follow", map[string]string{"alias": "app", "grep": "a=b", "follow": "true"}, []string{}},
+		// only leading tokens are arguments, the rest is taken as it is
+		{"SEND alias=app hello key=value --flag", map[string]string{"alias": "app"}, []string{"hello", "key=value", "--flag"}},
+		{"SIGNAL alias=app TERM", map[string]string{"alias": "app"}, []string{"TERM"}},
+		// -- ends arguments
+		{"SEND alias=app -- key=value -x", map[string]string{"alias": "app"}, []string{"key=value", "-x"}},
+		{"SEND alias=app -- -- x", map[string]string{"alias": "app"}, []string{"--", "x"}},
+		{"SEND alias=app --", map[string]string{"alias": "app"}, []string{}},
+	}
+
+	for _, tc := range cases {
+		command := CreateCommand(nil, strings.Fields(tc.input))
+
+		if command.Action != strings.Fields(tc.input)[0] {
+			t.Errorf("%q: unexpected action %q", tc.input, command.Action)
+		}
+		if len(command.Args) != len(tc.args) {
+			t.Errorf("%q: got arguments %v, want %v", tc.input, command.Args, tc.args)
+		}
+		for key, val := range tc.args {
+			if command.Args[key] != val {
+				t.Errorf("%q: argument %s is %q, want %q", tc.input, key, command.Args[key], val)
+			}
+		}
+		if strings.Join(command.Params, "|") != strings.Join(tc.params, "|") || len(command.Params) != len(tc.params) {
+			t.Errorf("%q: got positional %q, want %q", tc.input, command.Params, tc.params)
+		}
+	}
+
+	if CreateCommand(nil, []string{}) != nil {
+		t.Errorf("command without action has been created")
+	}
+}
@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"context"
+	"../tcp"
+	"../storage"
+	"../errors"
+)
+
+const (
+	DAEMON_HOST					string = "127.0.0.1"
+	DAEMON_PORT					string = "9080"
+)
+
+const (
+	DAEMON_CREATE				string = "CREATE"
+	DAEMON_DESTROY				string = "DESTROY"
+	DAEMON_START				string = "START"
+	DAEMON_STOP					string = "STOP"
+	DAEMON_LIST					string = "LIST"
+	DAEMON_TOP					string = "TOP"
+)
+
+const (
+	DAEMON_ERR_ARGUMENTS		int = 27
+	DAEMON_ERR_UNREACHABLE		int = 33
+)
+
+const (
+	LIST_SEPARATOR				string = "."
+	LIST_COUNT					string = "count"
+)
+
+/**
+ * Daemon class
+ *
+ * Long-running kraken process which owns process registry and serves control protocol, where every command is rpc
+ * method taking process fields as arguments. The same operations are served over HTTP and metrics are exported in
+ * Prometheus format, unless they have been disabled.
+ */
+type Daemon struct {
+	Host		string
+	Port		string
+	env			*Environment
+	pm			*ProcManager
+	sock		*tcp.Socket
+	api			*HttpApi
+	metrics		*MetricsExporter
+	collector	*ResourceCollector
+}
+
+/**
+ * Daemon constructor
+ */
+func CreateDaemon(env *Environment) *Daemon {
+	pm := CreateProcManager(env)
+	if pm == nil {
+		return nil
+	}
+
+	daemon := &Daemon{}
+
+	daemon.Host, daemon.Port = GetDaemonAddress(env)
+	daemon.env       = env
+	daemon.pm        = pm
+	daemon.sock      = createDaemonSocket(env)
+	daemon.api       = LoadHttpApi(env, pm)
+	daemon.metrics   = LoadMetricsExporter(env, pm, daemon.sock)
+	daemon.collector = LoadResourceCollector(env, pm)
+
+	daemon.sock.RegisterMethod(DAEMON_CREATE, daemon.handleCreate)
+	daemon.sock.RegisterMethod(DAEMON_DESTROY, daemon.handleDestroy)
+	daemon.sock.RegisterMethod(DAEMON_START, daemon.handleStart)
+	daemon.sock.RegisterMethod(DAEMON_STOP, daemon.handleStop)
+	daemon.sock.RegisterMethod(DAEMON_LIST, daemon.handleList)
+	daemon.sock.RegisterMethod(DAEMON_TOP, daemon.handleTop)
+
+	return daemon
+}
+
+/**
+ * Daemon.GetProcManager() *ProcManager
+ */
+func (daemon *Daemon) GetProcManager() *ProcManager {
+	return daemon.pm
+}
+
+/**
+ * Daemon.GetSocket() *tcp.Socket
+ */
+func (daemon *Daemon) GetSocket() *tcp.Socket {
+	return daemon.sock
+}
+
+/**
+ * Daemon.GetHttpApi() *HttpApi
+ *
+ * Returns nil when HTTP API has been disabled.
+ */
+func (daemon *Daemon) GetHttpApi() *HttpApi {
+	return daemon.api
+}
+
+/**
+ * Daemon.GetMetricsExporter() *MetricsExporter
+ *
+ * Returns nil when metrics have been disabled.
+ */
+func (daemon *Daemon) GetMetricsExporter() *MetricsExporter {
+	return daemon.metrics
+}
+
+/**
+ * Daemon.GetResourceCollector() *ResourceCollector
+ */
+func (daemon *Daemon) GetResourceCollector() *ResourceCollector {
+	return daemon.collector
+}
+
+/**
+ * Daemon.Start() errors.Error
+ *
+ * Restores processes saved by previous run and starts serving control protocol.
+ */
+func (daemon *Daemon) Start() errors.Error {
+	if err := daemon.pm.Load(); err != nil {
+		return err
+	}
+
+	if err := daemon.sock.Listen(daemon.Host, daemon.Port); err != nil {
+		return err
+	}
+
+	if daemon.api != nil {
+		if err := daemon.api.Start(); err != nil {
+			daemon.sock.Close()
+			return err
+		}
+	}
+
+	if daemon.metrics != nil {
+		if err := daemon.metrics.Start(); err != nil {
+			if daemon.api != nil {
+				daemon.api.Shutdown(context.Background())
+			}
+			daemon.sock.Close()
+			return err
+		}
+	}
+
+	daemon.collector.Start()
+
+	return nil
+}
+
+/**
+ * Daemon.Shutdown(context.Context) errors.Error
+ *
+ * Stops serving commands, lets the running ones finish within context and stops every managed process.
+ */
+func (daemon *Daemon) Shutdown(ctx context.Context) errors.Error {
+	var err errors.Error
+
+	if daemon.api != nil {
+		err = daemon.api.Shutdown(ctx)
+	}
+	if daemon.metrics != nil {
+		if merr := daemon.metrics.Shutdown(ctx); merr != nil {
+			err = merr
+		}
+	}
+	if serr := daemon.sock.Shutdown(ctx); serr != nil {
+		err = serr
+	}
+	daemon.collector.Stop()
+	daemon.pm.Shutdown()
+
+	return err
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Daemon.handleCreate(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (daemon *Daemon) handleCreate(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if err := requireArgs(record, "alias", "project", "component", "process"); err != nil {
+		return nil, err
+	}
+
+	force := record.Get("force") == "true"
+	pid, err := daemon.pm.CreateProcess(record.Get("alias"), record.Get("project"), record.Get("component"), record.Get("process"), force)
+	if err != nil {
+		return nil, err
+	}
+
+	return pidRecord(pid), nil
+}
+
+/**
+ * Daemon.handleDestroy(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (daemon *Daemon) handleDestroy(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if err := requireArgs(record, "alias"); err != nil {
+		return nil, err
+	}
+
+	return nil, daemon.pm.DestroyProcess(record.Get("alias"), record.Get("force") == "true")
+}
+
+/**
+ * Daemon.handleStart(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (daemon *Daemon) handleStart(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if err := requireArgs(record, "alias"); err != nil {
+		return nil, err
+	}
+
+	pid, err := daemon.pm.StartProcess(record.Get("alias"))
+	if err != nil {
+		return nil, err
+	}
+
+	return pidRecord(pid), nil
+}
+
+/**
+ * Daemon.handleStop(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (daemon *Daemon) handleStop(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if err := requireArgs(record, "alias"); err != nil {
+		return nil, err
+	}
+
+	return nil, daemon.pm.StopProcess(record.Get("alias"))
+}
+
+/**
+ * Daemon.handleList(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (daemon *Daemon) handleList(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	return encodeEntries(daemon.pm.GetProcesses()), nil
+}
+
+/**
+ * Daemon.handleTop(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ *
+ * Returns the last resource sample of every running process.
+ */
+func (daemon *Daemon) handleTop(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	records := []*storage.DataRecord{}
+	for _, sample := range daemon.collector.GetLatest() {
+		records = append(records, sample.ToRecord())
+	}
+
+	return encodeRecords(records), nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * GetDaemonAddress(*Environment) (string, string)
+ */
+func GetDaemonAddress(env *Environment) (string, string) {
+	if env == nil {
+		return DAEMON_HOST, DAEMON_PORT
+	}
+
+	config := env.GetConfig().Get("daemon")
+
+	return config.Get("host").MustString(DAEMON_HOST), config.Get("port").MustString(DAEMON_PORT)
+}
+
+func createDaemonSocket(env *Environment) *tcp.Socket {
+	sock := tcp.CreateSocket()
+
+	if env != nil {
+		if auth, ok := env.GetConfig().CheckGet("auth"); ok {
+			sock.Config.Auth = tcp.LoadSocketAuthConfig(auth)
+		}
+	}
+
+	return sock
+}
+
+func requireArgs(record *storage.DataRecord, keys ...string) errors.Error {
+	for _, key := range keys {
+		if record.Get(key) == "" {
+			return errors.New(DAEMON_ERR_ARGUMENTS, "Not enough input argument, " + key + " is missing.")
+		}
+	}
+
+	return nil
+}
+
+func pidRecord(pid int) *storage.DataRecord {
+	record := storage.CreateDataRecord()
+	record.Set("pid", strconv.Itoa(pid))
+
+	return record
+}
+
+/**
+ * encodeEntries([]*ProcessEntry) *storage.DataRecord
+ */
+func encodeEntries(entries []*ProcessEntry) *storage.DataRecord {
+	records := []*storage.DataRecord{}
+	for _, entry := range entries {
+		records = append(records, entry.ToRecord())
+	}
+
+	return encodeRecords(records)
+}
+
+/**
+ * decodeEntries(*storage.DataRecord) []*ProcessEntry
+ */
+func decodeEntries(record *storage.DataRecord) []*ProcessEntry {
+	entries := []*ProcessEntry{}
+	for _, row := range decodeRecords(record) {
+		entries = append(entries, LoadProcessEntry(row))
+	}
+
+	return entries
+}
+
+/**
+ * encodeRecords([]*storage.DataRecord) *storage.DataRecord
+ *
+ * Packs records to single record, each field is stored under its key suffixed with index of the record, like alias.0,
+ * so values are carried unchanged and records missing a field do not affect the others.
+ */
+func encodeRecords(records []*storage.DataRecord) *storage.DataRecord {
+	record := storage.CreateDataRecord()
+	record.Set(LIST_COUNT, strconv.Itoa(len(records)))
+
+	for i, row := range records {
+		for key, val := range row.ToMap() {
+			record.Set(key + LIST_SEPARATOR + strconv.Itoa(i), val)
+		}
+	}
+
+	return record
+}
+
+/**
+ * decodeRecords(*storage.DataRecord) []*storage.DataRecord
+ */
+func decodeRecords(record *storage.DataRecord) []*storage.DataRecord {
+	count, _ := strconv.Atoi(record.Get(LIST_COUNT))
+	rows := make([]*storage.DataRecord, count)
+
+	for i := range rows {
+		rows[i] = storage.CreateDataRecord()
+	}
+	for key, val := range record.ToMap() {
+		pos := strings.LastIndex(key, LIST_SEPARATOR)
+		if pos < 0 {
+			continue
+		}
+		if i, err := strconv.Atoi(key[pos+1:]); err == nil && i >= 0 && i < count {
+			rows[i].Set(key[:pos], val)
+		}
+	}
+
+	return rows
+}
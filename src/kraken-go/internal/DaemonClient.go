@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"time"
+	"strconv"
+	"context"
+	"../tcp"
+	"../storage"
+	"../errors"
+)
+
+const (
+	DAEMON_CALL_TIMEOUT			time.Duration = 30 * time.Second
+)
+
+/**
+ * DaemonClient class
+ *
+ * Connection to kraken daemon used by command line tools.
+ */
+type DaemonClient struct {
+	sock		*tcp.Socket
+}
+
+/**
+ * ConnectDaemon(*Environment) (*DaemonClient, errors.Error)
+ */
+func ConnectDaemon(env *Environment) (*DaemonClient, errors.Error) {
+	host, port := GetDaemonAddress(env)
+	sock := createDaemonSocket(env)
+
+	if err := sock.Connect(host, port); err != nil {
+		return nil, errors.New(DAEMON_ERR_UNREACHABLE, "Kraken daemon is not reachable at " + host + ":" + port + ", " + err.GetMessage())
+	}
+
+	client := &DaemonClient{}
+	client.sock = sock
+
+	return client, nil
+}
+
+/**
+ * DaemonClient.Close()
+ */
+func (client *DaemonClient) Close() {
+	client.sock.Close()
+}
+
+/**
+ * DaemonClient.Call(string, map[string]string) (*storage.DataRecord, errors.Error)
+ */
+func (client *DaemonClient) Call(method string, args map[string]string) (*storage.DataRecord, errors.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DAEMON_CALL_TIMEOUT)
+	defer cancel()
+
+	return client.sock.Call(ctx, method, storage.CreateDataRecord().FromMap(args))
+}
+
+/**
+ * DaemonClient.Create(string, string, string, string, bool) (int, errors.Error)
+ *
+ * Existing process of the same alias is replaced when force is set.
+ */
+func (client *DaemonClient) Create(alias string, projectName string, componentName string, processName string, force bool) (int, errors.Error) {
+	args := map[string]string{}
+	args["alias"]		= alias
+	args["project"]		= projectName
+	args["component"]	= componentName
+	args["process"]		= processName
+	args["force"]		= strconv.FormatBool(force)
+
+	return client.callPid(DAEMON_CREATE, args)
+}
+
+/**
+ * DaemonClient.Destroy(string, bool) errors.Error
+ *
+ * Process is killed without grace period when force is set.
+ */
+func (client *DaemonClient) Destroy(alias string, force bool) errors.Error {
+	_, err := client.Call(DAEMON_DESTROY, map[string]string{"alias": alias, "force": strconv.FormatBool(force)})
+	return err
+}
+
+/**
+ * DaemonClient.Start(string) (int, errors.Error)
+ */
+func (client *DaemonClient) Start(alias string) (int, errors.Error) {
+	return client.callPid(DAEMON_START, map[string]string{"alias": alias})
+}
+
+/**
+ * DaemonClient.Stop(string) errors.Error
+ */
+func (client *DaemonClient) Stop(alias string) errors.Error {
+	_, err := client.Call(DAEMON_STOP, map[string]string{"alias": alias})
+	return err
+}
+
+/**
+ * DaemonClient.List() ([]*ProcessEntry, errors.Error)
+ */
+func (client *DaemonClient) List() ([]*ProcessEntry, errors.Error) {
+	record, err := client.Call(DAEMON_LIST, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeEntries(record), nil
+}
+
+/**
+ * DaemonClient.Top() ([]*ResourceSample, errors.Error)
+ */
+func (client *DaemonClient) Top() ([]*ResourceSample, errors.Error) {
+	record, err := client.Call(DAEMON_TOP, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []*ResourceSample{}
+	for _, row := range decodeRecords(record) {
+		samples = append(samples, LoadResourceSample(row))
+	}
+
+	return samples, nil
+}
+
+func (client *DaemonClient) callPid(method string, args map[string]string) (int, errors.Error) {
+	record, err := client.Call(method, args)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, _ := strconv.Atoi(record.Get("pid"))
+
+	return pid, nil
+}
@@ -0,0 +1,402 @@
+package internal
+
+import (
+	"net"
+	"time"
+	"strings"
+	"strconv"
+	"context"
+	"net/http"
+	"crypto/subtle"
+	"encoding/json"
+	"../errors"
+)
+
+const (
+	API_HOST					string = "127.0.0.1"
+	API_PORT					string = "9081"
+	API_PREFIX					string = "/v1"
+)
+
+const (
+	API_ERR_MALFORMED			int = 34
+	API_ERR_UNAUTHORIZED		int = 35
+	API_ERR_NOT_FOUND			int = 36
+	API_ERR_METHOD				int = 37
+	API_ERR_SERVER				int = 39
+)
+
+/**
+ * HttpApi class
+ *
+ * REST/JSON interface to ProcManager. Failures are answered with {"error": {"code", "message"}} body, where code is
+ * the one of errors.Error. When token is configured, every request but the OpenAPI description has to carry it as
+ * bearer token.
+ */
+type HttpApi struct {
+	Host		string
+	Port		string
+	Token		string
+	pm			*ProcManager
+	server		*http.Server
+}
+
+/**
+ * HttpApi constructor
+ */
+func CreateHttpApi(pm *ProcManager) *HttpApi {
+	api := &HttpApi{}
+
+	api.Host   = API_HOST
+	api.Port   = API_PORT
+	api.Token  = ""
+	api.pm     = pm
+	api.server = nil
+
+	return api
+}
+
+/**
+ * LoadHttpApi(*Environment, *ProcManager) *HttpApi
+ *
+ * Configures API from http section of environment. Returns nil when API has been disabled.
+ */
+func LoadHttpApi(env *Environment, pm *ProcManager) *HttpApi {
+	api := CreateHttpApi(pm)
+
+	if env == nil {
+		return api
+	}
+
+	config := env.GetConfig().Get("http")
+	if !config.Get("enabled").MustBool(true) {
+		return nil
+	}
+
+	api.Host  = config.Get("host").MustString(API_HOST)
+	api.Port  = config.Get("port").MustString(API_PORT)
+	api.Token = config.Get("token").MustString()
+
+	return api
+}
+
+/**
+ * HttpApi.Start() errors.Error
+ */
+func (api *HttpApi) Start() errors.Error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(api.Host, api.Port))
+	if err != nil {
+		return errors.New(API_ERR_SERVER, err.Error())
+	}
+
+	api.server = &http.Server{Handler: api.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go api.server.Serve(listener)
+
+	return nil
+}
+
+/**
+ * HttpApi.Shutdown(context.Context) errors.Error
+ */
+func (api *HttpApi) Shutdown(ctx context.Context) errors.Error {
+	if api.server == nil {
+		return nil
+	}
+
+	if err := api.server.Shutdown(ctx); err != nil {
+		return errors.New(API_ERR_SERVER, err.Error())
+	}
+
+	return nil
+}
+
+/**
+ * HttpApi.Handler() http.Handler
+ */
+func (api *HttpApi) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(API_PREFIX + "/openapi.yaml", api.handleSpec)
+	mux.HandleFunc(API_PREFIX + "/processes", api.authorize(api.handleProcesses))
+	mux.HandleFunc(API_PREFIX + "/processes/", api.authorize(api.handleProcess))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, errors.New(API_ERR_NOT_FOUND, "Unknown endpoint " + r.URL.Path + "."))
+	})
+
+	return mux
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * HttpApi.authorize(http.HandlerFunc) http.HandlerFunc
+ */
+func (api *HttpApi) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if api.Token != "" {
+			header := r.Header.Get("Authorization")
+			token  := strings.TrimPrefix(header, "Bearer ")
+			if token == header || subtle.ConstantTimeCompare([]byte(token), []byte(api.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, errors.New(API_ERR_UNAUTHORIZED, "Missing or invalid token."))
+				return
+			}
+		}
+
+		handler(w, r)
+	}
+}
+
+/**
+ * HttpApi.handleSpec(http.ResponseWriter, *http.Request)
+ */
+func (api *HttpApi) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write([]byte(API_SPEC))
+}
+
+/**
+ * HttpApi.handleProcesses(http.ResponseWriter, *http.Request)
+ *
+ * GET lists processes, POST creates one.
+ */
+func (api *HttpApi) handleProcesses(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+		case http.MethodGet:
+			views := []*ProcessView{}
+			for _, entry := range api.pm.GetProcesses() {
+				views = append(views, CreateProcessView(entry))
+			}
+			writeJson(w, http.StatusOK, views)
+
+		case http.MethodPost:
+			var body struct {
+				Alias		string	`json:"alias"`
+				Project		string	`json:"project"`
+				Component	string	`json:"component"`
+				Process		string	`json:"process"`
+				Force		bool	`json:"force"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, errors.New(API_ERR_MALFORMED, "Malformed request body, " + err.Error()))
+				return
+			}
+			if body.Alias == "" || body.Project == "" || body.Component == "" || body.Process == "" {
+				writeError(w, errors.New(DAEMON_ERR_ARGUMENTS, "Not enough input argument, alias, project, component and process are required."))
+				return
+			}
+
+			if _, err := api.pm.CreateProcess(body.Alias, body.Project, body.Component, body.Process, body.Force); err != nil {
+				writeError(w, err)
+				return
+			}
+			api.writeProcess(w, http.StatusCreated, body.Alias)
+
+		default:
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+/**
+ * HttpApi.handleProcess(http.ResponseWriter, *http.Request)
+ *
+ * Serves /processes/{alias} and its actions.
+ */
+func (api *HttpApi) handleProcess(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, API_PREFIX + "/processes/"), "/")
+	alias := parts[0]
+
+	if alias == "" || len(parts) > 2 {
+		writeError(w, errors.New(API_ERR_NOT_FOUND, "Unknown endpoint " + r.URL.Path + "."))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch action {
+		case "":
+			api.handleEntry(w, r, alias)
+		case "start", "stop", "restart":
+			api.handleAction(w, r, alias, action)
+		case "logs":
+			api.handleLogs(w, r, alias)
+		default:
+			writeError(w, errors.New(API_ERR_NOT_FOUND, "Unknown endpoint " + r.URL.Path + "."))
+	}
+}
+
+/**
+ * HttpApi.handleEntry(http.ResponseWriter, *http.Request, string)
+ *
+ * GET returns status of process, DELETE destroys it.
+ */
+func (api *HttpApi) handleEntry(w http.ResponseWriter, r *http.Request, alias string) {
+	switch r.Method {
+		case http.MethodGet:
+			api.writeProcess(w, http.StatusOK, alias)
+
+		case http.MethodDelete:
+			if err := api.pm.DestroyProcess(alias, r.URL.Query().Get("force") == "true"); err != nil {
+				writeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+/**
+ * HttpApi.handleAction(http.ResponseWriter, *http.Request, string, string)
+ */
+func (api *HttpApi) handleAction(w http.ResponseWriter, r *http.Request, alias string, action string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var err errors.Error
+	switch action {
+		case "start":
+			_, err = api.pm.StartProcess(alias)
+		case "stop":
+			err = api.pm.StopProcess(alias)
+		case "restart":
+			_, err = api.pm.RestartProcess(alias)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	api.writeProcess(w, http.StatusOK, alias)
+}
+
+/**
+ * HttpApi.handleLogs(http.ResponseWriter, *http.Request, string)
+ */
+func (api *HttpApi) handleLogs(w http.ResponseWriter, r *http.Request, alias string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	tail := 100
+	if val := r.URL.Query().Get("tail"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			writeError(w, errors.New(API_ERR_MALFORMED, "Parameter tail has to be non-negative number."))
+			return
+		}
+		tail = n
+	}
+
+	lines, err := api.pm.GetLogs(alias, tail)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"alias": alias, "lines": lines})
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * ProcessView class
+ *
+ * JSON representation of ProcessEntry.
+ */
+type ProcessView struct {
+	Alias		string		`json:"alias"`
+	Project		string		`json:"project"`
+	Component	string		`json:"component"`
+	Process		string		`json:"process"`
+	Pid			int			`json:"pid"`
+	State		string		`json:"state"`
+	Restarts	int			`json:"restarts"`
+	ExitCode	int			`json:"exitCode"`
+	StartedAt	*time.Time	`json:"startedAt"`
+	Uptime		float64		`json:"uptime"`
+}
+
+/**
+ * ProcessView constructor
+ */
+func CreateProcessView(entry *ProcessEntry) *ProcessView {
+	view := &ProcessView{}
+
+	view.Alias     = entry.Alias
+	view.Project   = entry.Project
+	view.Component = entry.Component
+	view.Process   = entry.Process
+	view.Pid       = entry.Pid
+	view.State     = entry.State
+	view.Restarts  = entry.Restarts
+	view.ExitCode  = entry.ExitCode
+	view.StartedAt = nil
+	view.Uptime    = entry.GetUptime().Seconds()
+
+	if !entry.StartedAt.IsZero() {
+		startedAt := entry.StartedAt.UTC()
+		view.StartedAt = &startedAt
+	}
+
+	return view
+}
+
+/**
+ * HttpApi.writeProcess(http.ResponseWriter, int, string)
+ */
+func (api *HttpApi) writeProcess(w http.ResponseWriter, status int, alias string) {
+	entry := api.pm.GetProcess(alias)
+	if entry == nil {
+		writeError(w, errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist."))
+		return
+	}
+
+	writeJson(w, status, CreateProcessView(entry))
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+/**
+ * writeError(http.ResponseWriter, errors.Error)
+ *
+ * HTTP status is derived from error code, codes without better match are reported as conflict with current state.
+ */
+func writeError(w http.ResponseWriter, err errors.Error) {
+	status := http.StatusConflict
+
+	switch err.GetCode() {
+		case API_ERR_MALFORMED, DAEMON_ERR_ARGUMENTS:
+			status = http.StatusBadRequest
+		case API_ERR_UNAUTHORIZED:
+			status = http.StatusUnauthorized
+		case API_ERR_NOT_FOUND, PROCESS_ERR_NOT_FOUND:
+			status = http.StatusNotFound
+		case API_ERR_METHOD:
+			status = http.StatusMethodNotAllowed
+		case PROCESS_ERR_START, PROCESS_ERR_CONFIG, PROCESS_ERR_SIGNAL, API_ERR_SERVER:
+			status = http.StatusInternalServerError
+		case PROCESS_ERR_LOGS:
+			status = http.StatusNotImplemented
+	}
+
+	body := map[string]interface{}{}
+	body["error"] = map[string]interface{}{"code": err.GetCode(), "message": err.GetMessage()}
+
+	writeJson(w, status, body)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, errors.New(API_ERR_METHOD, "Method not allowed, use " + strings.Join(methods, " or ") + "."))
+}
@@ -0,0 +1,263 @@
+package internal
+
+/**
+ * API_SPEC
+ *
+ * OpenAPI description of HttpApi, served at /v1/openapi.yaml.
+ */
+const API_SPEC string = `openapi: 3.0.3
+info:
+  title: Kraken process manager API
+  version: "1"
+  description: |
+    Controls processes managed by kraken daemon. Every failure is answered with Error body carrying code of
+    kraken error, so clients can tell failures apart regardless of HTTP status.
+servers:
+  - url: http://127.0.0.1:9081/v1
+security:
+  - token: []
+paths:
+  /processes:
+    get:
+      summary: List processes
+      operationId: listProcesses
+      responses:
+        "200":
+          description: All registered processes ordered by alias.
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/Process"
+        "401":
+          $ref: "#/components/responses/Error"
+    post:
+      summary: Create and start process
+      operationId: createProcess
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/ProcessRequest"
+      responses:
+        "201":
+          $ref: "#/components/responses/Process"
+        "400":
+          $ref: "#/components/responses/Error"
+        "401":
+          $ref: "#/components/responses/Error"
+        "409":
+          $ref: "#/components/responses/Error"
+        "500":
+          $ref: "#/components/responses/Error"
+  /processes/{alias}:
+    parameters:
+      - $ref: "#/components/parameters/alias"
+    get:
+      summary: Get process status
+      operationId: getProcess
+      responses:
+        "200":
+          $ref: "#/components/responses/Process"
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+    delete:
+      summary: Stop process and remove it from registry
+      operationId: destroyProcess
+      parameters:
+        - name: force
+          in: query
+          description: Kill process without grace period.
+          schema:
+            type: boolean
+      responses:
+        "204":
+          description: Process has been destroyed.
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+  /processes/{alias}/start:
+    parameters:
+      - $ref: "#/components/parameters/alias"
+    post:
+      summary: Start stopped process
+      operationId: startProcess
+      responses:
+        "200":
+          $ref: "#/components/responses/Process"
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+        "409":
+          $ref: "#/components/responses/Error"
+        "500":
+          $ref: "#/components/responses/Error"
+  /processes/{alias}/stop:
+    parameters:
+      - $ref: "#/components/parameters/alias"
+    post:
+      summary: Stop running process
+      operationId: stopProcess
+      responses:
+        "200":
+          $ref: "#/components/responses/Process"
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+        "409":
+          $ref: "#/components/responses/Error"
+  /processes/{alias}/restart:
+    parameters:
+      - $ref: "#/components/parameters/alias"
+    post:
+      summary: Stop process if running and start it again
+      operationId: restartProcess
+      responses:
+        "200":
+          $ref: "#/components/responses/Process"
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+        "500":
+          $ref: "#/components/responses/Error"
+  /processes/{alias}/logs:
+    parameters:
+      - $ref: "#/components/parameters/alias"
+    get:
+      summary: Get last lines of process output
+      operationId: getProcessLogs
+      parameters:
+        - name: tail
+          in: query
+          description: Number of lines to return.
+          schema:
+            type: integer
+            minimum: 0
+            default: 100
+      responses:
+        "200":
+          description: Output lines of both streams, oldest first, each one prefixed with timestamp and stream name.
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  alias:
+                    type: string
+                  lines:
+                    type: array
+                    items:
+                      type: string
+        "400":
+          $ref: "#/components/responses/Error"
+        "401":
+          $ref: "#/components/responses/Error"
+        "404":
+          $ref: "#/components/responses/Error"
+        "501":
+          $ref: "#/components/responses/Error"
+  /openapi.yaml:
+    get:
+      summary: This description
+      operationId: getSpec
+      security: []
+      responses:
+        "200":
+          description: OpenAPI description.
+          content:
+            application/yaml: {}
+components:
+  securitySchemes:
+    token:
+      type: http
+      scheme: bearer
+      description: Required only when http.token is configured.
+  parameters:
+    alias:
+      name: alias
+      in: path
+      required: true
+      schema:
+        type: string
+  responses:
+    Process:
+      description: Process after the operation.
+      content:
+        application/json:
+          schema:
+            $ref: "#/components/schemas/Process"
+    Error:
+      description: Operation failed.
+      content:
+        application/json:
+          schema:
+            $ref: "#/components/schemas/Error"
+  schemas:
+    ProcessRequest:
+      type: object
+      required: [alias, project, component, process]
+      properties:
+        alias:
+          type: string
+        project:
+          type: string
+        component:
+          type: string
+        process:
+          type: string
+        force:
+          type: boolean
+          description: Replace existing process of the same alias.
+    Process:
+      type: object
+      properties:
+        alias:
+          type: string
+        project:
+          type: string
+        component:
+          type: string
+        process:
+          type: string
+        pid:
+          type: integer
+          description: Zero when process is not running.
+        state:
+          type: string
+          enum: [running, stopped, restarting, exited, failed]
+        restarts:
+          type: integer
+        exitCode:
+          type: integer
+        startedAt:
+          type: string
+          format: date-time
+          nullable: true
+        uptime:
+          type: number
+          description: Seconds since start, zero when not running.
+    Error:
+      type: object
+      required: [error]
+      properties:
+        error:
+          type: object
+          required: [code, message]
+          properties:
+            code:
+              type: integer
+              description: |
+                2 process exists, 15 start failed, 27 missing argument, 28 unknown process, 30 wrong configuration,
+                31 process running, 32 process not running, 34 malformed request, 35 unauthorized,
+                36 unknown endpoint, 37 method not allowed, 38 output not captured or unreadable, 39 server failure.
+            message:
+              type: string
+`
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"../errors"
+)
+
+func TestWriteErrorStatus(t *testing.T) {
+	cases := []struct {
+		code		int
+		status		int
+	}{
+		{API_ERR_MALFORMED, http.StatusBadRequest},
+		{DAEMON_ERR_ARGUMENTS, http.StatusBadRequest},
+		{API_ERR_UNAUTHORIZED, http.StatusUnauthorized},
+		{API_ERR_NOT_FOUND, http.StatusNotFound},
+		{PROCESS_ERR_NOT_FOUND, http.StatusNotFound},
+		{API_ERR_METHOD, http.StatusMethodNotAllowed},
+		{PROCESS_ERR_START, http.StatusInternalServerError},
+		{PROCESS_ERR_CONFIG, http.StatusInternalServerError},
+		{PROCESS_ERR_SIGNAL, http.StatusInternalServerError},
+		{API_ERR_SERVER, http.StatusInternalServerError},
+		{PROCESS_ERR_LOGS, http.StatusNotImplemented},
+		{PROCESS_ERR_EXISTS, http.StatusConflict},
+		{PROCESS_ERR_RUNNING, http.StatusConflict},
+		{PROCESS_ERR_NOT_RUNNING, http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		writeError(w, errors.New(tc.code, "message"))
+
+		if w.Code != tc.status {
+			t.Errorf("code %d answered with status %d, want %d", tc.code, w.Code, tc.status)
+		}
+
+		var body struct {
+			Error struct {
+				Code		int		`json:"code"`
+				Message		string	`json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != tc.code || body.Error.Message != "message" {
+			t.Errorf("code %d: unexpected body %q", tc.code, w.Body.String())
+		}
+	}
+}
+
+func TestHttpApiBearerAuth(t *testing.T) {
+	api := CreateHttpApi(createTestManager(t))
+	api.Token = "secret"
+
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	cases := []struct {
+		path		string
+		header		string
+		status		int
+	}{
+		{"/processes", "", http.StatusUnauthorized},
+		{"/processes", "Bearer wrong", http.StatusUnauthorized},
+		{"/processes", "secret", http.StatusUnauthorized},
+		{"/processes", "Bearer secret", http.StatusOK},
+		{"/processes/app", "", http.StatusUnauthorized},
+		{"/processes/app", "Bearer secret", http.StatusNotFound},
+		{"/openapi.yaml", "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodGet, server.URL + API_PREFIX + tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s with %q answered with %d, want %d", tc.path, tc.header, resp.StatusCode, tc.status)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: challenge has not been sent", tc.path)
+		}
+	}
+}
+
+func TestHttpApiProcessLifecycle(t *testing.T) {
+	api := CreateHttpApi(createTestManager(t))
+
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	request := func(method string, path string, body string) (int, *ProcessView) {
+		req, _ := http.NewRequest(method, server.URL + API_PREFIX + path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+
+		view := &ProcessView{}
+		json.NewDecoder(resp.Body).Decode(view)
+
+		return resp.StatusCode, view
+	}
+
+	if status, _ := request(http.MethodPost, "/processes", `{"alias":"app"}`); status != http.StatusBadRequest {
+		t.Errorf("create without arguments answered with %d", status)
+	}
+	if status, _ := request(http.MethodPost, "/processes", `{`); status != http.StatusBadRequest {
+		t.Errorf("create with malformed body answered with %d", status)
+	}
+
+	body := `{"alias":"app","project":"p","component":"c","process":"sleep"}`
+	status, view := request(http.MethodPost, "/processes", body)
+	if status != http.StatusCreated || view.Alias != "app" || view.State != PROCESS_STATE_RUNNING || view.Pid == 0 {
+		t.Fatalf("create answered with %d %+v", status, view)
+	}
+	if status, _ := request(http.MethodPost, "/processes", body); status != http.StatusConflict {
+		t.Errorf("duplicate create answered with %d", status)
+	}
+
+	if status, view := request(http.MethodPost, "/processes/app/stop", ""); status != http.StatusOK || view.State != PROCESS_STATE_STOPPED {
+		t.Errorf("stop answered with %d %+v", status, view)
+	}
+	if status, view := request(http.MethodPost, "/processes/app/start", ""); status != http.StatusOK || view.State != PROCESS_STATE_RUNNING {
+		t.Errorf("start answered with %d %+v", status, view)
+	}
+	if status, _ := request(http.MethodGet, "/processes/app/start", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET of action answered with %d", status)
+	}
+	if status, _ := request(http.MethodGet, "/processes/app/logs", ""); status != http.StatusNotImplemented {
+		t.Errorf("logs of uncaptured process answered with %d", status)
+	}
+
+	if status, _ := request(http.MethodDelete, "/processes/app?force=true", ""); status != http.StatusNoContent {
+		t.Errorf("destroy answered with %d", status)
+	}
+	if status, _ := request(http.MethodGet, "/processes/app", ""); status != http.StatusNotFound {
+		t.Errorf("destroyed process answered with %d", status)
+	}
+	if status, _ := request(http.MethodGet, "/unknown", ""); status != http.StatusNotFound {
+		t.Errorf("unknown endpoint answered with %d", status)
+	}
+}
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"net"
+	"fmt"
+	"time"
+	"sort"
+	"bytes"
+	"context"
+	"strings"
+	"net/http"
+	"../tcp"
+	"../lock"
+	"../storage"
+	"../errors"
+)
+
+const (
+	METRICS_HOST				string = "127.0.0.1"
+	METRICS_PORT				string = "9082"
+	METRICS_PATH				string = "/metrics"
+)
+
+const (
+	METRICS_ERR_SERVER			int = 41
+)
+
+/**
+ * MetricsExporter class
+ *
+ * Serves daemon metrics in Prometheus text format, so they can be scraped without any agent. Process metrics are
+ * collected on every scrape.
+ */
+type MetricsExporter struct {
+	Host		string
+	Port		string
+	pm			*ProcManager
+	sock		*tcp.Socket
+	server		*http.Server
+}
+
+/**
+ * MetricsExporter constructor
+ */
+func CreateMetricsExporter(pm *ProcManager, sock *tcp.Socket) *MetricsExporter {
+	exporter := &MetricsExporter{}
+
+	exporter.Host   = METRICS_HOST
+	exporter.Port   = METRICS_PORT
+	exporter.pm     = pm
+	exporter.sock   = sock
+	exporter.server = nil
+
+	return exporter
+}
+
+/**
+ * LoadMetricsExporter(*Environment, *ProcManager, *tcp.Socket) *MetricsExporter
+ *
+ * Configures exporter from metrics section of environment. Returns nil when metrics have been disabled.
+ */
+func LoadMetricsExporter(env *Environment, pm *ProcManager, sock *tcp.Socket) *MetricsExporter {
+	exporter := CreateMetricsExporter(pm, sock)
+
+	if env == nil {
+		return exporter
+	}
+
+	config := env.GetConfig().Get("metrics")
+	if !config.Get("enabled").MustBool(true) {
+		return nil
+	}
+
+	exporter.Host = config.Get("host").MustString(METRICS_HOST)
+	exporter.Port = config.Get("port").MustString(METRICS_PORT)
+
+	return exporter
+}
+
+/**
+ * MetricsExporter.Start() errors.Error
+ */
+func (exporter *MetricsExporter) Start() errors.Error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(exporter.Host, exporter.Port))
+	if err != nil {
+		return errors.New(METRICS_ERR_SERVER, err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(METRICS_PATH, exporter.handleMetrics)
+
+	exporter.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go exporter.server.Serve(listener)
+
+	return nil
+}
+
+/**
+ * MetricsExporter.Shutdown(context.Context) errors.Error
+ */
+func (exporter *MetricsExporter) Shutdown(ctx context.Context) errors.Error {
+	if exporter.server == nil {
+		return nil
+	}
+
+	if err := exporter.server.Shutdown(ctx); err != nil {
+		return errors.New(METRICS_ERR_SERVER, err.Error())
+	}
+
+	return nil
+}
+
+/**
+ * MetricsExporter.Collect() []byte
+ *
+ * Renders all metrics in Prometheus text exposition format.
+ */
+func (exporter *MetricsExporter) Collect() []byte {
+	w := &metricsWriter{}
+
+	exporter.collectProcesses(w)
+	exporter.collectStorage(w)
+	exporter.collectSocket(w)
+
+	return w.buf.Bytes()
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * MetricsExporter.handleMetrics(http.ResponseWriter, *http.Request)
+ */
+func (exporter *MetricsExporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(exporter.Collect())
+}
+
+/**
+ * MetricsExporter.collectProcesses(*metricsWriter)
+ */
+func (exporter *MetricsExporter) collectProcesses(w *metricsWriter) {
+	entries := exporter.pm.GetProcesses()
+
+	states := map[string]map[string]int{}
+	for _, entry := range entries {
+		if states[entry.Project] == nil {
+			states[entry.Project] = map[string]int{}
+		}
+		states[entry.Project][entry.State]++
+	}
+
+	w.header("kraken_processes", "gauge", "Number of managed processes by state and project.")
+	for _, project := range sortedKeys(states) {
+		for _, state := range []string{PROCESS_STATE_RUNNING, PROCESS_STATE_STOPPED, PROCESS_STATE_RESTARTING, PROCESS_STATE_EXITED, PROCESS_STATE_FAILED} {
+			w.sample("kraken_processes", states[project][state], "state", state, "project", project)
+		}
+	}
+
+	w.header("kraken_process_restarts_total", "counter", "Number of automatic restarts of process.")
+	for _, entry := range entries {
+		w.sample("kraken_process_restarts_total", entry.Restarts, processLabels(entry)...)
+	}
+
+	w.header("kraken_process_uptime_seconds", "gauge", "Seconds since process has been started, zero when not running.")
+	for _, entry := range entries {
+		w.sample("kraken_process_uptime_seconds", entry.GetUptime().Seconds(), processLabels(entry)...)
+	}
+
+	// entry pid belongs to wrapper, so usage of the whole tree is reported to include the php worker
+	stats := map[string]*ProcessStat{}
+	for _, entry := range entries {
+		if !entry.IsRunning() {
+			continue
+		}
+		if stat, err := ReadProcessTreeStat(entry.Pid); err == nil {
+			stats[entry.Alias] = stat
+		}
+	}
+
+	w.header("kraken_process_cpu_seconds_total", "counter", "User and system CPU time spent by process, its wrapper and their descendants.")
+	for _, entry := range entries {
+		if stat, ok := stats[entry.Alias]; ok {
+			w.sample("kraken_process_cpu_seconds_total", stat.CpuSeconds, processLabels(entry)...)
+		}
+	}
+
+	w.header("kraken_process_resident_memory_bytes", "gauge", "Resident memory size of process, its wrapper and their descendants.")
+	for _, entry := range entries {
+		if stat, ok := stats[entry.Alias]; ok {
+			w.sample("kraken_process_resident_memory_bytes", stat.ResidentBytes, processLabels(entry)...)
+		}
+	}
+}
+
+/**
+ * MetricsExporter.collectStorage(*metricsWriter)
+ */
+func (exporter *MetricsExporter) collectStorage(w *metricsWriter) {
+	ops := storage.GetOperationStats()
+
+	w.header("kraken_storage_operation_duration_seconds", "summary", "Duration of storage operations.")
+	for _, op := range []string{storage.STORAGE_OP_READ, storage.STORAGE_OP_WRITE, storage.STORAGE_OP_ERASE} {
+		w.sample("kraken_storage_operation_duration_seconds_sum", ops[op].Seconds, "operation", op)
+		w.sample("kraken_storage_operation_duration_seconds_count", ops[op].Count, "operation", op)
+	}
+
+	wait := lock.GetWaitStats()
+
+	w.header("kraken_lock_wait_seconds", "summary", "Time spent waiting for storage locks.")
+	w.sample("kraken_lock_wait_seconds_sum", wait.Seconds)
+	w.sample("kraken_lock_wait_seconds_count", wait.Count)
+}
+
+/**
+ * MetricsExporter.collectSocket(*metricsWriter)
+ */
+func (exporter *MetricsExporter) collectSocket(w *metricsWriter) {
+	if exporter.sock == nil {
+		return
+	}
+
+	traffic := exporter.sock.GetTrafficStats()
+
+	w.header("kraken_tcp_connections", "gauge", "Number of open control connections.")
+	w.sample("kraken_tcp_connections", traffic.Connections)
+
+	w.header("kraken_tcp_connections_accepted_total", "counter", "Number of accepted control connections.")
+	w.sample("kraken_tcp_connections_accepted_total", traffic.Accepted)
+
+	w.header("kraken_tcp_messages_total", "counter", "Number of control messages.")
+	w.sample("kraken_tcp_messages_total", traffic.MessagesIn, "direction", "in")
+	w.sample("kraken_tcp_messages_total", traffic.MessagesOut, "direction", "out")
+
+	w.header("kraken_tcp_bytes_total", "counter", "Number of control bytes including framing.")
+	w.sample("kraken_tcp_bytes_total", traffic.BytesIn, "direction", "in")
+	w.sample("kraken_tcp_bytes_total", traffic.BytesOut, "direction", "out")
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * metricsWriter class
+ */
+type metricsWriter struct {
+	buf			bytes.Buffer
+}
+
+func (w *metricsWriter) header(name string, kind string, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+/**
+ * metricsWriter.sample(string, interface{}, ...string)
+ *
+ * Labels are given as name and value pairs.
+ */
+func (w *metricsWriter) sample(name string, value interface{}, labels ...string) {
+	w.buf.WriteString(name)
+
+	if len(labels) > 0 {
+		pairs := []string{}
+		for i := 0; i + 1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i] + "=\"" + escapeLabel(labels[i+1]) + "\"")
+		}
+		w.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	fmt.Fprintf(&w.buf, " %v\n", value)
+}
+
+func processLabels(entry *ProcessEntry) []string {
+	return []string{"alias", entry.Alias, "project", entry.Project, "component", entry.Component, "process", entry.Process}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func sortedKeys(m map[string]map[string]int) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"time"
+	"regexp"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"../tcp"
+)
+
+var sampleLine = regexp.MustCompile(`^([a-z_]+)(\{([a-z]+="(\\.|[^"\\])*",?)*\})? [-+.0-9eE]+$`)
+
+func TestMetricsExposition(t *testing.T) {
+	pm := createTestManager(t)
+	if _, err := pm.CreateProcess("app", "shop \"eu\"", "api", "sleep", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	if _, err := pm.CreateProcess("done", "shop \"eu\"", "api", "exit", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	waitState(t, pm, "done", PROCESS_STATE_EXITED, time.Second)
+
+	exporter := CreateMetricsExporter(pm, tcp.CreateSocket())
+
+	w := httptest.NewRecorder()
+	exporter.handleMetrics(w, httptest.NewRequest(http.MethodGet, METRICS_PATH, nil))
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// every sample follows HELP and TYPE of its family
+	typed := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				t.Errorf("malformed type line %q", line)
+				continue
+			}
+			typed[fields[2]] = fields[3]
+			continue
+		}
+
+		match := sampleLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+
+		family := match[1]
+		if typed[family] == "" {
+			family = strings.TrimSuffix(strings.TrimSuffix(family, "_sum"), "_count")
+			if typed[family] != "summary" {
+				t.Errorf("sample %q has not been typed", line)
+			}
+		}
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`kraken_processes{state="running",project="shop \"eu\""} 1`,
+		`kraken_processes{state="exited",project="shop \"eu\""} 1`,
+		`kraken_processes{state="failed",project="shop \"eu\""} 0`,
+		`kraken_process_restarts_total{alias="app",project="shop \"eu\"",component="api",process="sleep"} 0`,
+		`kraken_tcp_connections 0`,
+		`kraken_tcp_messages_total{direction="in"} 0`,
+	} {
+		if !strings.Contains(body, want + "\n") {
+			t.Errorf("sample %s is missing", want)
+		}
+	}
+	if !strings.Contains(body, `kraken_process_resident_memory_bytes{alias="app"`) {
+		t.Logf("resource usage of running process is not reported on this platform")
+	}
+	if strings.Contains(body, `kraken_process_cpu_seconds_total{alias="done"`) {
+		t.Errorf("resource usage of exited process has been reported")
+	}
+
+	w = httptest.NewRecorder()
+	exporter.handleMetrics(w, httptest.NewRequest(http.MethodPost, METRICS_PATH, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered with %d", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"time"
+	"os/exec"
+	"strconv"
+	"../storage"
+)
+
+const (
+	PROCESS_STATE_RUNNING		string = "running"
+	PROCESS_STATE_STOPPED		string = "stopped"
+	PROCESS_STATE_RESTARTING	string = "restarting"
+	PROCESS_STATE_EXITED		string = "exited"
+	PROCESS_STATE_FAILED		string = "failed"
+)
+
+/**
+ * ProcessEntry class
+ *
+ * Process registered in ProcManager. Exported fields are snapshot of its state, entries returned by ProcManager are
+ * copies and can be read freely.
+ */
+type ProcessEntry struct {
+	Alias		string
+	Project		string
+	Component	string
+	Process		string
+	Pid			int
+	State		string
+	Restarts	int
+	ExitCode	int
+	StartedAt	time.Time
+	cmd			*exec.Cmd
+	exited		chan struct{}
+	stopping	bool
+	timer		*time.Timer
+	failures	uint
+}
+
+/**
+ * ProcessEntry constructor
+ */
+func CreateProcessEntry(alias string, projectName string, componentName string, processName string) *ProcessEntry {
+	entry := &ProcessEntry{}
+
+	entry.Alias     = alias
+	entry.Project   = projectName
+	entry.Component = componentName
+	entry.Process   = processName
+	entry.Pid       = 0
+	entry.State     = PROCESS_STATE_STOPPED
+	entry.Restarts  = 0
+	entry.ExitCode  = 0
+	entry.cmd       = nil
+	entry.exited    = nil
+	entry.stopping  = false
+	entry.timer     = nil
+	entry.failures  = 0
+
+	return entry
+}
+
+/**
+ * ProcessEntry.IsRunning() bool
+ */
+func (entry *ProcessEntry) IsRunning() bool {
+	return entry.State == PROCESS_STATE_RUNNING
+}
+
+/**
+ * ProcessEntry.GetUptime() time.Duration
+ */
+func (entry *ProcessEntry) GetUptime() time.Duration {
+	if !entry.IsRunning() {
+		return 0
+	}
+
+	return time.Since(entry.StartedAt)
+}
+
+/**
+ * ProcessEntry.ToRecord() *storage.DataRecord
+ */
+func (entry *ProcessEntry) ToRecord() *storage.DataRecord {
+	data := map[string]string{}
+	data["alias"]		= entry.Alias
+	data["project"]		= entry.Project
+	data["component"]	= entry.Component
+	data["process"]		= entry.Process
+	data["pid"]			= strconv.Itoa(entry.Pid)
+	data["state"]		= entry.State
+	data["restarts"]	= strconv.Itoa(entry.Restarts)
+	data["exitCode"]	= strconv.Itoa(entry.ExitCode)
+	data["startedAt"]	= "0"
+
+	if !entry.StartedAt.IsZero() {
+		data["startedAt"] = strconv.FormatInt(entry.StartedAt.Unix(), 10)
+	}
+
+	return storage.CreateDataRecord().FromMap(data)
+}
+
+/**
+ * LoadProcessEntry(*storage.DataRecord) *ProcessEntry
+ */
+func LoadProcessEntry(record *storage.DataRecord) *ProcessEntry {
+	entry := CreateProcessEntry(record.Get("alias"), record.Get("project"), record.Get("component"), record.Get("process"))
+
+	entry.Pid, _      = strconv.Atoi(record.Get("pid"))
+	entry.Restarts, _ = strconv.Atoi(record.Get("restarts"))
+	entry.ExitCode, _ = strconv.Atoi(record.Get("exitCode"))
+
+	if startedAt, _ := strconv.ParseInt(record.Get("startedAt"), 10, 64); startedAt > 0 {
+		entry.StartedAt = time.Unix(startedAt, 0)
+	}
+	if record.Exists("state") {
+		entry.State = record.Get("state")
+	}
+
+	return entry
+}
+
+/**
+ * ProcessEntry.copy() *ProcessEntry
+ */
+func (entry *ProcessEntry) copy() *ProcessEntry {
+	snapshot := *entry
+
+	snapshot.cmd    = nil
+	snapshot.exited = nil
+	snapshot.timer  = nil
+
+	return &snapshot
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+/**
+ * setProcessGroup(*exec.Cmd)
+ *
+ * Starts wrapper as leader of its own process group, which its php process and anything spawned by it join.
+ */
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setpgid = true
+}
+
+/**
+ * killProcessGroup(*os.Process) error
+ *
+ * Kills wrapper together with every process in its group, so no worker outlives it.
+ */
+func killProcessGroup(process *os.Process) error {
+	if err := syscall.Kill(-process.Pid, syscall.SIGKILL); err != nil {
+		return process.Kill()
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+// +build !linux
+
+package internal
+
+import (
+	"os"
+	"os/exec"
+)
+
+/**
+ * setProcessGroup(*exec.Cmd)
+ *
+ * Process groups are not available on this platform, wrapper takes care of its process on its own.
+ */
+func setProcessGroup(cmd *exec.Cmd) {}
+
+/**
+ * killProcessGroup(*os.Process) error
+ */
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
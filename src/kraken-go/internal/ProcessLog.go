@@ -0,0 +1,429 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+	"bufio"
+	"regexp"
+	"strings"
+	"compress/gzip"
+	"../errors"
+	"../process/wrapper"
+)
+
+/**
+ * LogLine class
+ *
+ * Single line of captured process output.
+ */
+type LogLine struct {
+	Time		time.Time
+	Alias		string
+	Stream		string
+	Text		string
+}
+
+/**
+ * LogLine constructor
+ *
+ * Parses line as stored by wrapper, lines without valid timestamp are kept whole with zero time.
+ */
+func CreateLogLine(alias string, stream string, raw string) *LogLine {
+	line := &LogLine{}
+
+	line.Alias  = alias
+	line.Stream = stream
+	line.Text   = raw
+
+	if i := strings.IndexByte(raw, ' '); i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, raw[:i]); err == nil {
+			line.Time = t
+			line.Text = raw[i+1:]
+		}
+	}
+
+	return line
+}
+
+/**
+ * LogLine.String() string
+ */
+func (line *LogLine) String() string {
+	return line.Time.Format(time.RFC3339Nano) + " " + line.Stream + " " + line.Text
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * LogFilter class
+ *
+ * Selects lines by stream, time and pattern. Zero Since and nil Grep match every line.
+ */
+type LogFilter struct {
+	Streams		[]string
+	Since		time.Time
+	Grep		*regexp.Regexp
+}
+
+/**
+ * LogFilter constructor
+ */
+func CreateLogFilter() *LogFilter {
+	filter := &LogFilter{}
+
+	filter.Streams = []string{wrapper.LOG_STREAM_STDOUT, wrapper.LOG_STREAM_STDERR}
+	filter.Grep    = nil
+
+	return filter
+}
+
+/**
+ * LogFilter.Match(*LogLine) bool
+ */
+func (filter *LogFilter) Match(line *LogLine) bool {
+	if !filter.Since.IsZero() && line.Time.Before(filter.Since) {
+		return false
+	}
+	if filter.Grep != nil && !filter.Grep.MatchString(line.Text) {
+		return false
+	}
+
+	return true
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * LogFollower class
+ *
+ * Reads captured output of several processes. Tail returns lines written so far and Poll the ones written since the
+ * previous call, following current log files across rotation.
+ */
+type LogFollower struct {
+	config		*wrapper.LogConfig
+	filter		*LogFilter
+	cursors		[]*logCursor
+}
+
+/**
+ * LogFollower constructor
+ */
+func CreateLogFollower(config *wrapper.LogConfig, aliases []string, filter *LogFilter) *LogFollower {
+	follower := &LogFollower{}
+
+	follower.config  = config
+	follower.filter  = filter
+	follower.cursors = []*logCursor{}
+
+	for _, alias := range aliases {
+		for _, stream := range filter.Streams {
+			follower.cursors = append(follower.cursors, createLogCursor(config.GetLogPath(alias, stream), alias, stream))
+		}
+	}
+
+	return follower
+}
+
+/**
+ * LogFollower.Tail(int) ([]*LogLine, errors.Error)
+ *
+ * Returns last matching lines merged by time, oldest first. Negative count returns every line still retained.
+ */
+func (follower *LogFollower) Tail(count int) ([]*LogLine, errors.Error) {
+	lines := []*LogLine{}
+
+	for _, cursor := range follower.cursors {
+		raw, err := cursor.read()
+		if err != nil {
+			return nil, err
+		}
+		found := follower.match(cursor, raw)
+		done := follower.isEnough(cursor, raw, found, count)
+
+		// current file is not enough, continue with rotated ones from the newest
+		files := follower.config.FindLogFiles(cursor.alias, cursor.stream)
+		for i := len(files) - 2; i >= 0 && !done; i-- {
+			raw, err := readLogFile(files[i])
+			if err != nil {
+				return nil, err
+			}
+			found = append(follower.match(cursor, raw), found...)
+			done = follower.isEnough(cursor, raw, found, count)
+		}
+
+		lines = append(lines, lastLines(found, count)...)
+	}
+
+	sortLines(lines)
+
+	return lastLines(lines, count), nil
+}
+
+/**
+ * LogFollower.Poll() ([]*LogLine, errors.Error)
+ *
+ * Returns matching lines written since the previous call merged by time.
+ */
+func (follower *LogFollower) Poll() ([]*LogLine, errors.Error) {
+	lines := []*LogLine{}
+
+	for _, cursor := range follower.cursors {
+		raw, err := cursor.poll()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, follower.match(cursor, raw)...)
+	}
+
+	sortLines(lines)
+
+	return lines, nil
+}
+
+/**
+ * LogFollower.Close()
+ */
+func (follower *LogFollower) Close() {
+	for _, cursor := range follower.cursors {
+		cursor.close()
+	}
+}
+
+/**
+ * LogFollower.match(*logCursor, []string) []*LogLine
+ */
+func (follower *LogFollower) match(cursor *logCursor, raw []string) []*LogLine {
+	lines := []*LogLine{}
+
+	for _, text := range raw {
+		if line := CreateLogLine(cursor.alias, cursor.stream, text); follower.filter.Match(line) {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+/**
+ * LogFollower.isEnough(*logCursor, []string, []*LogLine, int) bool
+ *
+ * Older files need not to be read when there are enough lines or the oldest line read is before Since, so that
+ * lines of older files would be filtered out anyway.
+ */
+func (follower *LogFollower) isEnough(cursor *logCursor, raw []string, found []*LogLine, count int) bool {
+	if count >= 0 && len(found) >= count {
+		return true
+	}
+	if !follower.filter.Since.IsZero() && len(raw) > 0 {
+		return CreateLogLine(cursor.alias, cursor.stream, raw[0]).Time.Before(follower.filter.Since)
+	}
+
+	return false
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * logCursor class
+ *
+ * Position in current log file of one stream. File is kept open, so that lines written before rotation can be read
+ * even after it has been moved away.
+ */
+type logCursor struct {
+	path		string
+	alias		string
+	stream		string
+	file		*os.File
+	reader		*bufio.Reader
+	pending		string
+}
+
+func createLogCursor(path string, alias string, stream string) *logCursor {
+	cursor := &logCursor{}
+
+	cursor.path    = path
+	cursor.alias   = alias
+	cursor.stream  = stream
+	cursor.file    = nil
+	cursor.reader  = nil
+	cursor.pending = ""
+
+	return cursor
+}
+
+/**
+ * logCursor.read() ([]string, errors.Error)
+ *
+ * Returns complete lines appended since the last read, partially written line is kept until it is finished.
+ */
+func (cursor *logCursor) read() ([]string, errors.Error) {
+	if cursor.file == nil {
+		file, err := os.Open(cursor.path)
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		if err != nil {
+			return nil, errors.New(PROCESS_ERR_LOGS, err.Error())
+		}
+
+		cursor.file   = file
+		cursor.reader = bufio.NewReader(file)
+	}
+
+	lines := []string{}
+	for {
+		chunk, err := cursor.reader.ReadString('\n')
+		cursor.pending += chunk
+
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, errors.New(PROCESS_ERR_LOGS, err.Error())
+		}
+
+		lines = append(lines, strings.TrimSuffix(cursor.pending, "\n"))
+		cursor.pending = ""
+	}
+}
+
+/**
+ * logCursor.poll() ([]string, errors.Error)
+ *
+ * Reads rest of the open file and switches to the new one when path has been rotated or truncated meanwhile. Old file
+ * is read to its end once more before switching, so nothing written right before rotation is skipped.
+ */
+func (cursor *logCursor) poll() ([]string, errors.Error) {
+	lines, err := cursor.read()
+	if err != nil || cursor.file == nil {
+		return lines, err
+	}
+
+	current, serr := os.Stat(cursor.path)
+	if serr != nil {
+		return lines, nil
+	}
+
+	opened, serr := cursor.file.Stat()
+	offset, _ := cursor.file.Seek(0, io.SeekCurrent)
+	if serr == nil && os.SameFile(opened, current) && current.Size() >= offset {
+		return lines, nil
+	}
+
+	// lines written between the read above and the rotation are still in the old file only
+	rest, err := cursor.read()
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, rest...)
+	if cursor.pending != "" {
+		lines = append(lines, cursor.pending)
+	}
+
+	cursor.close()
+	more, err := cursor.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lines, more...), nil
+}
+
+func (cursor *logCursor) close() {
+	if cursor.file != nil {
+		cursor.file.Close()
+	}
+
+	cursor.file    = nil
+	cursor.reader  = nil
+	cursor.pending = ""
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * LoadLogConfig(*Environment) *wrapper.LogConfig
+ *
+ * Reads logs section of environment, maxAge is given in seconds.
+ */
+func LoadLogConfig(env *Environment) *wrapper.LogConfig {
+	config := wrapper.CreateLogConfig()
+
+	if env == nil {
+		return config
+	}
+
+	logs := env.GetConfig().Get("logs")
+
+	config.Enabled  = logs.Get("enabled").MustBool(config.Enabled)
+	config.Dir      = logs.Get("dir").MustString(config.Dir)
+	config.MaxSize  = logs.Get("maxSize").MustInt64(config.MaxSize)
+	config.Retain   = logs.Get("retain").MustInt(config.Retain)
+	config.Compress = logs.Get("compress").MustBool(config.Compress)
+
+	if maxAge := logs.Get("maxAge").MustFloat64(-1); maxAge >= 0 {
+		config.MaxAge = time.Duration(maxAge * float64(time.Second))
+	}
+
+	return config
+}
+
+/**
+ * readLogFile(string) ([]string, errors.Error)
+ *
+ * Reads lines of log file, gzipped files are recognized by suffix. Rotated file which has been compressed since it has
+ * been found is read from its gzipped copy.
+ */
+func readLogFile(path string) ([]string, errors.Error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && !strings.HasSuffix(path, ".gz") {
+		path = path + ".gz"
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, errors.New(PROCESS_ERR_LOGS, err.Error())
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, errors.New(PROCESS_ERR_LOGS, err.Error())
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	lines := []string{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(PROCESS_ERR_LOGS, err.Error())
+		}
+	}
+
+	return lines, nil
+}
+
+func sortLines(lines []*LogLine) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+}
+
+func lastLines(lines []*LogLine, count int) []*LogLine {
+	if count >= 0 && len(lines) > count {
+		return lines[len(lines) - count:]
+	}
+
+	return lines
+}
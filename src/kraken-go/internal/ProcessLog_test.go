@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"os"
+	"time"
+	"regexp"
+	"testing"
+	"io/ioutil"
+	"../process/wrapper"
+)
+
+func createTestLogs(t *testing.T) *wrapper.LogConfig {
+	dir, err := ioutil.TempDir("", "kraken-logs")
+	if err != nil {
+		t.Fatalf("temp dir: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	config := wrapper.CreateLogConfig()
+	config.Dir     = dir
+	config.MaxSize = 0
+	config.MaxAge  = 0
+	config.Retain  = 10
+
+	return config
+}
+
+func openTestLog(t *testing.T, config *wrapper.LogConfig, stream string) *wrapper.LogFile {
+	log, err := wrapper.CreateLogFile(config, "app", stream)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	t.Cleanup(func() {
+		log.Close()
+	})
+
+	return log
+}
+
+func writeLines(t *testing.T, log *wrapper.LogFile, lines ...string) {
+	for _, line := range lines {
+		if err := log.WriteLine([]byte(line)); err != nil {
+			t.Fatalf("write: %s", err.GetMessage())
+		}
+	}
+}
+
+func expectLines(t *testing.T, got []*LogLine, want ...string) {
+	texts := []string{}
+	for _, line := range got {
+		texts = append(texts, line.Stream + ":" + line.Text)
+	}
+
+	if len(texts) != len(want) {
+		t.Fatalf("got %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Fatalf("got %q, want %q", texts, want)
+		}
+	}
+}
+
+func TestLogFollowerTailAcrossRotation(t *testing.T) {
+	config := createTestLogs(t)
+	config.MaxSize  = 80
+	config.Compress = true
+
+	stdout := openTestLog(t, config, wrapper.LOG_STREAM_STDOUT)
+	stderr := openTestLog(t, config, wrapper.LOG_STREAM_STDERR)
+
+	writeLines(t, stdout, "out 1", "out 2")
+	writeLines(t, stderr, "err 1")
+	writeLines(t, stdout, "out 3", "out 4")
+	writeLines(t, stderr, "err 2")
+	writeLines(t, stdout, "out 5")
+
+	// let compression of rotated files finish
+	stdout.Close()
+	stderr.Close()
+
+	if files := config.FindLogFiles("app", wrapper.LOG_STREAM_STDOUT); len(files) < 3 {
+		t.Fatalf("output has not been rotated, files %v", files)
+	}
+
+	follower := CreateLogFollower(config, []string{"app"}, CreateLogFilter())
+	lines, err := follower.Tail(4)
+	follower.Close()
+	if err != nil {
+		t.Fatalf("tail: %s", err.GetMessage())
+	}
+	expectLines(t, lines, "stdout:out 3", "stdout:out 4", "stderr:err 2", "stdout:out 5")
+
+	filter := CreateLogFilter()
+	filter.Streams = []string{wrapper.LOG_STREAM_STDOUT}
+	filter.Grep    = regexp.MustCompile(`[24]$`)
+
+	follower = CreateLogFollower(config, []string{"app"}, filter)
+	lines, err = follower.Tail(-1)
+	follower.Close()
+	if err != nil {
+		t.Fatalf("tail: %s", err.GetMessage())
+	}
+	expectLines(t, lines, "stdout:out 2", "stdout:out 4")
+}
+
+func TestLogFollowerPollAcrossRotation(t *testing.T) {
+	config := createTestLogs(t)
+	config.MaxAge = 100 * time.Millisecond
+
+	stdout := openTestLog(t, config, wrapper.LOG_STREAM_STDOUT)
+	writeLines(t, stdout, "old")
+
+	follower := CreateLogFollower(config, []string{"app"}, CreateLogFilter())
+	defer follower.Close()
+
+	lines, err := follower.Tail(10)
+	if err != nil {
+		t.Fatalf("tail: %s", err.GetMessage())
+	}
+	expectLines(t, lines, "stdout:old")
+
+	if lines, _ := follower.Poll(); len(lines) != 0 {
+		t.Fatalf("lines returned by tail have been polled again")
+	}
+
+	// lines written right before rotation are read from the rotated file
+	writeLines(t, stdout, "before")
+	time.Sleep(150 * time.Millisecond)
+	writeLines(t, stdout, "after 1", "after 2")
+
+	if files := config.FindLogFiles("app", wrapper.LOG_STREAM_STDOUT); len(files) != 2 {
+		t.Fatalf("output has not been rotated, files %v", files)
+	}
+
+	lines, err = follower.Poll()
+	if err != nil {
+		t.Fatalf("poll: %s", err.GetMessage())
+	}
+	expectLines(t, lines, "stdout:before", "stdout:after 1", "stdout:after 2")
+
+	// file truncated in place is read from its start again
+	os.Truncate(config.GetLogPath("app", wrapper.LOG_STREAM_STDOUT), 0)
+	stdout.Reopen()
+	writeLines(t, stdout, "fresh")
+
+	lines, err = follower.Poll()
+	if err != nil {
+		t.Fatalf("poll: %s", err.GetMessage())
+	}
+	expectLines(t, lines, "stdout:fresh")
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"../errors"
+)
+
+const (
+	PROCESS_ERR_STAT			int = 40
+)
+
+/**
+ * ProcessStat class
+ *
+ * Resource usage of single process as reported by operating system. Counters which cannot be read, like I/O of
+ * processes owned by other users, are left zero.
+ */
+type ProcessStat struct {
+	Pid				int
+	Processes		int
+	CpuSeconds		float64
+	ResidentBytes	uint64
+	OpenFiles		int
+	Threads			int
+	ReadBytes		uint64
+	WriteBytes		uint64
+}
+
+/**
+ * ProcessStat.add(*ProcessStat)
+ */
+func (stat *ProcessStat) add(other *ProcessStat) {
+	stat.Processes     += other.Processes
+	stat.CpuSeconds    += other.CpuSeconds
+	stat.ResidentBytes += other.ResidentBytes
+	stat.OpenFiles     += other.OpenFiles
+	stat.Threads       += other.Threads
+	stat.ReadBytes     += other.ReadBytes
+	stat.WriteBytes    += other.WriteBytes
+}
+
+/**
+ * ReadProcessTreeStat(int) (*ProcessStat, errors.Error)
+ *
+ * Sums usage of process and all of its descendants. Descendants which exit while being read are skipped.
+ */
+func ReadProcessTreeStat(pid int) (*ProcessStat, errors.Error) {
+	stat, err := ReadProcessStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := readProcessChildren()
+	if err != nil {
+		return nil, err
+	}
+
+	queue := children[pid]
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = append(queue[1:], children[child]...)
+
+		if childStat, err := ReadProcessStat(child); err == nil {
+			stat.add(childStat)
+		}
+	}
+
+	return stat, nil
+}
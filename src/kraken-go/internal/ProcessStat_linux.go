@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"os"
+	"strings"
+	"strconv"
+	"io/ioutil"
+	"../errors"
+)
+
+const (
+	CLOCK_TICKS					float64 = 100
+)
+
+/**
+ * ReadProcessStat(int) (*ProcessStat, errors.Error)
+ *
+ * Reads /proc/<pid>/stat, fd and io. CPU time is user and system time, resident memory is converted from pages to
+ * bytes.
+ */
+func ReadProcessStat(pid int) (*ProcessStat, errors.Error) {
+	dir := "/proc/" + strconv.Itoa(pid)
+
+	fields, err := readStatFields(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	rss, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	stat := &ProcessStat{}
+
+	stat.Pid           = pid
+	stat.Processes     = 1
+	stat.CpuSeconds    = float64(utime + stime) / CLOCK_TICKS
+	stat.ResidentBytes = rss * uint64(os.Getpagesize())
+	stat.Threads       = threads
+
+	if fds, err := ioutil.ReadDir(dir + "/fd"); err == nil {
+		stat.OpenFiles = len(fds)
+	}
+
+	if data, err := ioutil.ReadFile(dir + "/io"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			opt := strings.SplitN(line, ": ", 2)
+			if len(opt) != 2 {
+				continue
+			}
+			switch opt[0] {
+				case "read_bytes":
+					stat.ReadBytes, _ = strconv.ParseUint(opt[1], 10, 64)
+				case "write_bytes":
+					stat.WriteBytes, _ = strconv.ParseUint(opt[1], 10, 64)
+			}
+		}
+	}
+
+	return stat, nil
+}
+
+/**
+ * readProcessChildren() (map[int][]int, errors.Error)
+ *
+ * Scans /proc once and maps every pid to pids of its children.
+ */
+func readProcessChildren() (map[int][]int, errors.Error) {
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, errors.New(PROCESS_ERR_STAT, err.Error())
+	}
+
+	children := map[int][]int{}
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+
+		fields, serr := readStatFields("/proc/" + dir.Name())
+		if serr != nil {
+			continue
+		}
+
+		ppid, _ := strconv.Atoi(fields[1])
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	return children, nil
+}
+
+/**
+ * readStatFields(string) ([]string, errors.Error)
+ *
+ * Returns fields of stat file following command name, so state is the first one.
+ */
+func readStatFields(dir string) ([]string, errors.Error) {
+	data, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return nil, errors.New(PROCESS_ERR_STAT, err.Error())
+	}
+
+	// command name is enclosed in parentheses and may contain spaces, fields are counted from the closing one
+	line := string(data)
+	end := strings.LastIndexByte(line, ')')
+	if end < 0 {
+		return nil, errors.New(PROCESS_ERR_STAT, "Malformed " + dir + "/stat.")
+	}
+
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return nil, errors.New(PROCESS_ERR_STAT, "Malformed " + dir + "/stat.")
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,20 @@
+// +build !linux
+
+package internal
+
+import (
+	"../errors"
+)
+
+/**
+ * ReadProcessStat(int) (*ProcessStat, errors.Error)
+ *
+ * Resource usage is read from /proc, which is Linux specific.
+ */
+func ReadProcessStat(pid int) (*ProcessStat, errors.Error) {
+	return nil, errors.New(PROCESS_ERR_STAT, "Process stats are not supported on this platform.")
+}
+
+func readProcessChildren() (map[int][]int, errors.Error) {
+	return nil, errors.New(PROCESS_ERR_STAT, "Process stats are not supported on this platform.")
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	COLLECTOR_INTERVAL			time.Duration = 2 * time.Second
+	COLLECTOR_HISTORY			int = 60
+)
+
+/**
+ * ResourceCollector class
+ *
+ * Periodically samples resource usage of every running process managed by ProcManager, including its descendants, and
+ * keeps last samples of each one. History is dropped when process is restarted under new pid or removed.
+ */
+type ResourceCollector struct {
+	Interval	time.Duration
+	Capacity	int
+	pm			*ProcManager
+	lock		sync.Mutex
+	history		map[string]*ResourceHistory
+	stop		chan struct{}
+	done		chan struct{}
+}
+
+/**
+ * ResourceCollector constructor
+ */
+func CreateResourceCollector(pm *ProcManager) *ResourceCollector {
+	collector := &ResourceCollector{}
+
+	collector.Interval = COLLECTOR_INTERVAL
+	collector.Capacity = COLLECTOR_HISTORY
+	collector.pm       = pm
+	collector.history  = map[string]*ResourceHistory{}
+	collector.stop     = nil
+	collector.done     = nil
+
+	return collector
+}
+
+/**
+ * LoadResourceCollector(*Environment, *ProcManager) *ResourceCollector
+ *
+ * Configures collector from collector section of environment, interval is given in seconds.
+ */
+func LoadResourceCollector(env *Environment, pm *ProcManager) *ResourceCollector {
+	collector := CreateResourceCollector(pm)
+
+	if env == nil {
+		return collector
+	}
+
+	config := env.GetConfig().Get("collector")
+	if interval := config.Get("interval").MustFloat64(0); interval > 0 {
+		collector.Interval = time.Duration(interval * float64(time.Second))
+	}
+	collector.Capacity = config.Get("history").MustInt(COLLECTOR_HISTORY)
+
+	return collector
+}
+
+/**
+ * ResourceCollector.Start()
+ */
+func (collector *ResourceCollector) Start() {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	if collector.stop != nil {
+		return
+	}
+
+	collector.stop = make(chan struct{})
+	collector.done = make(chan struct{})
+
+	go collector.run(collector.stop, collector.done)
+}
+
+/**
+ * ResourceCollector.Stop()
+ *
+ * Waits until sampling in progress finishes.
+ */
+func (collector *ResourceCollector) Stop() {
+	collector.lock.Lock()
+	stop, done := collector.stop, collector.done
+	collector.stop, collector.done = nil, nil
+	collector.lock.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+/**
+ * ResourceCollector.Collect()
+ *
+ * Takes one sample of every running process.
+ */
+func (collector *ResourceCollector) Collect() {
+	entries := collector.pm.GetProcesses()
+	samples := map[string]*ResourceSample{}
+
+	for _, entry := range entries {
+		if !entry.IsRunning() || entry.Pid == 0 {
+			continue
+		}
+		if stat, err := ReadProcessTreeStat(entry.Pid); err == nil {
+			samples[entry.Alias] = CreateResourceSample(entry.Alias, stat)
+		}
+	}
+
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	for alias, history := range collector.history {
+		if sample, ok := samples[alias]; !ok || sample.Pid != history.pid {
+			delete(collector.history, alias)
+		}
+	}
+
+	for alias, sample := range samples {
+		history, ok := collector.history[alias]
+		if !ok {
+			history = CreateResourceHistory(sample.Pid, collector.Capacity)
+			collector.history[alias] = history
+		}
+
+		if last := history.GetLast(); last != nil {
+			elapsed := sample.Time.Sub(last.Time).Seconds()
+			if elapsed > 0 && sample.CpuSeconds > last.CpuSeconds {
+				sample.CpuPercent = (sample.CpuSeconds - last.CpuSeconds) / elapsed * 100
+			}
+		}
+		history.Add(sample)
+	}
+}
+
+/**
+ * ResourceCollector.GetHistory(string) []*ResourceSample
+ *
+ * Returns samples of process ordered from the oldest one, nil when there are none.
+ */
+func (collector *ResourceCollector) GetHistory(alias string) []*ResourceSample {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	if history, ok := collector.history[alias]; ok {
+		return history.GetSamples()
+	}
+
+	return nil
+}
+
+/**
+ * ResourceCollector.GetLatest() []*ResourceSample
+ *
+ * Returns the last sample of every process which has been sampled.
+ */
+func (collector *ResourceCollector) GetLatest() []*ResourceSample {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	samples := []*ResourceSample{}
+	for _, history := range collector.history {
+		if sample := history.GetLast(); sample != nil {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * ResourceCollector.run(chan struct{}, chan struct{})
+ */
+func (collector *ResourceCollector) run(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(collector.Interval)
+	defer ticker.Stop()
+
+	collector.Collect()
+	for {
+		select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				collector.Collect()
+		}
+	}
+}
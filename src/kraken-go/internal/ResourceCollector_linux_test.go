@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"os"
+	"time"
+	"os/exec"
+	"testing"
+)
+
+func TestReadProcessTreeStat(t *testing.T) {
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skipf("sleep cannot be started: %s", err)
+	}
+	defer child.Wait()
+	defer child.Process.Kill()
+
+	own, err := ReadProcessStat(os.Getpid())
+	if err != nil {
+		t.Fatalf("stat: %s", err.GetMessage())
+	}
+	if own.Pid != os.Getpid() || own.Processes != 1 || own.ResidentBytes == 0 || own.Threads == 0 || own.OpenFiles == 0 {
+		t.Errorf("unexpected stat %+v", own)
+	}
+
+	tree, err := ReadProcessTreeStat(os.Getpid())
+	if err != nil {
+		t.Fatalf("tree stat: %s", err.GetMessage())
+	}
+	if tree.Processes < 2 || tree.CpuSeconds < own.CpuSeconds {
+		t.Errorf("child has not been included, %+v", tree)
+	}
+
+	if _, err := ReadProcessStat(1 << 30); err == nil {
+		t.Errorf("stat of missing process has been read")
+	}
+}
+
+func TestResourceHistoryKeepsLastSamples(t *testing.T) {
+	history := CreateResourceHistory(1, 3)
+	if history.GetLast() != nil || len(history.GetSamples()) != 0 {
+		t.Fatalf("new history is not empty")
+	}
+
+	for i := 1; i <= 5; i++ {
+		history.Add(CreateResourceSample("app", &ProcessStat{Pid: 1, Threads: i}))
+	}
+
+	samples := history.GetSamples()
+	if len(samples) != 3 || samples[0].Threads != 3 || samples[2].Threads != 5 || history.GetLast() != samples[2] {
+		t.Errorf("unexpected samples %+v", samples)
+	}
+}
+
+func TestResourceCollector(t *testing.T) {
+	pm := createTestManager(t)
+	if _, err := pm.CreateProcess("app", "project", "component", "sleep", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	if _, err := pm.CreateProcess("done", "project", "component", "exit", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	waitState(t, pm, "done", PROCESS_STATE_EXITED, time.Second)
+
+	collector := CreateResourceCollector(pm)
+	collector.Collect()
+	time.Sleep(20 * time.Millisecond)
+	collector.Collect()
+
+	history := collector.GetHistory("app")
+	if len(history) != 2 || history[1].Pid != pm.GetPid("app") || history[1].ResidentBytes == 0 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if collector.GetHistory("done") != nil {
+		t.Errorf("exited process has been sampled")
+	}
+	if latest := collector.GetLatest(); len(latest) != 1 || latest[0] != history[1] {
+		t.Errorf("unexpected latest samples %+v", latest)
+	}
+
+	// restarted process starts new history
+	if _, err := pm.RestartProcess("app"); err != nil {
+		t.Fatalf("restart: %s", err.GetMessage())
+	}
+	collector.Collect()
+	if history := collector.GetHistory("app"); len(history) != 1 || history[0].Pid != pm.GetPid("app") {
+		t.Errorf("history has not been reset, %+v", history)
+	}
+
+	// stopped process is dropped
+	pm.StopProcess("app")
+	collector.Collect()
+	if collector.GetHistory("app") != nil {
+		t.Errorf("stopped process is still sampled")
+	}
+}
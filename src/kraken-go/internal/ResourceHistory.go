@@ -0,0 +1,72 @@
+package internal
+
+/**
+ * ResourceHistory class
+ *
+ * Ring buffer of last samples of one process, the oldest sample is overwritten once capacity is reached.
+ */
+type ResourceHistory struct {
+	pid			int
+	samples		[]*ResourceSample
+	next		int
+	size		int
+}
+
+/**
+ * ResourceHistory constructor
+ */
+func CreateResourceHistory(pid int, capacity int) *ResourceHistory {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	history := &ResourceHistory{}
+
+	history.pid     = pid
+	history.samples = make([]*ResourceSample, capacity)
+	history.next    = 0
+	history.size    = 0
+
+	return history
+}
+
+/**
+ * ResourceHistory.Add(*ResourceSample)
+ */
+func (history *ResourceHistory) Add(sample *ResourceSample) {
+	history.samples[history.next] = sample
+	history.next = (history.next + 1) % len(history.samples)
+
+	if history.size < len(history.samples) {
+		history.size++
+	}
+}
+
+/**
+ * ResourceHistory.GetLast() *ResourceSample
+ *
+ * Returns nil when history is empty.
+ */
+func (history *ResourceHistory) GetLast() *ResourceSample {
+	if history.size == 0 {
+		return nil
+	}
+
+	return history.samples[(history.next + len(history.samples) - 1) % len(history.samples)]
+}
+
+/**
+ * ResourceHistory.GetSamples() []*ResourceSample
+ *
+ * Returns samples ordered from the oldest one.
+ */
+func (history *ResourceHistory) GetSamples() []*ResourceSample {
+	samples := make([]*ResourceSample, 0, history.size)
+	start := (history.next + len(history.samples) - history.size) % len(history.samples)
+
+	for i := 0; i < history.size; i++ {
+		samples = append(samples, history.samples[(start + i) % len(history.samples)])
+	}
+
+	return samples
+}
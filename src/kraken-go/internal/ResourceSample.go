@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"time"
+	"strconv"
+	"../storage"
+)
+
+/**
+ * ResourceSample class
+ *
+ * Resource usage of managed process and its descendants at single point of time. CpuPercent is usage since previous
+ * sample, 100 means one fully used core.
+ */
+type ResourceSample struct {
+	Alias			string
+	Time			time.Time
+	CpuPercent		float64
+	ProcessStat
+}
+
+/**
+ * ResourceSample constructor
+ */
+func CreateResourceSample(alias string, stat *ProcessStat) *ResourceSample {
+	sample := &ResourceSample{}
+
+	sample.Alias       = alias
+	sample.Time        = time.Now()
+	sample.CpuPercent  = 0
+	sample.ProcessStat = *stat
+
+	return sample
+}
+
+/**
+ * ResourceSample.ToRecord() *storage.DataRecord
+ */
+func (sample *ResourceSample) ToRecord() *storage.DataRecord {
+	data := map[string]string{}
+	data["alias"]		= sample.Alias
+	data["time"]		= strconv.FormatInt(sample.Time.UnixNano(), 10)
+	data["cpu"]			= strconv.FormatFloat(sample.CpuPercent, 'f', 2, 64)
+	data["pid"]			= strconv.Itoa(sample.Pid)
+	data["processes"]	= strconv.Itoa(sample.Processes)
+	data["cpuSeconds"]	= strconv.FormatFloat(sample.CpuSeconds, 'f', 2, 64)
+	data["rss"]			= strconv.FormatUint(sample.ResidentBytes, 10)
+	data["fds"]			= strconv.Itoa(sample.OpenFiles)
+	data["threads"]		= strconv.Itoa(sample.Threads)
+	data["readBytes"]	= strconv.FormatUint(sample.ReadBytes, 10)
+	data["writeBytes"]	= strconv.FormatUint(sample.WriteBytes, 10)
+
+	return storage.CreateDataRecord().FromMap(data)
+}
+
+/**
+ * LoadResourceSample(*storage.DataRecord) *ResourceSample
+ */
+func LoadResourceSample(record *storage.DataRecord) *ResourceSample {
+	sample := &ResourceSample{}
+
+	nanos, _ := strconv.ParseInt(record.Get("time"), 10, 64)
+
+	sample.Alias            = record.Get("alias")
+	sample.Time             = time.Unix(0, nanos)
+	sample.CpuPercent, _    = strconv.ParseFloat(record.Get("cpu"), 64)
+	sample.Pid, _           = strconv.Atoi(record.Get("pid"))
+	sample.Processes, _     = strconv.Atoi(record.Get("processes"))
+	sample.CpuSeconds, _    = strconv.ParseFloat(record.Get("cpuSeconds"), 64)
+	sample.ResidentBytes, _ = strconv.ParseUint(record.Get("rss"), 10, 64)
+	sample.OpenFiles, _     = strconv.Atoi(record.Get("fds"))
+	sample.Threads, _       = strconv.Atoi(record.Get("threads"))
+	sample.ReadBytes, _     = strconv.ParseUint(record.Get("readBytes"), 10, 64)
+	sample.WriteBytes, _    = strconv.ParseUint(record.Get("writeBytes"), 10, 64)
+
+	return sample
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"time"
+	"context"
+	"../tcp"
+	"../storage"
+	"../errors"
+	"../process/wrapper"
+)
+
+const (
+	WRAPPER_CALL_TIMEOUT		time.Duration = 10 * time.Second
+)
+
+const (
+	WRAPPER_ERR_UNREACHABLE		int = 45
+)
+
+/**
+ * WrapperClient class
+ *
+ * Connection to control socket of wrapper running given alias, lets command line tools write to stdin of the process
+ * and signal it without knowing its pid.
+ */
+type WrapperClient struct {
+	Alias		string
+	sock		*tcp.Socket
+}
+
+/**
+ * ConnectWrapper(*Environment, string) (*WrapperClient, errors.Error)
+ */
+func ConnectWrapper(env *Environment, alias string) (*WrapperClient, errors.Error) {
+	path := wrapper.GetControlPath(GetControlDir(env), alias)
+	sock := tcp.CreateSocket()
+
+	if err := sock.ConnectUnix(path); err != nil {
+		return nil, errors.New(WRAPPER_ERR_UNREACHABLE, "Process " + alias + " is not reachable at " + path + ", " + err.GetMessage())
+	}
+
+	client := &WrapperClient{}
+	client.Alias = alias
+	client.sock  = sock
+
+	return client, nil
+}
+
+/**
+ * WrapperClient.Close()
+ */
+func (client *WrapperClient) Close() {
+	client.sock.Close()
+}
+
+/**
+ * WrapperClient.Send(string) errors.Error
+ */
+func (client *WrapperClient) Send(text string) errors.Error {
+	return client.call(wrapper.CONTROL_SEND, map[string]string{"text": text})
+}
+
+/**
+ * WrapperClient.Signal(string) errors.Error
+ */
+func (client *WrapperClient) Signal(signal string) errors.Error {
+	return client.call(wrapper.CONTROL_SIGNAL, map[string]string{"signal": signal})
+}
+
+func (client *WrapperClient) call(method string, args map[string]string) errors.Error {
+	ctx, cancel := context.WithTimeout(context.Background(), WRAPPER_CALL_TIMEOUT)
+	defer cancel()
+
+	_, err := client.sock.Call(ctx, method, storage.CreateDataRecord().FromMap(args))
+
+	return err
+}
+
+/**
+ * GetControlDir(*Environment) string
+ *
+ * Reads directory of wrapper control sockets from control section of environment.
+ */
+func GetControlDir(env *Environment) string {
+	if env == nil {
+		return wrapper.CONTROL_DIR
+	}
+
+	return env.GetConfig().Get("control").Get("dir").MustString(wrapper.CONTROL_DIR)
+}
@@ -4,11 +4,13 @@ import (
 	"os"
 	"os/exec"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
-	"strconv"
 	"strings"
 	"../storage"
 	"../errors"
+	"../process/wrapper"
 )
 
 const (
@@ -16,6 +18,30 @@ const (
 	OS_UNIX		string = "unix"
 )
 
+const (
+	PROCESS_ERR_EXISTS			int = 2
+	PROCESS_ERR_START			int = 15
+	PROCESS_ERR_NOT_FOUND		int = 28
+	PROCESS_ERR_SIGNAL			int = 29
+	PROCESS_ERR_CONFIG			int = 30
+	PROCESS_ERR_RUNNING			int = 31
+	PROCESS_ERR_NOT_RUNNING		int = 32
+	PROCESS_ERR_LOGS			int = 38
+)
+
+const (
+	RESTART_ALWAYS				string = "always"
+	RESTART_ON_FAILURE			string = "on-failure"
+	RESTART_NEVER				string = "never"
+)
+
+const (
+	RESTART_DELAY				time.Duration = 1 * time.Second
+	RESTART_DELAY_MAX			time.Duration = 30 * time.Second
+	RESTART_RESET_AFTER			time.Duration = 60 * time.Second
+	STOP_TIMEOUT				time.Duration = 10 * time.Second
+)
+
 /**
  * Process class
  */
@@ -78,14 +104,15 @@ func (p *ProcessInstance) Start(alias string, projectName string, componentName
 	// Prepare command
 	exe, params := p.PrepareCommand(params)
 	if exe == "" {
-		return errors.New(30, "Wrong configuration specified.")
+		return errors.New(PROCESS_ERR_CONFIG, "Wrong configuration specified.")
 	}
 
 	cmd := exec.Command(exe, params...)
+	cmd.Env = append(os.Environ(), p.wrapperEnv()...)
 
 	// Start the process
 	if err := cmd.Start(); err != nil {
-		return errors.New(15, err.Error())
+		return errors.New(PROCESS_ERR_START, err.Error())
 	}
 
 	// Don't let function exit before our command has finished running
@@ -95,18 +122,61 @@ func (p *ProcessInstance) Start(alias string, projectName string, componentName
 }
 
 /**
- * ProcList struct
+ * Process.Spawn(string,string,string,string) (*exec.Cmd, errors.Error)
+ *
+ * Starts wrapper as direct child of the caller, so that it can be supervised, and tells it not to register itself.
+ */
+func (p *ProcessInstance) Spawn(alias string, projectName string, componentName string, processName string) (*exec.Cmd, errors.Error) {
+	exe, _ := p.env.GetConfig().Get("env").Get("exe").String()
+	params := strings.Fields(exe)
+	if len(params) == 0 {
+		return nil, errors.New(PROCESS_ERR_CONFIG, "Wrong configuration specified.")
+	}
+	params = append(params, alias, projectName, componentName, processName)
+
+	cmd := exec.Command(params[0], params[1:]...)
+	cmd.Env    = append(os.Environ(), wrapper.ENV_SUPERVISED + "=1")
+	cmd.Env    = append(cmd.Env, p.wrapperEnv()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New(PROCESS_ERR_START, err.Error())
+	}
+
+	return cmd, nil
+}
+
+/**
+ * Process.wrapperEnv() []string
+ *
+ * Returns environment which passes log capture, output format and control socket configuration to wrapper.
  */
-type ProcList map[string]string
+func (p *ProcessInstance) wrapperEnv() []string {
+	env := LoadLogConfig(p.env).ToEnv()
+	env = append(env, wrapper.ENV_OUTPUT + "=" + p.env.GetConfig().Get("output").Get("format").MustString(wrapper.OUTPUT_RAW))
+	env = append(env, wrapper.ENV_CONTROL_DIR + "=" + GetControlDir(p.env))
 
+	return env
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
 /**
  * ProcManager class
+ *
+ * Registry of managed processes, kept in memory by the daemon and written through to storage after every change.
+ * Processes are spawned as children of the manager, which watches them and restarts them according to restart policy.
  */
 type ProcManager struct {
 	env				*Environment
-	storage			*storage.FileStorage
-	timeOut         int
-	timeInterval    int
+	storage			storage.Storage
+	lock			sync.Mutex
+	procs			map[string]*ProcessEntry
+	restart			string
+	logs			*wrapper.LogConfig
+	stopTimeout		time.Duration
+	closing			bool
 }
 
 /**
@@ -115,70 +185,259 @@ type ProcManager struct {
 func CreateProcManager(env *Environment) *ProcManager {
 	pm := &ProcManager{}
 
-	var err errors.Error
-	pm.storage, err = storage.NewFileStorage("kraken")
-
+	st, err := storage.NewFileStorage("kraken")
 	if err != nil {
 		return nil
 	}
 
 	pm.env			= env
-	pm.timeOut		= 1000
-	pm.timeInterval = 50
+	pm.storage		= st
+	pm.procs		= map[string]*ProcessEntry{}
+	pm.restart		= RESTART_ON_FAILURE
+	pm.logs			= LoadLogConfig(env)
+	pm.stopTimeout	= STOP_TIMEOUT
+	pm.closing		= false
+
+	if env != nil {
+		pm.restart = env.GetConfig().Get("daemon").Get("restart").MustString(RESTART_ON_FAILURE)
+	}
 
 	return pm
 }
 
-func (pm *ProcManager) CreateProcess(alias string, projectName string, componentName string, processName string, force bool) (int, errors.Error) {
-	if !force && pm.ExistsProcess(alias) {
-		return 0, errors.New(2, "Process already exists.")
-	}
+/**
+ * ProcManager.Load() errors.Error
+ *
+ * Restores registry from storage and starts processes which were running when it has been saved.
+ */
+func (pm *ProcManager) Load() errors.Error {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
 
-	// clean polluted data
-	pm.CleanAfterProcess(alias)
+	if _, err := pm.storage.Open(); err != nil {
+		return err
+	}
+	records, err := pm.storage.GetAll()
+	pm.storage.Close()
 
-	// create process
-	process := CreateProcess(pm.env)
-	err  := process.Start(alias, projectName, componentName, processName)
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	for _, record := range records {
+		entry := LoadProcessEntry(record)
+		entry.Pid = 0
+
+		pm.procs[entry.Alias] = entry
+
+		if entry.State == PROCESS_STATE_RUNNING || entry.State == PROCESS_STATE_RESTARTING {
+			if err := pm.spawn(entry); err != nil {
+				entry.State = PROCESS_STATE_FAILED
+			}
+		}
 	}
 
-	// find pid
-	pid := 0
-	for i := 0; i < pm.timeOut; i = i + pm.timeInterval {
-		pid = pm.GetPid(alias)
-		if pid != 0 {
-			break
+	return pm.persist()
+}
+
+/**
+ * ProcManager.CreateProcess(string, string, string, string, bool) (int, errors.Error)
+ *
+ * Registers and starts process. Existing process of the same alias is replaced when force is set.
+ */
+func (pm *ProcManager) CreateProcess(alias string, projectName string, componentName string, processName string, force bool) (int, errors.Error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	// lock is released while old process exits, so alias could have been taken again meanwhile
+	for entry, ok := pm.procs[alias]; ok; entry, ok = pm.procs[alias] {
+		if !force {
+			return 0, errors.New(PROCESS_ERR_EXISTS, "Process already exists.")
+		}
+
+		pm.stop(entry, true)
+		if pm.procs[alias] == entry {
+			delete(pm.procs, alias)
 		}
-		time.Sleep(time.Duration(pm.timeInterval) * time.Millisecond)
 	}
 
-	return pid, nil
+	entry := CreateProcessEntry(alias, projectName, componentName, processName)
+	if err := pm.spawn(entry); err != nil {
+		return 0, err
+	}
+	pm.procs[alias] = entry
+
+	return entry.Pid, pm.persist()
 }
 
 /**
  * ProcManager.DestroyProcess(string, bool) errors.Error
+ *
+ * Stops process and removes it from registry. Process is killed without grace period when force is set.
  */
 func (pm *ProcManager) DestroyProcess(alias string, force bool) errors.Error {
-	if !force {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entry, ok := pm.procs[alias]
+	if !ok {
+		return errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist.")
+	}
+
+	pm.stop(entry, force)
+	if pm.procs[alias] == entry {
+		delete(pm.procs, alias)
+	}
+
+	return pm.persist()
+}
+
+/**
+ * ProcManager.StartProcess(string) (int, errors.Error)
+ */
+func (pm *ProcManager) StartProcess(alias string) (int, errors.Error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entry, ok := pm.procs[alias]
+	if !ok {
+		return 0, errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist.")
+	}
+	if entry.cmd != nil {
+		return 0, errors.New(PROCESS_ERR_RUNNING, "Process " + alias + " is already running.")
+	}
+
+	pm.cancelRestart(entry)
+	entry.failures = 0
+
+	if err := pm.spawn(entry); err != nil {
+		entry.State = PROCESS_STATE_FAILED
+		pm.persist()
+		return 0, err
+	}
+
+	return entry.Pid, pm.persist()
+}
+
+/**
+ * ProcManager.StopProcess(string) errors.Error
+ *
+ * Asks process to exit and kills it when it does not within stop timeout. Stopped process is not restarted.
+ */
+func (pm *ProcManager) StopProcess(alias string) errors.Error {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entry, ok := pm.procs[alias]
+	if !ok {
+		return errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist.")
+	}
+	if entry.cmd == nil && entry.timer == nil {
+		return errors.New(PROCESS_ERR_NOT_RUNNING, "Process " + alias + " is not running.")
+	}
 
+	pm.stop(entry, false)
+
+	return pm.persist()
+}
+
+/**
+ * ProcManager.RestartProcess(string) (int, errors.Error)
+ *
+ * Stops process if it is running and starts it again.
+ */
+func (pm *ProcManager) RestartProcess(alias string) (int, errors.Error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entry, ok := pm.procs[alias]
+	if !ok {
+		return 0, errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist.")
+	}
+
+	pm.stop(entry, false)
+	if pm.procs[alias] != entry {
+		return 0, errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " has been replaced meanwhile.")
+	}
+	if entry.cmd != nil {
+		return 0, errors.New(PROCESS_ERR_RUNNING, "Process " + alias + " has been started meanwhile.")
+	}
+	entry.failures = 0
+
+	if err := pm.spawn(entry); err != nil {
+		entry.State = PROCESS_STATE_FAILED
+		pm.persist()
+		return 0, err
 	}
 
-	pid := pm.GetPid(alias)
-	if pid == 0 {
-		return errors.New(28, "Couldnt get process pid.")
+	return entry.Pid, pm.persist()
+}
+
+/**
+ * ProcManager.GetLogs(string, int) ([]string, errors.Error)
+ *
+ * Returns last lines of process output, each one prefixed with its timestamp and stream.
+ */
+func (pm *ProcManager) GetLogs(alias string, tail int) ([]string, errors.Error) {
+	if !pm.ExistsProcess(alias) {
+		return nil, errors.New(PROCESS_ERR_NOT_FOUND, "Process " + alias + " does not exist.")
+	}
+	if !pm.logs.Enabled {
+		return nil, errors.New(PROCESS_ERR_LOGS, "Output of process " + alias + " is not captured.")
 	}
 
-	process, err := os.FindProcess(pid)
+	follower := CreateLogFollower(pm.logs, []string{alias}, CreateLogFilter())
+	defer follower.Close()
+
+	lines, err := follower.Tail(tail)
 	if err != nil {
-		return errors.New(29, "Couldnt find process.")
+		return nil, err
+	}
+
+	output := []string{}
+	for _, line := range lines {
+		output = append(output, line.String())
+	}
+
+	return output, nil
+}
+
+/**
+ * ProcManager.GetLogConfig() *wrapper.LogConfig
+ */
+func (pm *ProcManager) GetLogConfig() *wrapper.LogConfig {
+	return pm.logs
+}
+
+/**
+ * ProcManager.GetProcesses() []*ProcessEntry
+ *
+ * Returns copies of all registered processes ordered by alias.
+ */
+func (pm *ProcManager) GetProcesses() []*ProcessEntry {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entries := []*ProcessEntry{}
+	for _, alias := range pm.aliases() {
+		entries = append(entries, pm.procs[alias].copy())
 	}
 
-	process.Kill()
+	return entries
+}
+
+/**
+ * ProcManager.GetProcess(string) *ProcessEntry
+ *
+ * Returns copy of registered process or nil.
+ */
+func (pm *ProcManager) GetProcess(alias string) *ProcessEntry {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
 
-	// clean polluted data
-	pm.CleanAfterProcess(alias)
+	if entry, ok := pm.procs[alias]; ok {
+		return entry.copy()
+	}
 
 	return nil
 }
@@ -187,65 +446,267 @@ func (pm *ProcManager) DestroyProcess(alias string, force bool) errors.Error {
  * ProcManager.ExistsProcess(string) bool
  */
 func (pm *ProcManager) ExistsProcess(alias string) bool {
-	pid := pm.GetPid(alias)
-	if pid == 0 {
-		return false
+	return pm.GetProcess(alias) != nil
+}
+
+/**
+ * ProcManager.GetPid(string) int
+ */
+func (pm *ProcManager) GetPid(alias string) int {
+	if entry := pm.GetProcess(alias); entry != nil {
+		return entry.Pid
+	}
+
+	return 0
+}
+
+/**
+ * ProcManager.Shutdown()
+ *
+ * Stops every child together with the daemon. Their state is saved as it was, so that Load starts them again.
+ */
+func (pm *ProcManager) Shutdown() {
+	pm.lock.Lock()
+	pm.closing = true
+
+	entries := []*ProcessEntry{}
+	for _, entry := range pm.procs {
+		pm.cancelRestart(entry)
+		if entry.cmd != nil {
+			entries = append(entries, entry)
+		}
 	}
 
-	_, err := os.FindProcess(pid)
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(process *os.Process, exited chan struct{}) {
+			defer wg.Done()
+			terminate(process, exited, pm.stopTimeout)
+		}(entry.cmd.Process, entry.exited)
+	}
+	pm.lock.Unlock()
+
+	wg.Wait()
+
+	pm.lock.Lock()
+	pm.persist()
+	pm.lock.Unlock()
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * ProcManager.spawn(*ProcessEntry) errors.Error
+ *
+ * Must be called with manager lock held.
+ */
+func (pm *ProcManager) spawn(entry *ProcessEntry) errors.Error {
+	cmd, err := CreateProcess(pm.env).Spawn(entry.Alias, entry.Project, entry.Component, entry.Process)
 	if err != nil {
-		return false
+		return err
 	}
 
-	return true
+	entry.cmd       = cmd
+	entry.exited    = make(chan struct{})
+	entry.stopping  = false
+	entry.Pid       = cmd.Process.Pid
+	entry.State     = PROCESS_STATE_RUNNING
+	entry.StartedAt = time.Now()
+
+	go pm.supervise(entry, cmd)
+
+	return nil
+}
+
+/**
+ * ProcManager.supervise(*ProcessEntry, *exec.Cmd)
+ *
+ * Waits for process to exit and decides what comes next.
+ */
+func (pm *ProcManager) supervise(entry *ProcessEntry, cmd *exec.Cmd) {
+	cmd.Wait()
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	entry.ExitCode = cmd.ProcessState.ExitCode()
+	entry.Pid      = 0
+	entry.cmd      = nil
+	close(entry.exited)
+
+	switch {
+		case pm.closing:
+		case entry.stopping:
+			entry.State = PROCESS_STATE_STOPPED
+		case pm.shouldRestart(entry):
+			entry.State = PROCESS_STATE_RESTARTING
+			pm.scheduleRestart(entry)
+		case entry.ExitCode == 0:
+			entry.State = PROCESS_STATE_EXITED
+		default:
+			entry.State = PROCESS_STATE_FAILED
+	}
+
+	if pm.procs[entry.Alias] == entry {
+		pm.persist()
+	}
 }
 
 /**
- * ProcManager.CleanAfterProcess(string) bool
+ * ProcManager.shouldRestart(*ProcessEntry) bool
  */
-func (pm *ProcManager) CleanAfterProcess(alias string) bool {
-	st := pm.storage
+func (pm *ProcManager) shouldRestart(entry *ProcessEntry) bool {
+	switch pm.restart {
+		case RESTART_ALWAYS:
+			return true
+		case RESTART_ON_FAILURE:
+			return entry.ExitCode != 0
+		default:
+			return false
+	}
+}
 
-	st.Open()
+/**
+ * ProcManager.scheduleRestart(*ProcessEntry)
+ *
+ * Restarts process after delay doubled with every failure in a row. Process which has been running long enough
+ * starts from the shortest delay again. Must be called with manager lock held.
+ */
+func (pm *ProcManager) scheduleRestart(entry *ProcessEntry) {
+	if time.Since(entry.StartedAt) >= RESTART_RESET_AFTER {
+		entry.failures = 0
+	}
 
-	record := storage.CreateDataRecord()
-	record.Set("alias", alias)
+	delay := RESTART_DELAY_MAX
+	if entry.failures < 5 {
+		delay = RESTART_DELAY << entry.failures
+	}
+	if delay > RESTART_DELAY_MAX {
+		delay = RESTART_DELAY_MAX
+	}
+	entry.failures++
 
-	_, err := st.Remove(record)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		pm.lock.Lock()
+		defer pm.lock.Unlock()
 
-	st.Close()
+		if entry.timer != timer || pm.closing {
+			return
+		}
+		entry.timer = nil
+		entry.Restarts++
 
-	if err != nil {
+		if err := pm.spawn(entry); err != nil {
+			entry.State = PROCESS_STATE_FAILED
+		}
+		pm.persist()
+	})
+	entry.timer = timer
+}
+
+/**
+ * ProcManager.cancelRestart(*ProcessEntry) bool
+ *
+ * Returns false when no restart has been pending. Must be called with manager lock held.
+ */
+func (pm *ProcManager) cancelRestart(entry *ProcessEntry) bool {
+	if entry.timer == nil {
 		return false
-	} else {
-		return true
 	}
+
+	entry.timer.Stop()
+	entry.timer = nil
+
+	return true
 }
 
 /**
- * ProcManager.GetPid(string) int
+ * ProcManager.stop(*ProcessEntry, bool)
+ *
+ * Must be called with manager lock held, which is released while waiting for process to exit. Callers have to check
+ * entry is still registered under its alias before touching registry again.
  */
-func (pm *ProcManager) GetPid(alias string) int {
-	st  := pm.storage
-	pid := 0
+func (pm *ProcManager) stop(entry *ProcessEntry, force bool) {
+	if pm.cancelRestart(entry) {
+		entry.State = PROCESS_STATE_STOPPED
+	}
+
+	if entry.cmd == nil {
+		return
+	}
 
-	st.Open()
+	entry.stopping = true
+	process, exited := entry.cmd.Process, entry.exited
 
-	record := storage.CreateDataRecord()
-	record.Set("alias", alias)
+	timeout := pm.stopTimeout
+	if force {
+		timeout = 0
+	}
 
-	res, err := st.Get(record)
+	pm.lock.Unlock()
+	terminate(process, exited, timeout)
+	pm.lock.Lock()
+}
 
-	st.Close()
+/**
+ * ProcManager.persist() errors.Error
+ *
+ * Must be called with manager lock held.
+ */
+func (pm *ProcManager) persist() errors.Error {
+	records := []*storage.DataRecord{}
+	for _, alias := range pm.aliases() {
+		records = append(records, pm.procs[alias].ToRecord())
+	}
 
-	if err != nil {
-		return 0
+	if _, err := pm.storage.Open(); err != nil {
+		return err
+	}
+	defer pm.storage.Close()
+
+	if _, err := pm.storage.RemoveAll(); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	_, err := pm.storage.AddSeveral(records)
+
+	return err
+}
+
+/**
+ * ProcManager.aliases() []string
+ */
+func (pm *ProcManager) aliases() []string {
+	aliases := []string{}
+	for alias := range pm.procs {
+		aliases = append(aliases, alias)
 	}
-	if len(res) > 0 {
-		pid, _ = strconv.Atoi(res[0].Get("pid"))
+	sort.Strings(aliases)
+
+	return aliases
+}
+
+/**
+ * terminate(*os.Process, chan struct{}, time.Duration)
+ *
+ * Interrupts wrapper, which passes interrupt to its process and waits for it, and kills whole process group when it
+ * has not exited within timeout. Where interrupt cannot be delivered, such as on Windows, process is killed right away.
+ */
+func terminate(process *os.Process, exited chan struct{}, timeout time.Duration) {
+	if timeout <= 0 || process.Signal(os.Interrupt) != nil {
+		killProcessGroup(process)
 	}
 
-	return pid
+	select {
+		case <-exited:
+		case <-time.After(timeout):
+			killProcessGroup(process)
+			<-exited
+	}
 }
 
 /**
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"os"
+	"time"
+	"os/exec"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"../json"
+	"../storage"
+	"../errors"
+)
+
+// memoryStorage keeps registry in memory, so tests do not touch data directory
+type memoryStorage struct {
+	records		[]*storage.DataRecord
+}
+
+func (s *memoryStorage) Open() (bool, errors.Error)		{ return true, nil }
+func (s *memoryStorage) Close() (bool, errors.Error)	{ return true, nil }
+func (s *memoryStorage) Add(r *storage.DataRecord) (bool, errors.Error) {
+	s.records = append(s.records, r)
+	return true, nil
+}
+func (s *memoryStorage) AddSeveral(r []*storage.DataRecord) (bool, errors.Error) {
+	s.records = append(s.records, r...)
+	return true, nil
+}
+func (s *memoryStorage) Remove(*storage.DataRecord) (bool, errors.Error)				{ return false, nil }
+func (s *memoryStorage) RemoveSeveral([]*storage.DataRecord) (bool, errors.Error)		{ return false, nil }
+func (s *memoryStorage) RemoveAll() (bool, errors.Error) {
+	s.records = nil
+	return true, nil
+}
+func (s *memoryStorage) Get(*storage.DataRecord) ([]*storage.DataRecord, errors.Error)			{ return nil, nil }
+func (s *memoryStorage) GetSeveral([]*storage.DataRecord) ([]*storage.DataRecord, errors.Error)	{ return nil, nil }
+func (s *memoryStorage) GetAll() ([]*storage.DataRecord, errors.Error)							{ return s.records, nil }
+func (s *memoryStorage) Exclude(*storage.DataRecord) ([]*storage.DataRecord, errors.Error)		{ return nil, nil }
+func (s *memoryStorage) ExcludeSeveral([]*storage.DataRecord) ([]*storage.DataRecord, errors.Error) { return nil, nil }
+func (s *memoryStorage) Erase() (bool, errors.Error)											{ return true, nil }
+
+// fakeWrapper stands in for wrapper, it runs until interrupted unless process name tells it to crash or exit
+const fakeWrapper = `case "$4" in
+	crash) exit 3 ;;
+	exit) exit 0 ;;
+	stubborn) trap '' INT; while true; do sleep 1; done ;;
+	*) exec sleep 30 ;;
+esac
+`
+
+// createTestManager returns manager spawning fake wrapper with logs captured in temporary directory
+func createTestManager(t *testing.T) *ProcManager {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "kraken-test")
+	if err != nil {
+		t.Fatalf("temp dir: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	script := filepath.Join(dir, "wrapper.sh")
+	ioutil.WriteFile(script, []byte(fakeWrapper), 0644)
+
+	config := json.New()
+	config.SetPath([]string{"env", "exe"}, "sh " + script)
+	config.SetPath([]string{"logs", "enabled"}, false)
+	config.SetPath([]string{"logs", "dir"}, filepath.Join(dir, "logs"))
+	config.SetPath([]string{"control", "dir"}, filepath.Join(dir, "control"))
+
+	pm := CreateProcManager(&Environment{Config: config})
+	pm.storage     = &memoryStorage{}
+	pm.stopTimeout = 2 * time.Second
+
+	t.Cleanup(pm.Shutdown)
+
+	return pm
+}
+
+// waitState waits for process to reach given state
+func waitState(t *testing.T, pm *ProcManager, alias string, state string, within time.Duration) *ProcessEntry {
+	deadline := time.Now().Add(within)
+
+	for {
+		entry := pm.GetProcess(alias)
+		if entry != nil && entry.State == state {
+			return entry
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process %s has not reached state %s, it is %+v", alias, state, entry)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCreateProcess(t *testing.T) {
+	pm := createTestManager(t)
+
+	pid, err := pm.CreateProcess("app", "project", "component", "sleep", false)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	if pid == 0 || pm.GetPid("app") != pid {
+		t.Errorf("unexpected pid %d", pid)
+	}
+	waitState(t, pm, "app", PROCESS_STATE_RUNNING, time.Second)
+
+	if _, err := pm.CreateProcess("app", "project", "component", "sleep", false); err == nil || err.GetCode() != PROCESS_ERR_EXISTS {
+		t.Errorf("duplicate create returned %v", err)
+	}
+
+	// forced create replaces running process
+	replaced, err := pm.CreateProcess("app", "project", "component", "sleep", true)
+	if err != nil {
+		t.Fatalf("forced create: %s", err.GetMessage())
+	}
+	if replaced == pid {
+		t.Errorf("process has not been replaced")
+	}
+	if len(pm.GetProcesses()) != 1 {
+		t.Errorf("registry holds %d processes", len(pm.GetProcesses()))
+	}
+
+	records, _ := pm.storage.GetAll()
+	if len(records) != 1 {
+		t.Errorf("registry has not been persisted, %d records", len(records))
+	}
+}
+
+func TestStartStopRestartProcess(t *testing.T) {
+	pm := createTestManager(t)
+
+	if _, err := pm.CreateProcess("app", "project", "component", "sleep", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+
+	if _, err := pm.StartProcess("app"); err == nil || err.GetCode() != PROCESS_ERR_RUNNING {
+		t.Errorf("start of running process returned %v", err)
+	}
+
+	if err := pm.StopProcess("app"); err != nil {
+		t.Fatalf("stop: %s", err.GetMessage())
+	}
+	if entry := waitState(t, pm, "app", PROCESS_STATE_STOPPED, time.Second); entry.Pid != 0 {
+		t.Errorf("stopped process kept pid %d", entry.Pid)
+	}
+	if err := pm.StopProcess("app"); err == nil || err.GetCode() != PROCESS_ERR_NOT_RUNNING {
+		t.Errorf("stop of stopped process returned %v", err)
+	}
+
+	pid, err := pm.StartProcess("app")
+	if err != nil {
+		t.Fatalf("start: %s", err.GetMessage())
+	}
+	waitState(t, pm, "app", PROCESS_STATE_RUNNING, time.Second)
+
+	restarted, err := pm.RestartProcess("app")
+	if err != nil {
+		t.Fatalf("restart: %s", err.GetMessage())
+	}
+	if restarted == pid {
+		t.Errorf("process has not been restarted")
+	}
+	waitState(t, pm, "app", PROCESS_STATE_RUNNING, time.Second)
+
+	if _, err := pm.StartProcess("missing"); err == nil || err.GetCode() != PROCESS_ERR_NOT_FOUND {
+		t.Errorf("start of unknown process returned %v", err)
+	}
+}
+
+func TestCrashedProcessIsRestarted(t *testing.T) {
+	pm := createTestManager(t)
+	pm.restart = RESTART_ON_FAILURE
+
+	if _, err := pm.CreateProcess("crash", "project", "component", "crash", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	if _, err := pm.CreateProcess("exit", "project", "component", "exit", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+
+	entry := waitState(t, pm, "crash", PROCESS_STATE_RESTARTING, time.Second)
+	if entry.ExitCode != 3 {
+		t.Errorf("unexpected exit code %d", entry.ExitCode)
+	}
+
+	deadline := time.Now().Add(3 * RESTART_DELAY)
+	for pm.GetProcess("crash").Restarts == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("crashed process has not been restarted")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// clean exit is not a failure
+	waitState(t, pm, "exit", PROCESS_STATE_EXITED, time.Second)
+
+	// stopping cancels pending restart
+	waitState(t, pm, "crash", PROCESS_STATE_RESTARTING, time.Second)
+	if err := pm.StopProcess("crash"); err != nil {
+		t.Fatalf("stop: %s", err.GetMessage())
+	}
+	restarts := pm.GetProcess("crash").Restarts
+	time.Sleep(RESTART_DELAY + 200 * time.Millisecond)
+	if entry := pm.GetProcess("crash"); entry.State != PROCESS_STATE_STOPPED || entry.Restarts != restarts {
+		t.Errorf("stopped process has been restarted, %+v", entry)
+	}
+}
+
+func TestDestroyRunningProcess(t *testing.T) {
+	pm := createTestManager(t)
+	pm.stopTimeout = 300 * time.Millisecond
+
+	if _, err := pm.CreateProcess("app", "project", "component", "stubborn", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	waitState(t, pm, "app", PROCESS_STATE_RUNNING, time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	// process ignoring interrupt is killed once stop timeout passes
+	start := time.Now()
+	if err := pm.DestroyProcess("app", false); err != nil {
+		t.Fatalf("destroy: %s", err.GetMessage())
+	}
+	if elapsed := time.Since(start); elapsed < pm.stopTimeout || elapsed > pm.stopTimeout + time.Second {
+		t.Errorf("destroy took %s", elapsed)
+	}
+	if pm.ExistsProcess("app") {
+		t.Errorf("destroyed process is still registered")
+	}
+
+	// forced destroy does not wait
+	if _, err := pm.CreateProcess("app", "project", "component", "stubborn", false); err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start = time.Now()
+	if err := pm.DestroyProcess("app", true); err != nil {
+		t.Fatalf("forced destroy: %s", err.GetMessage())
+	}
+	if elapsed := time.Since(start); elapsed >= pm.stopTimeout {
+		t.Errorf("forced destroy took %s", elapsed)
+	}
+
+	if err := pm.DestroyProcess("app", false); err == nil || err.GetCode() != PROCESS_ERR_NOT_FOUND {
+		t.Errorf("destroy of unknown process returned %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 	"./tcp"
+	"./internal"
 	"./storage"
 	"./errors"
 )
@@ -16,6 +17,12 @@ func main() {
 		fmt.Printf("%s\n", message.GetRecord().Get(tcp.MESSAGE_TEXT))
 	})
 
+	if env := internal.CreateEnvironment(); env != nil {
+		if auth, ok := env.GetConfig().CheckGet("auth"); ok {
+			sock.Config.Auth = tcp.LoadSocketAuthConfig(auth)
+		}
+	}
+
 	err := sock.Connect("127.0.0.1", "9080")
 	errors.Log(err)
 
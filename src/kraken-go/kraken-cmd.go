@@ -4,7 +4,7 @@ import (
 	"os"
 //	"fmt"
 	"./cli"
-//	"./errors"
+	"./errors"
 	"./internal"
 //	"./storage"
 //	"./lock"
@@ -77,10 +77,12 @@ func main() {
 	// parse commandLine arguments into Command object
 	command := cli.CreateCommand(env, os.Args[1:])
 
-	// execute command && check results
-	if command == nil || command.Execute() != nil {
+	if command == nil {
 		os.Exit(1)
 	}
 
+	// execute command, commands are carried out by kraken daemon
+	errors.Log(command.Execute())
+
 	os.Exit(0)
 }
@@ -2,29 +2,34 @@ package main
 
 import (
 	"os"
-//	"io"
-//	"bytes"
 	"fmt"
 	"./errors"
+	"./internal"
 )
 
+/**
+ * kraken-killer alias [signal]
+ *
+ * Sends signal to process running under given alias through control socket of its wrapper, SIGTERM by default.
+ */
 func main() {
-
-	process, err := os.FindProcess(4432)
-	if err != nil {
-		errors.Log(errors.New(21, err.Error()))
+	if len(os.Args) < 2 {
+		fmt.Printf("usage: %s alias [signal]\n", os.Args[0])
+		os.Exit(1)
 	}
 
-	fmt.Printf("%#v\n", process.Stdin)
+	signal := "SIGTERM"
+	if len(os.Args) > 2 {
+		signal = os.Args[2]
+	}
 
-//	stdin, err := process.StdinPipe()
-//	if err != nil {
-//		errors.Log(errors.New(22, err.Error()))
-//	}
+	env := internal.CreateEnvironment()
 
-//	io.CopyN(stdin, bytes.NewBufferString("woah!\n"), 4096)
+	client, err := internal.ConnectWrapper(env, os.Args[1])
+	errors.Log(err)
+	defer client.Close()
 
-//	process.Kill()
+	errors.Log(client.Signal(signal))
 
 	os.Exit(0)
 }
@@ -2,23 +2,38 @@ package main
 
 import (
 	"os"
-	"fmt"
-	"./tcp"
+	"time"
+	"context"
+	"syscall"
+	"os/signal"
+	"./internal"
 	"./errors"
 )
 
 func main() {
-	sock := tcp.CreateSocket()
+	// prepare environment
+	env := internal.CreateEnvironment()
+	if env == nil {
+		os.Exit(1)
+	}
 
-	sock.OnMessage(func(client *tcp.SocketClient, message *tcp.SocketMessage) {
-		fmt.Printf("%s\n", message.GetRecord().Get(tcp.MESSAGE_TEXT))
-	})
+	// daemon owns the process registry and supervises processes in it
+	daemon := internal.CreateDaemon(env)
+	if daemon == nil {
+		errors.Log(errors.New(26, "Process manager couldnt been initalized."))
+	}
 
-	err := sock.Listen("127.0.0.1", "9080")
+	err := daemon.Start()
 	errors.Log(err)
 
-	sock.Lock()
-	sock.Close()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+	err = daemon.Shutdown(ctx)
+	cancel()
+	errors.Log(err)
 
 	os.Exit(0)
 }
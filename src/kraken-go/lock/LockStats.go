@@ -0,0 +1,37 @@
+package lock
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * LockWaitStats class
+ *
+ * Totals of time spent waiting for file locks by this process.
+ */
+type LockWaitStats struct {
+	Count		uint64
+	Seconds		float64
+}
+
+var waitLock sync.Mutex
+var waitStats LockWaitStats
+
+/**
+ * GetWaitStats() LockWaitStats
+ */
+func GetWaitStats() LockWaitStats {
+	waitLock.Lock()
+	defer waitLock.Unlock()
+
+	return waitStats
+}
+
+func observeWait(since time.Time) {
+	waitLock.Lock()
+	defer waitLock.Unlock()
+
+	waitStats.Count++
+	waitStats.Seconds += time.Since(since).Seconds()
+}
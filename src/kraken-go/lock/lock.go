@@ -39,6 +39,8 @@ func (lock *FileLock) Lock() errors.Error {
 	var fp *os.File
 	var err error
 
+	defer observeWait(time.Now())
+
 	for {
 		if _, err := os.Stat(lock.filePath); os.IsNotExist(err) {
 			break
@@ -0,0 +1,138 @@
+package wrapper
+
+import (
+	"io"
+	"os"
+	"strings"
+	"path/filepath"
+	"../../tcp"
+	"../../storage"
+	"../../errors"
+)
+
+const (
+	ENV_CONTROL_DIR		string = "KRAKEN_CONTROL_DIR"
+	CONTROL_DIR			string = "../../data/run/"
+)
+
+const (
+	CONTROL_SEND		string = "SEND"
+	CONTROL_SIGNAL		string = "SIGNAL"
+)
+
+const (
+	WRAPPER_ERR_CONTROL	int = 43
+	WRAPPER_ERR_SIGNAL	int = 44
+)
+
+/**
+ * GetControlDir() string
+ *
+ * Directory of control sockets, passed by whoever started the wrapper through environment.
+ */
+func GetControlDir() string {
+	if dir := os.Getenv(ENV_CONTROL_DIR); dir != "" {
+		return dir
+	}
+
+	return CONTROL_DIR
+}
+
+/**
+ * GetControlPath(string, string) string
+ *
+ * Returns path of control socket of wrapper running given alias.
+ */
+func GetControlPath(dir string, alias string) string {
+	return filepath.Join(dir, alias + ".sock")
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * ProcessWrapper.Listen(string) errors.Error
+ *
+ * Starts control socket of the alias, which lets other processes write to stdin of wrapped process and send signals
+ * to it. Socket is unix one, readable only by the user running the wrapper.
+ */
+func (wrapper *ProcessWrapper) Listen(alias string) errors.Error {
+	dir := GetControlDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.New(WRAPPER_ERR_CONTROL, err.Error())
+	}
+
+	sock := tcp.CreateSocket()
+	sock.RegisterMethod(CONTROL_SEND, wrapper.handleSend)
+	sock.RegisterMethod(CONTROL_SIGNAL, wrapper.handleSignal)
+
+	if err := sock.ListenUnix(GetControlPath(dir, alias)); err != nil {
+		return errors.New(WRAPPER_ERR_CONTROL, err.GetMessage())
+	}
+
+	wrapper.lock.Lock()
+	wrapper.control = sock
+	wrapper.lock.Unlock()
+
+	return nil
+}
+
+/**
+ * ProcessWrapper.Send(string) errors.Error
+ *
+ * Writes text to stdin of wrapped process, newline is appended unless text already ends with one.
+ */
+func (wrapper *ProcessWrapper) Send(text string) errors.Error {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	wrapper.lock.Lock()
+	defer wrapper.lock.Unlock()
+
+	if wrapper.stdin == nil {
+		return errors.New(WRAPPER_ERR_CONTROL, "Process is not running.")
+	}
+	if _, err := io.WriteString(wrapper.stdin, text); err != nil {
+		return errors.New(WRAPPER_ERR_CONTROL, err.Error())
+	}
+
+	return nil
+}
+
+/**
+ * ProcessWrapper.Signal(string) errors.Error
+ *
+ * Sends signal given by name, like SIGUSR1 or USR1, or by number to wrapped process.
+ */
+func (wrapper *ProcessWrapper) Signal(name string) errors.Error {
+	sig, err := ParseSignal(name)
+	if err != nil {
+		return err
+	}
+
+	wrapper.lock.Lock()
+	process := wrapper.process
+	wrapper.lock.Unlock()
+
+	if process == nil {
+		return errors.New(WRAPPER_ERR_CONTROL, "Process is not running.")
+	}
+	if err := process.Signal(sig); err != nil {
+		return errors.New(WRAPPER_ERR_SIGNAL, err.Error())
+	}
+
+	return nil
+}
+
+/**
+ * ProcessWrapper.handleSend(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (wrapper *ProcessWrapper) handleSend(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	return nil, wrapper.Send(record.Get("text"))
+}
+
+/**
+ * ProcessWrapper.handleSignal(*tcp.SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (wrapper *ProcessWrapper) handleSignal(c *tcp.SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	return nil, wrapper.Signal(record.Get("signal"))
+}
@@ -0,0 +1,119 @@
+package wrapper
+
+import (
+	"os"
+	"time"
+	"bufio"
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"io/ioutil"
+	"../../tcp"
+	"../../storage"
+	"../../errors"
+)
+
+// startControlled starts command as wrapped process of wrapper listening on control socket of alias app
+func startControlled(t *testing.T, name string, args ...string) (*ProcessWrapper, *exec.Cmd, *bufio.Reader) {
+	dir, err := ioutil.TempDir("", "kraken-run")
+	if err != nil {
+		t.Fatalf("temp dir: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	t.Setenv(ENV_CONTROL_DIR, dir)
+
+	cmd := exec.Command(name, args...)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Skipf("%s cannot be started: %s", name, err)
+	}
+
+	wrapper := New()
+	wrapper.stdin   = stdin
+	wrapper.process = cmd.Process
+
+	if err := wrapper.Listen("app"); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	t.Cleanup(func() {
+		wrapper.closeControl()
+		wrapper.closeStdin()
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	return wrapper, cmd, bufio.NewReader(stdout)
+}
+
+func callControl(t *testing.T, method string, args map[string]string) errors.Error {
+	sock := tcp.CreateSocket()
+	if err := sock.ConnectUnix(GetControlPath(GetControlDir(), "app")); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer sock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	_, err := sock.Call(ctx, method, storage.CreateDataRecord().FromMap(args))
+
+	return err
+}
+
+func TestControlSocketSend(t *testing.T) {
+	wrapper, _, stdout := startControlled(t, "cat")
+
+	if info, err := os.Stat(GetControlPath(GetControlDir(), "app")); err != nil || info.Mode().Perm() & 0077 != 0 {
+		t.Errorf("control socket is accessible by others, %v", info.Mode())
+	}
+
+	if err := callControl(t, CONTROL_SEND, map[string]string{"text": "hello world"}); err != nil {
+		t.Fatalf("send: %s", err.GetMessage())
+	}
+	if err := callControl(t, CONTROL_SEND, map[string]string{"text": "second\n"}); err != nil {
+		t.Fatalf("send: %s", err.GetMessage())
+	}
+
+	for _, want := range []string{"hello world\n", "second\n"} {
+		if line, err := stdout.ReadString('\n'); err != nil || line != want {
+			t.Errorf("process read %q, want %q", line, want)
+		}
+	}
+
+	wrapper.closeStdin()
+	if err := callControl(t, CONTROL_SEND, map[string]string{"text": "late"}); err == nil || err.GetCode() != WRAPPER_ERR_CONTROL {
+		t.Errorf("send to finished process returned %v", err)
+	}
+}
+
+func TestControlSocketSignal(t *testing.T) {
+	_, cmd, _ := startControlled(t, "sleep", "30")
+
+	if err := callControl(t, CONTROL_SIGNAL, map[string]string{"signal": "bogus"}); err == nil || err.GetCode() != WRAPPER_ERR_SIGNAL {
+		t.Errorf("unknown signal returned %v", err)
+	}
+	if err := callControl(t, CONTROL_SIGNAL, map[string]string{"signal": "sigterm"}); err != nil {
+		t.Fatalf("signal: %s", err.GetMessage())
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+		case <-exited:
+			status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+			if !ok || !status.Signaled() || status.Signal() != syscall.SIGTERM {
+				t.Errorf("process exited with %v", cmd.ProcessState)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("process has not been signaled")
+	}
+}
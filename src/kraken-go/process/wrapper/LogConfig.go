@@ -0,0 +1,164 @@
+package wrapper
+
+import (
+	"os"
+	"time"
+	"strconv"
+	"path/filepath"
+)
+
+const (
+	ENV_LOG_ENABLED		string = "KRAKEN_LOG_ENABLED"
+	ENV_LOG_DIR			string = "KRAKEN_LOG_DIR"
+	ENV_LOG_MAX_SIZE	string = "KRAKEN_LOG_MAX_SIZE"
+	ENV_LOG_MAX_AGE		string = "KRAKEN_LOG_MAX_AGE"
+	ENV_LOG_RETAIN		string = "KRAKEN_LOG_RETAIN"
+	ENV_LOG_COMPRESS	string = "KRAKEN_LOG_COMPRESS"
+)
+
+const (
+	LOG_DIR				string = "../../data/logs/"
+	LOG_MAX_SIZE		int64 = 10 * 1024 * 1024
+	LOG_MAX_AGE			time.Duration = 24 * time.Hour
+	LOG_RETAIN			int = 5
+)
+
+const (
+	LOG_STREAM_STDOUT	string = "stdout"
+	LOG_STREAM_STDERR	string = "stderr"
+)
+
+/**
+ * LogConfig class
+ *
+ * Where and how output of wrapped process is captured. Files are rotated when they grow over MaxSize or get older
+ * than MaxAge, zero disables either check. Retain rotated files are kept, optionally gzipped.
+ */
+type LogConfig struct {
+	Enabled		bool
+	Dir			string
+	MaxSize		int64
+	MaxAge		time.Duration
+	Retain		int
+	Compress	bool
+}
+
+/**
+ * LogConfig constructor
+ */
+func CreateLogConfig() *LogConfig {
+	config := &LogConfig{}
+
+	config.Enabled  = true
+	config.Dir      = LOG_DIR
+	config.MaxSize  = LOG_MAX_SIZE
+	config.MaxAge   = LOG_MAX_AGE
+	config.Retain   = LOG_RETAIN
+	config.Compress = false
+
+	return config
+}
+
+/**
+ * LoadLogConfig() *LogConfig
+ *
+ * Reads configuration passed by whoever started the wrapper through environment, missing values are defaulted.
+ */
+func LoadLogConfig() *LogConfig {
+	config := CreateLogConfig()
+
+	if val := os.Getenv(ENV_LOG_ENABLED); val != "" {
+		config.Enabled = val == "1"
+	}
+	if val := os.Getenv(ENV_LOG_DIR); val != "" {
+		config.Dir = val
+	}
+	if val, err := strconv.ParseInt(os.Getenv(ENV_LOG_MAX_SIZE), 10, 64); err == nil && val >= 0 {
+		config.MaxSize = val
+	}
+	if val, err := strconv.ParseFloat(os.Getenv(ENV_LOG_MAX_AGE), 64); err == nil && val >= 0 {
+		config.MaxAge = time.Duration(val * float64(time.Second))
+	}
+	if val, err := strconv.Atoi(os.Getenv(ENV_LOG_RETAIN)); err == nil && val >= 0 {
+		config.Retain = val
+	}
+	if val := os.Getenv(ENV_LOG_COMPRESS); val != "" {
+		config.Compress = val == "1"
+	}
+
+	return config
+}
+
+/**
+ * LogConfig.ToEnv() []string
+ *
+ * Returns environment entries which make LoadLogConfig restore this configuration.
+ */
+func (config *LogConfig) ToEnv() []string {
+	env := []string{}
+	env = append(env, ENV_LOG_ENABLED + "=" + boolEnv(config.Enabled))
+	env = append(env, ENV_LOG_DIR + "=" + config.Dir)
+	env = append(env, ENV_LOG_MAX_SIZE + "=" + strconv.FormatInt(config.MaxSize, 10))
+	env = append(env, ENV_LOG_MAX_AGE + "=" + strconv.FormatFloat(config.MaxAge.Seconds(), 'f', -1, 64))
+	env = append(env, ENV_LOG_RETAIN + "=" + strconv.Itoa(config.Retain))
+	env = append(env, ENV_LOG_COMPRESS + "=" + boolEnv(config.Compress))
+
+	return env
+}
+
+/**
+ * LogConfig.GetLogPath(string, string) string
+ *
+ * Returns path of current log file of given stream of process.
+ */
+func (config *LogConfig) GetLogPath(alias string, stream string) string {
+	return filepath.Join(config.Dir, alias + "." + stream + ".log")
+}
+
+/**
+ * LogConfig.GetRotatedPath(string, string, int) string
+ *
+ * Returns path of n-th rotated log file, 1 being the newest one. Compressed files carry additional .gz suffix.
+ */
+func (config *LogConfig) GetRotatedPath(alias string, stream string, n int) string {
+	return config.GetLogPath(alias, stream) + "." + strconv.Itoa(n)
+}
+
+/**
+ * LogConfig.FindLogFiles(string, string) []string
+ *
+ * Returns existing log files of given stream of process ordered from the oldest one, the current file being the last.
+ * Rotated file is briefly present both plain and gzipped while being compressed, the complete gzipped one is returned
+ * then.
+ */
+func (config *LogConfig) FindLogFiles(alias string, stream string) []string {
+	files := []string{}
+
+	for n := config.Retain; n >= 1; n-- {
+		path := config.GetRotatedPath(alias, stream, n)
+		if fileExists(path + ".gz") {
+			files = append(files, path + ".gz")
+		} else if fileExists(path) {
+			files = append(files, path)
+		}
+	}
+
+	if path := config.GetLogPath(alias, stream); fileExists(path) {
+		files = append(files, path)
+	}
+
+	return files
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func boolEnv(val bool) string {
+	if val {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,327 @@
+package wrapper
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+	"path/filepath"
+	"compress/gzip"
+	"../../errors"
+)
+
+const (
+	WRAPPER_ERR_LOG		int = 42
+)
+
+/**
+ * LogFile class
+ *
+ * Log file of one output stream of wrapped process. Every line is stored behind RFC3339Nano timestamp of the moment it
+ * has been captured, so streams can be merged later. File is rotated by size and age on write, rotated file is
+ * compressed in background so writing process is not held up.
+ */
+type LogFile struct {
+	Alias		string
+	Stream		string
+	config		*LogConfig
+	lock		sync.Mutex
+	file		*os.File
+	size		int64
+	opened		time.Time
+	compressing	sync.WaitGroup
+	jobs		[]*logCompression
+}
+
+/**
+ * logCompression class
+ *
+ * Rotated file being compressed. Rotation updates path when it shifts the file and clears it when the file is dropped.
+ */
+type logCompression struct {
+	path		string
+}
+
+/**
+ * LogFile constructor
+ */
+func CreateLogFile(config *LogConfig, alias string, stream string) (*LogFile, errors.Error) {
+	log := &LogFile{}
+
+	log.Alias  = alias
+	log.Stream = stream
+	log.config = config
+	log.file   = nil
+	log.size   = 0
+	log.jobs   = []*logCompression{}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+	if err := log.open(); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+/**
+ * LogFile.WriteLine([]byte) errors.Error
+ */
+func (log *LogFile) WriteLine(line []byte) errors.Error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if log.file == nil {
+		return errors.New(WRAPPER_ERR_LOG, "Log file has been closed.")
+	}
+
+	data := make([]byte, 0, len(line) + 40)
+	data = append(data, time.Now().UTC().Format(time.RFC3339Nano)...)
+	data = append(data, ' ')
+	data = append(data, line...)
+	data = append(data, '\n')
+
+	if log.shouldRotate(len(data)) {
+		if err := log.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := log.file.Write(data)
+	log.size += int64(n)
+	if err != nil {
+		return errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	return nil
+}
+
+/**
+ * LogFile.Reopen() errors.Error
+ *
+ * Closes and opens file again, used after log file has been moved away by external tool like logrotate.
+ */
+func (log *LogFile) Reopen() errors.Error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if log.file == nil {
+		return nil
+	}
+
+	log.file.Close()
+	log.file = nil
+
+	return log.open()
+}
+
+/**
+ * LogFile.Close() errors.Error
+ *
+ * Waits for running compressions, which need log lock to finish, so it is not held meanwhile.
+ */
+func (log *LogFile) Close() errors.Error {
+	log.lock.Lock()
+	file := log.file
+	log.file = nil
+	log.lock.Unlock()
+
+	log.compressing.Wait()
+
+	if file == nil {
+		return nil
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * LogFile.open() errors.Error
+ *
+ * Must be called with log lock held.
+ */
+func (log *LogFile) open() errors.Error {
+	file, err := os.OpenFile(log.config.GetLogPath(log.Alias, log.Stream), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	log.file   = file
+	log.size   = info.Size()
+	log.opened = time.Now()
+
+	return nil
+}
+
+/**
+ * LogFile.shouldRotate(int) bool
+ */
+func (log *LogFile) shouldRotate(next int) bool {
+	if log.size == 0 {
+		return false
+	}
+
+	if log.config.MaxSize > 0 && log.size + int64(next) > log.config.MaxSize {
+		return true
+	}
+	if log.config.MaxAge > 0 && time.Since(log.opened) >= log.config.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+/**
+ * LogFile.rotate() errors.Error
+ *
+ * Shifts rotated files by one, dropping the oldest one over retention, and starts new current file. Must be called
+ * with log lock held. Compressions still running are told where their files have been moved.
+ */
+func (log *LogFile) rotate() errors.Error {
+	log.file.Close()
+	log.file = nil
+
+	path := log.config.GetLogPath(log.Alias, log.Stream)
+	retain := log.config.Retain
+
+	if retain == 0 {
+		os.Remove(path)
+		return log.open()
+	}
+
+	last := log.config.GetRotatedPath(log.Alias, log.Stream, retain)
+	os.Remove(last)
+	os.Remove(last + ".gz")
+	log.retarget(last, "")
+
+	for n := retain - 1; n >= 1; n-- {
+		from := log.config.GetRotatedPath(log.Alias, log.Stream, n)
+		to := log.config.GetRotatedPath(log.Alias, log.Stream, n + 1)
+		for _, suffix := range []string{"", ".gz"} {
+			if fileExists(from + suffix) {
+				os.Rename(from + suffix, to + suffix)
+			}
+		}
+		log.retarget(from, to)
+	}
+
+	// current file is kept when it cannot be moved away, so that output is not lost
+	rotated := log.config.GetRotatedPath(log.Alias, log.Stream, 1)
+	if err := os.Rename(path, rotated); err != nil {
+		log.open()
+		return errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	if err := log.open(); err != nil {
+		return err
+	}
+
+	if log.config.Compress {
+		job := &logCompression{path: rotated}
+		log.jobs = append(log.jobs, job)
+
+		log.compressing.Add(1)
+		go log.compress(job)
+	}
+
+	return nil
+}
+
+/**
+ * LogFile.retarget(string, string)
+ *
+ * Must be called with log lock held.
+ */
+func (log *LogFile) retarget(from string, to string) {
+	for _, job := range log.jobs {
+		if job.path == from {
+			job.path = to
+		}
+	}
+}
+
+/**
+ * LogFile.compress(*logCompression)
+ *
+ * Replaces rotated file with its gzipped copy. Copy is written under temporary name without log lock, so writing is
+ * not held up, and renamed to .gz under the lock, so that rotation cannot shift the file meanwhile. Source is removed
+ * only afterwards, so readers always find complete content in one of them.
+ */
+func (log *LogFile) compress(job *logCompression) {
+	defer log.compressing.Done()
+
+	log.lock.Lock()
+	src, err := os.Open(job.path)
+	log.lock.Unlock()
+
+	tmp := ""
+	if err == nil {
+		tmp, _ = compressFile(src)
+		src.Close()
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	for i, pending := range log.jobs {
+		if pending == job {
+			log.jobs = append(log.jobs[:i], log.jobs[i+1:]...)
+			break
+		}
+	}
+
+	if tmp == "" {
+		return
+	}
+	if job.path == "" {
+		os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, job.path + ".gz"); err != nil {
+		os.Remove(tmp)
+		return
+	}
+
+	os.Remove(job.path)
+}
+
+/**
+ * compressFile(*os.File) (string, errors.Error)
+ *
+ * Writes gzipped copy of file to temporary file next to it and returns its path. Temporary name does not match any
+ * log file, so it is never read half written.
+ */
+func compressFile(src *os.File) (string, errors.Error) {
+	dst, err := os.CreateTemp(filepath.Dir(src.Name()), filepath.Base(src.Name()) + ".*.tmp")
+	if err != nil {
+		return "", errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", errors.New(WRAPPER_ERR_LOG, err.Error())
+	}
+
+	return dst.Name(), nil
+}
@@ -0,0 +1,194 @@
+package wrapper
+
+import (
+	"os"
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"compress/gzip"
+)
+
+func createTestLogConfig(t *testing.T) *LogConfig {
+	dir, err := ioutil.TempDir("", "kraken-logs")
+	if err != nil {
+		t.Fatalf("temp dir: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	config := CreateLogConfig()
+	config.Dir     = dir
+	config.MaxAge  = 0
+	config.MaxSize = 200
+	config.Retain  = 3
+
+	return config
+}
+
+// readTestLines returns text of lines stored in plain or gzipped log file
+func readTestLines(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %s", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("gzip %s: %s", path, err)
+		}
+		reader = bufio.NewReader(zr)
+	}
+
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return lines
+		}
+		line = strings.TrimSuffix(line, "\n")
+		lines = append(lines, line[strings.IndexByte(line, ' ') + 1:])
+	}
+}
+
+func writeTestLines(t *testing.T, log *LogFile, from int, to int) {
+	for i := from; i < to; i++ {
+		if err := log.WriteLine([]byte("line " + strconv.Itoa(i))); err != nil {
+			t.Fatalf("write: %s", err.GetMessage())
+		}
+	}
+}
+
+func TestLogFileRotatesBySize(t *testing.T) {
+	config := createTestLogConfig(t)
+
+	log, err := CreateLogFile(config, "app", LOG_STREAM_STDOUT)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	writeTestLines(t, log, 0, 20)
+	log.Close()
+
+	files := config.FindLogFiles("app", LOG_STREAM_STDOUT)
+	if len(files) != config.Retain + 1 {
+		t.Fatalf("unexpected files %v", files)
+	}
+
+	// files hold consecutive lines from the oldest one, lines over retention are dropped
+	lines := []string{}
+	for _, file := range files {
+		if info, _ := os.Stat(file); info.Size() > config.MaxSize {
+			t.Errorf("%s has grown to %d bytes", file, info.Size())
+		}
+		lines = append(lines, readTestLines(t, file)...)
+	}
+	if len(lines) == 0 || lines[len(lines) - 1] != "line 19" {
+		t.Fatalf("unexpected lines %v", lines)
+	}
+
+	first, _ := strconv.Atoi(strings.TrimPrefix(lines[0], "line "))
+	for i, line := range lines {
+		if line != "line " + strconv.Itoa(first + i) {
+			t.Fatalf("line %d is %q", first + i, line)
+		}
+	}
+	if fileExists(config.GetRotatedPath("app", LOG_STREAM_STDOUT, config.Retain + 1)) {
+		t.Errorf("file over retention has been kept")
+	}
+}
+
+func TestLogFileWithoutRetention(t *testing.T) {
+	config := createTestLogConfig(t)
+	config.Retain = 0
+
+	log, err := CreateLogFile(config, "app", LOG_STREAM_STDERR)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	writeTestLines(t, log, 0, 20)
+	log.Close()
+
+	if files := config.FindLogFiles("app", LOG_STREAM_STDERR); len(files) != 1 {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestLogFileCompressesRotatedFiles(t *testing.T) {
+	config := createTestLogConfig(t)
+	config.Compress = true
+	config.Retain   = 100
+
+	log, err := CreateLogFile(config, "app", LOG_STREAM_STDOUT)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+
+	// rotations follow each other faster than compression, files are moved while being compressed
+	writeTestLines(t, log, 0, 500)
+	log.Close()
+
+	files := config.FindLogFiles("app", LOG_STREAM_STDOUT)
+	lines := []string{}
+	for i, file := range files {
+		if i < len(files) - 1 && !strings.HasSuffix(file, ".gz") {
+			t.Errorf("rotated file %s has not been compressed", file)
+		}
+		lines = append(lines, readTestLines(t, file)...)
+	}
+
+	if len(lines) != 500 {
+		t.Fatalf("%d lines are left of 500", len(lines))
+	}
+	for i, line := range lines {
+		if line != "line " + strconv.Itoa(i) {
+			t.Fatalf("line %d is %q", i, line)
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(config.Dir, "*.tmp"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files have been left %v", leftovers)
+	}
+}
+
+func TestFindLogFilesSkipsFileBeingCompressed(t *testing.T) {
+	config := createTestLogConfig(t)
+
+	rotated := config.GetRotatedPath("app", LOG_STREAM_STDOUT, 1)
+	for _, path := range []string{config.GetLogPath("app", LOG_STREAM_STDOUT), rotated, rotated + ".gz"} {
+		ioutil.WriteFile(path, []byte{}, 0644)
+	}
+
+	files := config.FindLogFiles("app", LOG_STREAM_STDOUT)
+	if len(files) != 2 || files[0] != rotated + ".gz" {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestLogFileDropsFilesBeingCompressed(t *testing.T) {
+	config := createTestLogConfig(t)
+	config.Compress = true
+	config.Retain   = 2
+
+	log, err := CreateLogFile(config, "app", LOG_STREAM_STDOUT)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+	writeTestLines(t, log, 0, 500)
+	log.Close()
+
+	entries, _ := ioutil.ReadDir(config.Dir)
+	if len(entries) != config.Retain + 1 {
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("unexpected files %v", names)
+	}
+}
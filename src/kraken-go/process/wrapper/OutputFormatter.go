@@ -0,0 +1,116 @@
+package wrapper
+
+import (
+	"os"
+	"time"
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	ENV_OUTPUT			string = "KRAKEN_OUTPUT"
+)
+
+const (
+	OUTPUT_RAW			string = "raw"
+	OUTPUT_TEXT			string = "text"
+	OUTPUT_JSON			string = "json"
+)
+
+/**
+ * OutputFormatter class
+ *
+ * Formats lines of wrapped process before they are re-emitted by wrapper. Raw mode passes lines unchanged, text mode
+ * prefixes them with RFC3339Nano timestamp, alias and stream, and json mode emits {"ts","alias","stream","line"}
+ * objects. Lines which are JSON objects themselves get the missing fields merged in instead of being encoded again.
+ */
+type OutputFormatter struct {
+	Mode		string
+	Alias		string
+}
+
+/**
+ * OutputFormatter constructor
+ */
+func CreateOutputFormatter(mode string, alias string) *OutputFormatter {
+	formatter := &OutputFormatter{}
+
+	formatter.Mode  = mode
+	formatter.Alias = alias
+
+	if mode != OUTPUT_TEXT && mode != OUTPUT_JSON {
+		formatter.Mode = OUTPUT_RAW
+	}
+
+	return formatter
+}
+
+/**
+ * LoadOutputFormatter(string) *OutputFormatter
+ *
+ * Mode is passed by whoever started the wrapper through environment.
+ */
+func LoadOutputFormatter(alias string) *OutputFormatter {
+	return CreateOutputFormatter(os.Getenv(ENV_OUTPUT), alias)
+}
+
+/**
+ * OutputFormatter.Format(string, []byte) []byte
+ *
+ * Takes line as read from process, including its newline if there is one. Raw mode returns it untouched, so output is
+ * passed on byte for byte, other modes always terminate it with newline.
+ */
+func (formatter *OutputFormatter) Format(stream string, line []byte) []byte {
+	if formatter.Mode == OUTPUT_RAW {
+		return line
+	}
+
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+
+	if formatter.Mode == OUTPUT_JSON {
+		return append(formatter.formatJson(stream, line), '\n')
+	}
+
+	prefix := time.Now().UTC().Format(time.RFC3339Nano) + " " + formatter.Alias + " " + stream + " "
+	return append(append([]byte(prefix), line...), '\n')
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * OutputFormatter.formatJson(string, []byte) []byte
+ */
+func (formatter *OutputFormatter) formatJson(stream string, line []byte) []byte {
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+
+	// object is extended in place, so that its own fields and formatting are kept as they are
+	trimmed := bytes.TrimSpace(line)
+	var fields map[string]json.RawMessage
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Unmarshal(trimmed, &fields) == nil {
+		head := []byte{'{'}
+		for _, field := range [][2]string{{"ts", ts}, {"alias", formatter.Alias}, {"stream", stream}} {
+			if _, ok := fields[field[0]]; ok {
+				continue
+			}
+			key, _ := json.Marshal(field[0])
+			val, _ := json.Marshal(field[1])
+			head = append(append(append(append(head, key...), ':'), val...), ',')
+		}
+
+		body := bytes.TrimSpace(trimmed[1:])
+		if len(fields) == 0 {
+			// empty object, no separator may follow the last added field
+			head = bytes.TrimSuffix(head, []byte{','})
+		}
+
+		return append(head, body...)
+	}
+
+	data, _ := json.Marshal(struct {
+		Ts			string	`json:"ts"`
+		Alias		string	`json:"alias"`
+		Stream		string	`json:"stream"`
+		Line		string	`json:"line"`
+	}{ts, formatter.Alias, stream, string(line)})
+
+	return data
+}
@@ -0,0 +1,85 @@
+package wrapper
+
+import (
+	"time"
+	"strings"
+	"testing"
+	"encoding/json"
+)
+
+func decodeOutput(t *testing.T, output []byte) map[string]interface{} {
+	if len(output) == 0 || output[len(output) - 1] != '\n' {
+		t.Fatalf("output %q is not terminated with newline", output)
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(output, &fields); err != nil {
+		t.Fatalf("output %q is not JSON object: %s", output, err)
+	}
+
+	return fields
+}
+
+func TestOutputFormatterJsonMerge(t *testing.T) {
+	formatter := CreateOutputFormatter(OUTPUT_JSON, "app")
+
+	cases := []struct {
+		line		string
+		want		map[string]interface{}
+	}{
+		// plain line is wrapped
+		{"hello \"world\"\r\n", map[string]interface{}{"alias": "app", "stream": "stdout", "line": "hello \"world\""}},
+		// object gets missing fields merged in, its own fields win
+		{`{"level":"info","msg":"ok"}` + "\n", map[string]interface{}{"alias": "app", "stream": "stdout", "level": "info", "msg": "ok"}},
+		{`  {"alias":"own","n":1}  `, map[string]interface{}{"alias": "own", "stream": "stdout", "n": float64(1)}},
+		{`{}`, map[string]interface{}{"alias": "app", "stream": "stdout"}},
+		{`{ }`, map[string]interface{}{"alias": "app", "stream": "stdout"}},
+		// anything which is not an object is wrapped as line
+		{`{"broken":`, map[string]interface{}{"alias": "app", "stream": "stdout", "line": `{"broken":`}},
+		{`[1,2]`, map[string]interface{}{"alias": "app", "stream": "stdout", "line": `[1,2]`}},
+	}
+
+	for _, tc := range cases {
+		fields := decodeOutput(t, formatter.Format(LOG_STREAM_STDOUT, []byte(tc.line)))
+
+		ts, _ := fields["ts"].(string)
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			t.Errorf("%q: missing or invalid timestamp %v", tc.line, fields["ts"])
+		}
+		delete(fields, "ts")
+
+		if len(fields) != len(tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.line, fields, tc.want)
+			continue
+		}
+		for key, val := range tc.want {
+			if fields[key] != val {
+				t.Errorf("%q: field %s is %v, want %v", tc.line, key, fields[key], val)
+			}
+		}
+	}
+
+	// timestamp given by process is kept
+	fields := decodeOutput(t, formatter.Format(LOG_STREAM_STDERR, []byte(`{"ts":"yesterday"}`)))
+	if fields["ts"] != "yesterday" || fields["stream"] != "stderr" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestOutputFormatterModes(t *testing.T) {
+	raw := CreateOutputFormatter("unknown", "app")
+	if raw.Mode != OUTPUT_RAW {
+		t.Errorf("unknown mode has not fallen back to raw, got %s", raw.Mode)
+	}
+	if out := raw.Format(LOG_STREAM_STDOUT, []byte("partial")); string(out) != "partial" {
+		t.Errorf("raw mode changed line to %q", out)
+	}
+
+	text := CreateOutputFormatter(OUTPUT_TEXT, "app")
+	out := string(text.Format(LOG_STREAM_STDERR, []byte("failed\r\n")))
+
+	parts := strings.SplitN(out, " ", 2)
+	if _, err := time.Parse(time.RFC3339Nano, parts[0]); err != nil || len(parts) != 2 || parts[1] != "app stderr failed\n" {
+		t.Errorf("unexpected text line %q", out)
+	}
+}
@@ -0,0 +1,54 @@
+package wrapper
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"strconv"
+	"syscall"
+	"../../errors"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":		syscall.SIGHUP,
+	"INT":		syscall.SIGINT,
+	"QUIT":		syscall.SIGQUIT,
+	"KILL":		syscall.SIGKILL,
+	"USR1":		syscall.SIGUSR1,
+	"USR2":		syscall.SIGUSR2,
+	"TERM":		syscall.SIGTERM,
+	"CONT":		syscall.SIGCONT,
+	"STOP":		syscall.SIGSTOP,
+	"TSTP":		syscall.SIGTSTP,
+	"WINCH":	syscall.SIGWINCH,
+}
+
+/**
+ * ParseSignal(string) (os.Signal, errors.Error)
+ *
+ * Accepts names with or without SIG prefix in any case, and signal numbers.
+ */
+func ParseSignal(name string) (os.Signal, errors.Error) {
+	if num, err := strconv.Atoi(name); err == nil && num > 0 && num < 65 {
+		return syscall.Signal(num), nil
+	}
+
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+
+	return nil, errors.New(WRAPPER_ERR_SIGNAL, "Unknown signal " + name + ".")
+}
+
+/**
+ * setParentDeathSignal(*exec.Cmd)
+ *
+ * Makes kernel terminate process once wrapper dies, even when wrapper itself is killed and cannot pass signal on.
+ */
+func setParentDeathSignal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGTERM
+}
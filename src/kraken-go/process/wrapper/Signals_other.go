@@ -0,0 +1,33 @@
+// +build !linux
+
+package wrapper
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"../../errors"
+)
+
+/**
+ * ParseSignal(string) (os.Signal, errors.Error)
+ *
+ * Only interrupt and kill can be delivered on every platform.
+ */
+func ParseSignal(name string) (os.Signal, errors.Error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+		case "INT", "2":
+			return os.Interrupt, nil
+		case "KILL", "9":
+			return os.Kill, nil
+	}
+
+	return nil, errors.New(WRAPPER_ERR_SIGNAL, "Signal " + name + " is not supported on this platform.")
+}
+
+/**
+ * setParentDeathSignal(*exec.Cmd)
+ *
+ * Not available on this platform.
+ */
+func setParentDeathSignal(cmd *exec.Cmd) {}
@@ -5,18 +5,35 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"syscall"
 	"bufio"
 	"io"
+	"sync"
 	"bytes"
 	"strconv"
+	"../../tcp"
 	"../../storage"
 	"../../errors"
 )
 
+const (
+	ENV_SUPERVISED		string = "KRAKEN_SUPERVISED"
+)
+
+const (
+	PUMP_BUFFER			int = 64 * 1024
+	PUMP_MAX_LINE		int = 1024 * 1024
+)
+
 /**
  * ProcessWrapper class
  */
-type ProcessWrapper struct {}
+type ProcessWrapper struct {
+	lock		sync.Mutex
+	stdin		io.WriteCloser
+	process		*os.Process
+	control		*tcp.Socket
+}
 
 /**
  * ProcessWrapper constructor
@@ -24,6 +41,10 @@ type ProcessWrapper struct {}
 func New() *ProcessWrapper {
 	wrapper := &ProcessWrapper{}
 
+	wrapper.stdin   = nil
+	wrapper.process = nil
+	wrapper.control = nil
+
 	return wrapper
 }
 
@@ -36,6 +57,7 @@ func (wrapper *ProcessWrapper) Start(args []string) errors.Error {
 
 	// prepare php process
 	cmd := exec.Command("php", env...)
+	setParentDeathSignal(cmd)
 
 	// Capture the output
 	stdin, err := cmd.StdinPipe()
@@ -53,62 +75,88 @@ func (wrapper *ProcessWrapper) Start(args []string) errors.Error {
 		return errors.New(4, err.Error())
 	}
 
-	lsout := bufio.NewReader(stdout)
-	lserr := bufio.NewReader(stderr)
+	// Capture output to log files of the alias
+	logout, logerr, cerr := wrapper.OpenLogs(args)
+	if cerr != nil {
+		return cerr
+	}
+	defer wrapper.CloseLogs(logout, logerr)
 
-	// Make process responsive for kill signal
-	go func(ls io.WriteCloser) {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			text := scanner.Text()
-			fmt.Printf("input=%s\n", text)
-			io.CopyN(ls, bytes.NewBufferString(text + "\n"), 4096)
-		}
-		ls.Close()
-	}(stdin)
+	// start the process
+	if err := cmd.Start(); err != nil {
+		return errors.New(1, err.Error())
+	}
 
-	// Fetch stdout & stderr of process
-	go func(ls *bufio.Reader) {
-		out := bufio.NewWriter(os.Stdout)
-		for {
-			line, _, _ := ls.ReadLine()
+	wrapper.lock.Lock()
+	wrapper.stdin   = stdin
+	wrapper.process = cmd.Process
+	wrapper.lock.Unlock()
 
-			out.WriteString(string(line) + "\n")
-			out.Flush()
-		}
-	}(lsout)
+	// Control socket lets commands and signals reach the process without knowing its pid
+	if cerr := wrapper.Listen(args[0]); cerr != nil {
+		fmt.Fprintf(os.Stderr, "Error[%d] = %s\n", cerr.GetCode(), cerr.GetMessage())
+	}
 
-	go func(ls *bufio.Reader) {
-		err := bufio.NewWriter(os.Stderr)
-		for {
-			line, _, _ := ls.ReadLine()
+	// Make process responsive for kill signal, stdin stays open for control socket after own one ends
+	wrapper.lock.Lock()
+	controlled := wrapper.control != nil
+	wrapper.lock.Unlock()
 
-			err.WriteString(string(line) + "\n")
-			err.Flush()
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			wrapper.Send(scanner.Text())
+		}
+		if !controlled {
+			wrapper.closeStdin()
 		}
-	}(lserr)
+	}()
 
-	// start the process
-	if err := cmd.Start(); err != nil {
-		return errors.New(1, err.Error())
-	}
+	// Fetch stdout & stderr of process, pumps end once process and its children close them
+	formatter := LoadOutputFormatter(args[0])
+
+	var pumps sync.WaitGroup
+	pumps.Add(2)
+	go wrapper.pump(&pumps, stdout, os.Stdout, LOG_STREAM_STDOUT, formatter, logout)
+	go wrapper.pump(&pumps, stderr, os.Stderr, LOG_STREAM_STDERR, formatter, logerr)
 
 	// register process
 	if cerr := wrapper.Register(args); cerr != nil {
+		cmd.Process.Kill()
+		pumps.Wait()
+		cmd.Wait()
+		wrapper.closeStdin()
+		wrapper.closeControl()
 		return cerr
 	}
 
-	// CTRL+C
+	// CTRL+C and termination are passed to process, wrapper exits once it has finished
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func(wrapper *ProcessWrapper, args []string){
-		<-c
-		wrapper.Unregister(args)
-		os.Exit(0)
-	}(wrapper, args)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func(process *os.Process){
+		for sig := range c {
+			if err := process.Signal(sig); err != nil {
+				process.Kill()
+			}
+		}
+	}(cmd.Process)
+
+	// SIGHUP reopens log files after external rotation
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			wrapper.ReopenLogs(logout, logerr)
+		}
+	}()
+
+	// Wait closes pipes, so output has to be drained first
+	pumps.Wait()
 
 	// Don't let function exit before our command has finished running
 	cmd.Wait()
+	wrapper.closeStdin()
+	wrapper.closeControl()
 
 	// unregister process
 	if cerr := wrapper.Unregister(args); cerr != nil {
@@ -120,8 +168,14 @@ func (wrapper *ProcessWrapper) Start(args []string) errors.Error {
 
 /**
  * ProcessWrapper.Register([]string) errors.Error
+ *
+ * Wrappers started by kraken daemon are registered by the daemon itself.
  */
 func (wrapper *ProcessWrapper) Register(args []string) errors.Error {
+	if wrapper.IsSupervised() {
+		return nil
+	}
+
 	// update storage
 	st, err := storage.NewFileStorage("kraken")
 	if err != nil {
@@ -152,6 +206,10 @@ func (wrapper *ProcessWrapper) Register(args []string) errors.Error {
  * ProcesWrapper.Unregister([]string) errors.Error
  */
 func (wrapper *ProcessWrapper) Unregister(args []string) errors.Error {
+	if wrapper.IsSupervised() {
+		return nil
+	}
+
 	// update storage
 	st, err := storage.NewFileStorage("kraken")
 	if err != nil {
@@ -177,6 +235,129 @@ func (wrapper *ProcessWrapper) Unregister(args []string) errors.Error {
 	return nil
 }
 
+/**
+ * ProcessWrapper.closeStdin()
+ */
+func (wrapper *ProcessWrapper) closeStdin() {
+	wrapper.lock.Lock()
+	defer wrapper.lock.Unlock()
+
+	if wrapper.stdin != nil {
+		wrapper.stdin.Close()
+	}
+
+	wrapper.stdin   = nil
+	wrapper.process = nil
+}
+
+/**
+ * ProcessWrapper.closeControl()
+ *
+ * Socket is closed without wrapper lock held, as shutdown waits for running handlers which take it.
+ */
+func (wrapper *ProcessWrapper) closeControl() {
+	wrapper.lock.Lock()
+	control := wrapper.control
+	wrapper.control = nil
+	wrapper.lock.Unlock()
+
+	if control != nil {
+		control.Close()
+	}
+}
+
+/**
+ * ProcessWrapper.pump(*sync.WaitGroup, io.Reader, io.Writer, string, *OutputFormatter, *LogFile)
+ *
+ * Copies output of process line by line until EOF. Lines are passed on byte for byte, only lines longer than
+ * PUMP_MAX_LINE are split, so that memory stays bounded for binary output without newlines.
+ */
+func (wrapper *ProcessWrapper) pump(done *sync.WaitGroup, r io.Reader, w io.Writer, stream string, formatter *OutputFormatter, log *LogFile) {
+	defer done.Done()
+
+	reader := bufio.NewReaderSize(r, PUMP_BUFFER)
+	line := []byte{}
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull && len(line) < PUMP_MAX_LINE {
+			continue
+		}
+
+		if len(line) > 0 {
+			w.Write(formatter.Format(stream, line))
+			if log != nil {
+				log.WriteLine(bytes.TrimSuffix(line, []byte{'\n'}))
+			}
+			line = line[:0]
+		}
+
+		if err != nil && err != bufio.ErrBufferFull {
+			// io.EOF or pipe closed
+			return
+		}
+	}
+}
+
+/**
+ * ProcessWrapper.OpenLogs([]string) (*LogFile, *LogFile, errors.Error)
+ *
+ * Opens stdout and stderr log files of the alias, both are nil when capture has been disabled.
+ */
+func (wrapper *ProcessWrapper) OpenLogs(args []string) (*LogFile, *LogFile, errors.Error) {
+	config := LoadLogConfig()
+	if !config.Enabled || len(args) < 1 {
+		return nil, nil, nil
+	}
+
+	logout, err := CreateLogFile(config, args[0], LOG_STREAM_STDOUT)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logerr, err := CreateLogFile(config, args[0], LOG_STREAM_STDERR)
+	if err != nil {
+		logout.Close()
+		return nil, nil, err
+	}
+
+	return logout, logerr, nil
+}
+
+/**
+ * ProcessWrapper.ReopenLogs(...*LogFile)
+ */
+func (wrapper *ProcessWrapper) ReopenLogs(logs ...*LogFile) {
+	for _, log := range logs {
+		if log == nil {
+			continue
+		}
+		if err := log.Reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error[%d] = %s\n", err.GetCode(), err.GetMessage())
+		}
+	}
+}
+
+/**
+ * ProcessWrapper.CloseLogs(...*LogFile)
+ */
+func (wrapper *ProcessWrapper) CloseLogs(logs ...*LogFile) {
+	for _, log := range logs {
+		if log != nil {
+			log.Close()
+		}
+	}
+}
+
+/**
+ * ProcessWrapper.IsSupervised() bool
+ */
+func (wrapper *ProcessWrapper) IsSupervised() bool {
+	return os.Getenv(ENV_SUPERVISED) != ""
+}
+
 func fmtDummy() {
 	fmt.Printf("%s\n", "")
 }
@@ -0,0 +1,65 @@
+package wrapper
+
+import (
+	"sync"
+	"time"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runPump(t *testing.T, input []byte, formatter *OutputFormatter, log *LogFile) []byte {
+	var out bytes.Buffer
+	var done sync.WaitGroup
+	done.Add(1)
+
+	go New().pump(&done, bytes.NewReader(input), &out, LOG_STREAM_STDOUT, formatter, log)
+
+	finished := make(chan struct{})
+	go func() {
+		done.Wait()
+		close(finished)
+	}()
+
+	select {
+		case <-finished:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("pump has not ended on EOF")
+	}
+
+	return out.Bytes()
+}
+
+func TestPumpPassesOutputUnchanged(t *testing.T) {
+	long := strings.Repeat("x", PUMP_BUFFER * 3)
+	input := []byte("first\n" + long + "\n\xff\xfe binary \x00\r\n\nunterminated")
+
+	if out := runPump(t, input, CreateOutputFormatter(OUTPUT_RAW, "app"), nil); !bytes.Equal(out, input) {
+		t.Errorf("output has been changed, %d bytes of %d passed", len(out), len(input))
+	}
+}
+
+func TestPumpSplitsOnlyOverlongLines(t *testing.T) {
+	config := createTestLogConfig(t)
+	config.MaxSize = 0
+
+	log, err := CreateLogFile(config, "app", LOG_STREAM_STDOUT)
+	if err != nil {
+		t.Fatalf("create: %s", err.GetMessage())
+	}
+
+	long := strings.Repeat("y", PUMP_BUFFER * 2)
+	overlong := strings.Repeat("z", PUMP_MAX_LINE + 10)
+
+	runPump(t, []byte(long + "\n" + overlong + "\nlast"), CreateOutputFormatter(OUTPUT_TEXT, "app"), log)
+	log.Close()
+
+	lines := readTestLines(t, config.GetLogPath("app", LOG_STREAM_STDOUT))
+	if len(lines) != 4 || lines[0] != long || lines[1] + lines[2] != overlong || len(lines[1]) != PUMP_MAX_LINE || lines[3] != "last" {
+		sizes := []int{}
+		for _, line := range lines {
+			sizes = append(sizes, len(line))
+		}
+		t.Errorf("unexpected line sizes %v", sizes)
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	STORAGE_OP_READ				string = "read"
+	STORAGE_OP_WRITE			string = "write"
+	STORAGE_OP_ERASE			string = "erase"
+)
+
+/**
+ * OperationStats class
+ *
+ * Number and total duration of storage operations of one kind done by this process.
+ */
+type OperationStats struct {
+	Count		uint64
+	Seconds		float64
+}
+
+var statsLock sync.Mutex
+var operationStats = map[string]OperationStats{}
+
+/**
+ * GetOperationStats() map[string]OperationStats
+ *
+ * Returns copy of stats keyed by operation, one of STORAGE_OP_* constants.
+ */
+func GetOperationStats() map[string]OperationStats {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	stats := map[string]OperationStats{}
+	for op, stat := range operationStats {
+		stats[op] = stat
+	}
+
+	return stats
+}
+
+func observeOperation(op string, since time.Time) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	stat := operationStats[op]
+	stat.Count++
+	stat.Seconds += time.Since(since).Seconds()
+	operationStats[op] = stat
+}
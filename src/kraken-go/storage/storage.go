@@ -4,6 +4,7 @@ import (
 	"os"
 	"fmt"
 	"bufio"
+	"time"
 	"strings"
 	"../lock"
 	"../errors"
@@ -91,6 +92,8 @@ func (fs *FileStorage) Add(record *DataRecord) (bool, errors.Error) {
  * FileStorage.AddSeveral([]*DataRecord) (bool, errors.Error)
  */
 func (fs *FileStorage) AddSeveral(records []*DataRecord) (bool, errors.Error) {
+	defer observeOperation(STORAGE_OP_WRITE, time.Now())
+
 	var file *os.File
 	var err errors.Error
 	if file, err = fs.GetStore(); err != nil {
@@ -178,6 +181,8 @@ func (fs *FileStorage) GetSeveral(needles []*DataRecord) ([]*DataRecord, errors.
  * FileStorage.GetAll() ([]*DataRecord, errors.Error)
  */
 func (fs *FileStorage) GetAll() ([]*DataRecord, errors.Error) {
+	defer observeOperation(STORAGE_OP_READ, time.Now())
+
 	var file *os.File
 	var err errors.Error
 
@@ -248,9 +253,13 @@ func (fs *FileStorage) ExcludeSeveral(needles []*DataRecord) ([]*DataRecord, err
 
 /**
  * FileStorage.Erase() (bool, errors.Error)
+ *
+ * Erasing storage which has not been written to yet succeeds.
  */
 func (fs *FileStorage) Erase() (bool, errors.Error) {
-	if err := os.Remove(fs.filePath); err != nil {
+	defer observeOperation(STORAGE_OP_ERASE, time.Now())
+
+	if err := os.Remove(fs.filePath); err != nil && !os.IsNotExist(err) {
 		return false, errors.New(13, err.Error())
 	}
 
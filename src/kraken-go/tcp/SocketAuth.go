@@ -0,0 +1,283 @@
+package tcp
+
+import (
+	"time"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"../json"
+	"../storage"
+	"../errors"
+)
+
+const (
+	AUTH_HMAC					 string = "hmac"
+	AUTH_TOKEN					 string = "token"
+	AUTH_ANY_COMMAND			 string = "*"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketAuthToken class
+ */
+type SocketAuthToken struct {
+	Name			string
+	Permissions		[]string
+}
+
+/**
+ * SocketAuthToken constructor
+ */
+func CreateSocketAuthToken(name string, permissions []string) *SocketAuthToken {
+	return &SocketAuthToken{name, permissions}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketAuthConfig class
+ *
+ * Listening socket requires authentication as soon as Secret or Tokens are set. Connecting socket presents Secret if
+ * server accepts HMAC challenge-response and falls back to Token otherwise.
+ */
+type SocketAuthConfig struct {
+	Secret				string
+	SecretPermissions	[]string
+	Tokens				map[string]*SocketAuthToken
+	Token				string
+	Timeout				time.Duration
+}
+
+/**
+ * SocketAuthConfig constructor
+ */
+func CreateSocketAuthConfig() *SocketAuthConfig {
+	config := &SocketAuthConfig{}
+
+	config.Secret            = ""
+	config.SecretPermissions = []string{AUTH_ANY_COMMAND}
+	config.Tokens            = map[string]*SocketAuthToken{}
+	config.Token             = ""
+	config.Timeout           = 5 * time.Second
+
+	return config
+}
+
+/**
+ * LoadSocketAuthConfig(*json.Json) *SocketAuthConfig
+ *
+ * Reads auth section of Environment config:
+ * {"secret":"...","secretPermissions":["*"],"tokens":{"<token>":{"name":"...","permissions":["PING"]}},"token":"..."}
+ */
+func LoadSocketAuthConfig(data *json.Json) *SocketAuthConfig {
+	config := CreateSocketAuthConfig()
+
+	config.Secret = data.Get("secret").MustString()
+	config.Token  = data.Get("token").MustString()
+
+	if permissions, err := data.Get("secretPermissions").StringArray(); err == nil {
+		config.SecretPermissions = permissions
+	}
+	if timeout := data.Get("timeout").MustInt(); timeout > 0 {
+		config.Timeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	for token, _ := range data.Get("tokens").MustMap() {
+		entry := data.Get("tokens").Get(token)
+		permissions, _ := entry.Get("permissions").StringArray()
+		config.Tokens[token] = CreateSocketAuthToken(entry.Get("name").MustString(token), permissions)
+	}
+
+	return config
+}
+
+/**
+ * SocketAuthConfig.GetMethods() []string
+ */
+func (config *SocketAuthConfig) GetMethods() []string {
+	methods := []string{}
+
+	if config.Secret != "" {
+		methods = append(methods, AUTH_HMAC)
+	}
+	if len(config.Tokens) > 0 {
+		methods = append(methods, AUTH_TOKEN)
+	}
+
+	return methods
+}
+
+/**
+ * SocketAuthConfig.IsRequired() bool
+ */
+func (config *SocketAuthConfig) IsRequired() bool {
+	return len(config.GetMethods()) > 0
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketClient.GetPrincipal() string
+ *
+ * Returns name under which client has authenticated, empty when no authentication took place.
+ */
+func (c *SocketClient) GetPrincipal() string {
+	return c.principal
+}
+
+/**
+ * SocketClient.IsAllowed(string) bool
+ *
+ * Checks whether authenticated client may send given command. Clients of sockets without authentication may send
+ * anything.
+ */
+func (c *SocketClient) IsAllowed(cmd string) bool {
+	if c.permissions == nil {
+		return true
+	}
+
+	for _, permission := range c.permissions {
+		if permission == AUTH_ANY_COMMAND || permission == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.requiresAuth() bool
+ */
+func (sock *Socket) requiresAuth() bool {
+	return sock.Config.Auth != nil && sock.Config.Auth.IsRequired()
+}
+
+/**
+ * Socket.challengeAuth(*SocketClient, string) errors.Error
+ *
+ * Server side of authentication, run right after WELCOME carrying the challenge has been sent. Client has to answer
+ * with AUTH frame before auth timeout.
+ */
+func (sock *Socket) challengeAuth(c *SocketClient, challenge string) errors.Error {
+	config := sock.Config.Auth
+
+	c.conn.SetReadDeadline(time.Now().Add(config.Timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	message, err := c.ReadMessage()
+	if err != nil {
+		if err.GetCode() == SOCKET_ERR_TIMEOUT {
+			return sock.rejectHandshake(c, SOCKET_ERR_UNAUTHORIZED, "Authentication timed out.")
+		}
+		return err
+	}
+
+	if message.GetCmd() != SOCKET_AUTH {
+		return sock.rejectHandshake(c, SOCKET_ERR_UNAUTHORIZED, "Authentication is required.")
+	}
+
+	record := message.GetRecord()
+
+	switch record.Get(MESSAGE_METHOD) {
+		case AUTH_HMAC:
+			if config.Secret == "" {
+				break
+			}
+
+			expected := signChallenge(config.Secret, challenge, c.handshake.Node)
+			if !hmac.Equal([]byte(expected), []byte(record.Get(MESSAGE_DIGEST))) {
+				break
+			}
+
+			c.principal   = AUTH_HMAC + ":" + c.handshake.Node
+			c.permissions = config.SecretPermissions
+
+		case AUTH_TOKEN:
+			token := record.Get(MESSAGE_TOKEN)
+
+			for value, entry := range config.Tokens {
+				if subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1 {
+					c.principal   = AUTH_TOKEN + ":" + entry.Name
+					c.permissions = entry.Permissions
+				}
+			}
+	}
+
+	if c.principal == "" {
+		return sock.rejectHandshake(c, SOCKET_ERR_UNAUTHORIZED, "Authentication failed.")
+	}
+
+	if c.permissions == nil {
+		c.permissions = []string{}
+	}
+
+	return c.WriteMessage(CreateSocketMessage(SOCKET_AUTH_OK, storage.CreateDataRecord()))
+}
+
+/**
+ * Socket.answerAuth(*SocketClient, *storage.DataRecord) errors.Error
+ *
+ * Client side of authentication, answers challenge sent in WELCOME frame.
+ */
+func (sock *Socket) answerAuth(c *SocketClient, welcome *storage.DataRecord) errors.Error {
+	config  := sock.Config.Auth
+	methods := splitList(welcome.Get(MESSAGE_AUTH))
+	record  := storage.CreateDataRecord()
+
+	switch {
+		case config != nil && config.Secret != "" && inList(methods, AUTH_HMAC):
+			record.Set(MESSAGE_METHOD, AUTH_HMAC)
+			record.Set(MESSAGE_DIGEST, signChallenge(config.Secret, welcome.Get(MESSAGE_CHALLENGE), sock.Config.Node))
+
+		case config != nil && config.Token != "" && inList(methods, AUTH_TOKEN):
+			record.Set(MESSAGE_METHOD, AUTH_TOKEN)
+			record.Set(MESSAGE_TOKEN, config.Token)
+
+		default:
+			return errors.New(SOCKET_ERR_UNAUTHORIZED, "Server requires authentication with one of: " + joinList(methods) + ".")
+	}
+
+	if err := c.WriteMessage(CreateSocketMessage(SOCKET_AUTH, record)); err != nil {
+		return err
+	}
+
+	message, err := c.ReadMessage()
+	if err != nil {
+		return errors.New(SOCKET_ERR_HANDSHAKE, err.GetMessage())
+	}
+
+	switch message.GetCmd() {
+		case SOCKET_AUTH_OK:
+			return nil
+		case SOCKET_REJECT:
+			return replyError(message.GetRecord())
+	}
+
+	return errors.New(SOCKET_ERR_HANDSHAKE, "Unexpected " + message.GetCmd() + " frame during authentication.")
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+func createChallenge() string {
+	nonce := make([]byte, 32)
+	rand.Read(nonce)
+
+	return hex.EncodeToString(nonce)
+}
+
+func signChallenge(secret string, challenge string, node string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(challenge + ":" + node))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func inList(list []string, item string) bool {
+	for _, x := range list {
+		if x == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"bufio"
+	"strings"
+	"context"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+func listenAuth(t *testing.T, port string) *Socket {
+	auth := CreateSocketAuthConfig()
+	auth.Secret  = "s3cret"
+	auth.Tokens  = map[string]*SocketAuthToken{"abc": CreateSocketAuthToken("dash", []string{"PING"})}
+	auth.Timeout = 300 * time.Millisecond
+
+	srv := CreateSocket()
+	srv.Config.Auth = auth
+	srv.Config.HandshakeTimeout = 300 * time.Millisecond
+	srv.RegisterMethod("PING", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		reply := storage.CreateDataRecord()
+		reply.Set("WHO", c.GetPrincipal())
+		return reply, nil
+	})
+	srv.RegisterMethod("SPAWN", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		return nil, nil
+	})
+
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	return srv
+}
+
+func connectAuth(port string, secret string, token string) (*Socket, errors.Error) {
+	auth := CreateSocketAuthConfig()
+	auth.Secret = secret
+	auth.Token  = token
+
+	cl := CreateSocket()
+	cl.Config.Node = "w1"
+	cl.Config.Auth = auth
+
+	return cl, cl.Connect("127.0.0.1", port)
+}
+
+func TestAuthAcceptsValidCredentials(t *testing.T) {
+	srv := listenAuth(t, "19291")
+	defer srv.Close()
+
+	cases := []struct {
+		secret		string
+		token		string
+		principal	string
+		spawn		bool
+	}{
+		{"s3cret", "", AUTH_HMAC + ":w1", true},
+		{"", "abc", AUTH_TOKEN + ":dash", false},
+	}
+
+	for _, tc := range cases {
+		cl, err := connectAuth("19291", tc.secret, tc.token)
+		if err != nil {
+			t.Fatalf("%s: connect: %s", tc.principal, err.GetMessage())
+		}
+
+		reply, err := cl.Call(context.Background(), "PING", nil)
+		if err != nil || reply.Get("WHO") != tc.principal {
+			t.Errorf("%s: unexpected PING reply %v %v", tc.principal, reply, err)
+		}
+
+		_, err = cl.Call(context.Background(), "SPAWN", nil)
+		if (err == nil) != tc.spawn {
+			t.Errorf("%s: unexpected SPAWN result %v", tc.principal, err)
+		}
+
+		cl.Close()
+	}
+}
+
+func TestAuthRejectsInvalidCredentials(t *testing.T) {
+	srv := listenAuth(t, "19292")
+	defer srv.Close()
+
+	for _, creds := range [][2]string{{"wrong", ""}, {"", "zzz"}, {"", ""}} {
+		cl, err := connectAuth("19292", creds[0], creds[1])
+		if err == nil {
+			cl.Close()
+			t.Errorf("%v: connection has been accepted", creds)
+			continue
+		}
+		if err.GetCode() != SOCKET_ERR_UNAUTHORIZED {
+			t.Errorf("%v: unexpected error %d %s", creds, err.GetCode(), err.GetMessage())
+		}
+	}
+}
+
+func TestAuthDropsSilentClients(t *testing.T) {
+	srv := listenAuth(t, "19293")
+	defer srv.Close()
+
+	cases := map[string]string{
+		"before hello":	"",
+		"after welcome":	"[HELLO]VERSION=1,CODECS=text\n",
+	}
+
+	for name, greeting := range cases {
+		conn, err := net.Dial("tcp", "127.0.0.1:19293")
+		if err != nil {
+			t.Fatalf("%s: dial: %s", name, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		reader := bufio.NewReader(conn)
+		if greeting != "" {
+			conn.Write([]byte(greeting))
+			if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "[WELCOME]") {
+				t.Fatalf("%s: unexpected reply %q", name, line)
+			}
+		}
+
+		start := time.Now()
+		line, _ := reader.ReadString('\n')
+		if !strings.Contains(line, "Authentication timed out.") {
+			t.Errorf("%s: unexpected reply %q", name, line)
+		}
+		if elapsed := time.Since(start); elapsed > 3 * time.Second {
+			t.Errorf("%s: client has been dropped after %s", name, elapsed)
+		}
+
+		conn.Close()
+	}
+}
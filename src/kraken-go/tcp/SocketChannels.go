@@ -0,0 +1,236 @@
+package tcp
+
+import (
+	"../errors"
+)
+
+/**
+ * SocketEnvelope class
+ *
+ * Message together with client it came from or is addressed to. Outgoing envelope without client goes to the server
+ * on connecting socket and to every client on listening one. When Result is set, it receives outcome of the write, so
+ * it should be buffered; outcome is dropped when nobody is ready to take it.
+ */
+type SocketEnvelope struct {
+	Client		*SocketClient
+	Message		*SocketMessage
+	Result		chan errors.Error
+}
+
+/**
+ * SocketEnvelope constructor
+ */
+func CreateSocketEnvelope(c *SocketClient, m *SocketMessage) *SocketEnvelope {
+	envelope := &SocketEnvelope{}
+
+	envelope.Client  = c
+	envelope.Message = m
+	envelope.Result  = nil
+
+	return envelope
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.Incoming() <-chan *SocketEnvelope
+ *
+ * Switches socket to channel mode, messages which no handler took are from now on sent to returned channel instead
+ * of OnMessage callback. Reading connection waits until its message is taken, so slow consumer slows down its peers.
+ * Channel is closed once socket is shut down and every message read before has been taken; call Incoming again after
+ * socket is reopened.
+ */
+func (sock *Socket) Incoming() <-chan *SocketEnvelope {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	sock.streaming = true
+	sock.router.Forward(true)
+
+	return sock.Cout
+}
+
+/**
+ * Socket.Outgoing() chan<- *SocketEnvelope
+ *
+ * Returns channel of messages to be written. Socket does not close it, as that would make senders panic; instead it
+ * stops reading the channel once socket is shut down. Senders blocked on it at that moment are released and get
+ * SOCKET_ERR_NOT_CONNECTED on Result, later ones would block forever, so senders should select on Done as well. Call
+ * Outgoing again after socket is reopened. Sender may close the channel when done.
+ */
+func (sock *Socket) Outgoing() chan<- *SocketEnvelope {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	return sock.Cin
+}
+
+/**
+ * Socket.Done() <-chan struct{}
+ *
+ * Returns channel which is closed once the session current Outgoing channel belongs to is shut down.
+ */
+func (sock *Socket) Done() <-chan struct{} {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	return sock.retired
+}
+
+/**
+ * Socket.openChannels()
+ *
+ * Starts goroutine serving Outgoing channel for the new session.
+ */
+func (sock *Socket) openChannels() {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	in     := sock.Cin
+	halt   := make(chan struct{})
+	pumped := make(chan struct{})
+
+	sock.halt   = halt
+	sock.pumped = pumped
+
+	go func() {
+		defer close(pumped)
+
+		for {
+			select {
+				case envelope, ok := <-in:
+					if !ok {
+						return
+					}
+					sock.writeEnvelope(envelope)
+				case <-halt:
+					return
+			}
+		}
+	}()
+}
+
+/**
+ * Socket.haltChannels()
+ *
+ * Stops serving Outgoing channel and releases connections waiting for Incoming consumer.
+ */
+func (sock *Socket) haltChannels() {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	if sock.halt == nil {
+		return
+	}
+
+	select {
+		case <-sock.halt:
+		default:
+			close(sock.halt)
+	}
+}
+
+/**
+ * Socket.closeChannels()
+ *
+ * Closes Incoming channel of finished session, refuses senders still waiting on its Outgoing channel and prepares fresh
+ * ones for the next. Must be called once no connection is read anymore.
+ */
+func (sock *Socket) closeChannels() {
+	sock.haltChannels()
+
+	sock.lock.Lock()
+	pumped := sock.pumped
+	sock.lock.Unlock()
+
+	if pumped == nil {
+		return
+	}
+	<-pumped
+
+	sock.lock.Lock()
+	in, retired := sock.Cin, sock.retired
+
+	close(sock.Cout)
+	close(retired)
+
+	sock.Cin       = make(chan *SocketEnvelope)
+	sock.Cout      = make(chan *SocketEnvelope)
+	sock.halt      = nil
+	sock.pumped    = nil
+	sock.retired   = make(chan struct{})
+	sock.streaming = false
+	sock.lock.Unlock()
+
+	sock.refuseEnvelopes(in)
+}
+
+/**
+ * Socket.refuseEnvelopes(chan *SocketEnvelope)
+ *
+ * Takes envelopes of senders blocked on retired Outgoing channel and answers them with error.
+ */
+func (sock *Socket) refuseEnvelopes(in chan *SocketEnvelope) {
+	for {
+		select {
+			case envelope, ok := <-in:
+				if !ok {
+					return
+				}
+				if envelope.Result != nil {
+					select {
+						case envelope.Result <- errors.New(SOCKET_ERR_NOT_CONNECTED, "Socket has been shut down."):
+						default:
+					}
+				}
+			default:
+				return
+		}
+	}
+}
+
+/**
+ * Socket.streamMessage(*SocketClient, *SocketMessage) bool
+ *
+ * Passes message to Incoming channel. Returns false when socket is not in channel mode.
+ */
+func (sock *Socket) streamMessage(c *SocketClient, m *SocketMessage) bool {
+	sock.lock.Lock()
+	streaming, out, halt := sock.streaming, sock.Cout, sock.halt
+	sock.lock.Unlock()
+
+	if !streaming {
+		return false
+	}
+
+	select {
+		case out <- CreateSocketEnvelope(c, m):
+		case <-halt:
+	}
+
+	return true
+}
+
+/**
+ * Socket.writeEnvelope(*SocketEnvelope)
+ */
+func (sock *Socket) writeEnvelope(envelope *SocketEnvelope) {
+	var err errors.Error
+
+	switch {
+		case envelope.Client != nil:
+			err = sock.WriteMessage(envelope.Client, envelope.Message)
+		case sock.Conn.Client != nil:
+			err = sock.WriteMessage(sock.Conn.Client, envelope.Message)
+		default:
+			err = sock.Broadcast(envelope.Message)
+	}
+
+	if envelope.Result == nil {
+		return
+	}
+
+	select {
+		case envelope.Result <- err:
+		default:
+	}
+}
@@ -0,0 +1,116 @@
+package tcp
+
+import (
+	"time"
+	"testing"
+	"../errors"
+)
+
+func TestChannelsCarryMessages(t *testing.T) {
+	srv := CreateSocket()
+	incoming := srv.Incoming()
+	if err := srv.Listen("127.0.0.1", "19311"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19311"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	envelope := CreateSocketEnvelope(nil, createTextMessage("ping"))
+	envelope.Result = make(chan errors.Error, 1)
+	cl.Outgoing() <- envelope
+
+	select {
+		case err := <-envelope.Result:
+			if err != nil {
+				t.Fatalf("write: %s", err.GetMessage())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("outcome of write has not arrived")
+	}
+
+	var received *SocketEnvelope
+	select {
+		case received = <-incoming:
+			if text := received.Message.GetRecord().Get("TXT"); text != "ping" || received.Client == nil {
+				t.Fatalf("unexpected envelope %q from %v", text, received.Client)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("message has not been passed to Incoming")
+	}
+
+	// reply addressed to the client it came from
+	reply := CreateSocketEnvelope(received.Client, createTextMessage("pong"))
+	reply.Result = make(chan errors.Error, 1)
+	srv.Outgoing() <- reply
+	if err := <-reply.Result; err != nil {
+		t.Errorf("reply: %s", err.GetMessage())
+	}
+}
+
+func TestChannelsAreRetiredOnShutdown(t *testing.T) {
+	srv := CreateSocket()
+	incoming := srv.Incoming()
+	outgoing := srv.Outgoing()
+	done := srv.Done()
+	if err := srv.Listen("127.0.0.1", "19312"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	srv.Close()
+
+	select {
+		case _, ok := <-incoming:
+			if ok {
+				t.Errorf("Incoming delivered message after shutdown")
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Incoming has not been closed")
+	}
+
+	select {
+		case <-done:
+		default:
+			t.Errorf("Done has not been closed")
+	}
+
+	// sender selecting on Done is not left blocked
+	select {
+		case outgoing <- CreateSocketEnvelope(nil, createTextMessage("late")):
+			t.Errorf("retired Outgoing is still read")
+		case <-done:
+	}
+
+	if srv.Outgoing() == outgoing || srv.Done() == done {
+		t.Errorf("fresh channels have not been prepared for next session")
+	}
+}
+
+func TestBlockedSendersAreRefused(t *testing.T) {
+	sock := CreateSocket()
+	in := make(chan *SocketEnvelope)
+
+	envelope := CreateSocketEnvelope(nil, createTextMessage("blocked"))
+	envelope.Result = make(chan errors.Error, 1)
+
+	sent := make(chan struct{})
+	go func() {
+		in <- envelope
+		close(sent)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	sock.refuseEnvelopes(in)
+
+	select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("blocked sender has not been released")
+	}
+	if err := <-envelope.Result; err == nil || err.GetCode() != SOCKET_ERR_NOT_CONNECTED {
+		t.Errorf("unexpected outcome %v", err)
+	}
+}
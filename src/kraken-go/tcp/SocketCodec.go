@@ -0,0 +1,380 @@
+package tcp
+
+import (
+	"sync"
+	"strings"
+	"encoding/json"
+	"../storage"
+	"../errors"
+)
+
+const (
+	CODEC_TEXT					 string = "text"
+	CODEC_TEXT2					 string = "text2"
+	CODEC_JSON					 string = "json"
+	CODEC_MSGPACK				 string = "msgpack"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketCodec interface
+ *
+ * Codec translates SocketMessage to a single frame and back. Binary codecs are length-prefixed on the wire, the others
+ * are newline terminated, so encoded frames of non-binary codecs must never contain a raw newline.
+ */
+type SocketCodec interface {
+	GetName()					string
+	IsBinary()					bool
+	Encode(*SocketMessage)		([]byte, errors.Error)
+	Decode([]byte)				(*SocketMessage, errors.Error)
+}
+
+var codecs = map[string]SocketCodec{}
+var codecsLock sync.RWMutex
+
+func init() {
+	RegisterCodec(CreateTextCodec())
+	RegisterCodec(CreateEscapedTextCodec())
+	RegisterCodec(CreateJsonCodec())
+	RegisterCodec(CreateMsgpackCodec())
+}
+
+/**
+ * RegisterCodec(SocketCodec)
+ */
+func RegisterCodec(codec SocketCodec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+
+	codecs[codec.GetName()] = codec
+}
+
+/**
+ * GetCodec(string) SocketCodec
+ */
+func GetCodec(name string) SocketCodec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	return codecs[name]
+}
+
+/**
+ * SelectCodec([]string, []string) SocketCodec
+ *
+ * Picks the first codec from offered list which is also accepted and registered. Returns nil if peers have no codec
+ * in common.
+ */
+func SelectCodec(offered []string, accepted []string) SocketCodec {
+	for _, name := range offered {
+		for _, acc := range accepted {
+			if name == acc && GetCodec(name) != nil {
+				return GetCodec(name)
+			}
+		}
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * TextCodec class
+ *
+ * Legacy [CMD]key=val,key=val format, correlation id is appended to command as [CMD#ID].
+ *
+ * Plain "text" codec writes keys and values as they are, byte for byte like peers which do not negotiate codecs, so
+ * it cannot carry characters having meaning in the frame. Its "text2" version percent-escapes them (% , = \n \r [ ] #)
+ * and is used only when both peers offered it during handshake, frames of legacy peers are never escaped.
+ */
+type TextCodec struct {
+	escaped		bool
+}
+
+var textEscaper   = strings.NewReplacer("%", "%25", ",", "%2C", "=", "%3D", "\n", "%0A", "\r", "%0D", "[", "%5B", "]", "%5D", "#", "%23")
+var textUnescaper = strings.NewReplacer("%25", "%", "%2C", ",", "%3D", "=", "%0A", "\n", "%0D", "\r", "%5B", "[", "%5D", "]", "%23", "#")
+
+/**
+ * TextCodec constructor
+ */
+func CreateTextCodec() *TextCodec {
+	return &TextCodec{false}
+}
+
+/**
+ * TextCodec constructor
+ */
+func CreateEscapedTextCodec() *TextCodec {
+	return &TextCodec{true}
+}
+
+/**
+ * TextCodec.GetName() string
+ */
+func (codec *TextCodec) GetName() string {
+	if codec.escaped {
+		return CODEC_TEXT2
+	}
+
+	return CODEC_TEXT
+}
+
+/**
+ * TextCodec.IsBinary() bool
+ */
+func (codec *TextCodec) IsBinary() bool {
+	return false
+}
+
+/**
+ * TextCodec.Encode(*SocketMessage) ([]byte, errors.Error)
+ */
+func (codec *TextCodec) Encode(m *SocketMessage) ([]byte, errors.Error) {
+	cmd := codec.escape(m.Cmd)
+	if m.Id != "" {
+		cmd = cmd + "#" + codec.escape(m.Id)
+	}
+
+	var buffer strings.Builder
+	buffer.WriteString("[" + cmd + "]")
+
+	if m.Val != nil {
+		first := true
+		for key, val := range *m.Val {
+			if !first {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(codec.escape(key))
+			buffer.WriteString("=")
+			buffer.WriteString(codec.escape(val))
+			first = false
+		}
+	}
+
+	return []byte(buffer.String()), nil
+}
+
+/**
+ * TextCodec.Decode([]byte) (*SocketMessage, errors.Error)
+ */
+func (codec *TextCodec) Decode(frame []byte) (*SocketMessage, errors.Error) {
+	line := string(frame)
+	if !strings.HasPrefix(line, "[") || !strings.Contains(line, "]") {
+		return nil, errors.New(SOCKET_ERR_MALFORMED_MESSAGE, "Malformed text message.")
+	}
+
+	parts := strings.SplitN(line[1:], "]", 2)
+	record := storage.CreateDataRecord()
+
+	for _, val := range strings.Split(parts[1], ",") {
+		if val == "" {
+			continue
+		}
+		opt := strings.SplitN(val, "=", 2)
+		if len(opt) < 2 {
+			return nil, errors.New(SOCKET_ERR_MALFORMED_MESSAGE, "Malformed text message.")
+		}
+		record.Set(codec.unescape(opt[0]), codec.unescape(opt[1]))
+	}
+
+	cmd := strings.SplitN(parts[0], "#", 2)
+	message := CreateSocketMessage(codec.unescape(cmd[0]), record)
+	if len(cmd) > 1 {
+		message.Id = codec.unescape(cmd[1])
+	}
+
+	return message, nil
+}
+
+/**
+ * TextCodec.escape(string) string
+ */
+func (codec *TextCodec) escape(text string) string {
+	if !codec.escaped {
+		return text
+	}
+
+	return textEscaper.Replace(text)
+}
+
+/**
+ * TextCodec.unescape(string) string
+ */
+func (codec *TextCodec) unescape(text string) string {
+	if !codec.escaped {
+		return text
+	}
+
+	return textUnescaper.Replace(text)
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * JsonCodec class
+ *
+ * {"cmd":"MSG","id":"1","val":{"key":"val"}} frames, used by Kraken-PHP peers.
+ */
+type JsonCodec struct {}
+
+type jsonFrame struct {
+	Cmd		string				`json:"cmd"`
+	Id		string				`json:"id,omitempty"`
+	Val		map[string]string	`json:"val"`
+}
+
+/**
+ * JsonCodec constructor
+ */
+func CreateJsonCodec() *JsonCodec {
+	return &JsonCodec{}
+}
+
+/**
+ * JsonCodec.GetName() string
+ */
+func (codec *JsonCodec) GetName() string {
+	return CODEC_JSON
+}
+
+/**
+ * JsonCodec.IsBinary() bool
+ */
+func (codec *JsonCodec) IsBinary() bool {
+	return false
+}
+
+/**
+ * JsonCodec.Encode(*SocketMessage) ([]byte, errors.Error)
+ */
+func (codec *JsonCodec) Encode(m *SocketMessage) ([]byte, errors.Error) {
+	frame := jsonFrame{}
+	frame.Cmd = m.Cmd
+	frame.Id  = m.Id
+	frame.Val = map[string]string{}
+	if m.Val != nil {
+		frame.Val = m.Val.ToMap()
+	}
+
+	data, err := json.Marshal(&frame)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_MALFORMED_MESSAGE, err.Error())
+	}
+
+	return data, nil
+}
+
+/**
+ * JsonCodec.Decode([]byte) (*SocketMessage, errors.Error)
+ */
+func (codec *JsonCodec) Decode(data []byte) (*SocketMessage, errors.Error) {
+	frame := jsonFrame{}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, errors.New(SOCKET_ERR_MALFORMED_MESSAGE, err.Error())
+	}
+
+	message := CreateSocketMessage(frame.Cmd, storage.CreateDataRecord().FromMap(frame.Val))
+	message.Id = frame.Id
+
+	return message, nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * MsgpackCodec class
+ *
+ * MessagePack encoded {"cmd":str,"id":str,"val":{str:str}} map, id is omitted when empty. Only the subset of the format required by SocketMessage is
+ * supported.
+ */
+type MsgpackCodec struct {}
+
+/**
+ * MsgpackCodec constructor
+ */
+func CreateMsgpackCodec() *MsgpackCodec {
+	return &MsgpackCodec{}
+}
+
+/**
+ * MsgpackCodec.GetName() string
+ */
+func (codec *MsgpackCodec) GetName() string {
+	return CODEC_MSGPACK
+}
+
+/**
+ * MsgpackCodec.IsBinary() bool
+ */
+func (codec *MsgpackCodec) IsBinary() bool {
+	return true
+}
+
+/**
+ * MsgpackCodec.Encode(*SocketMessage) ([]byte, errors.Error)
+ */
+func (codec *MsgpackCodec) Encode(m *SocketMessage) ([]byte, errors.Error) {
+	w := &msgpackWriter{}
+
+	val := map[string]string{}
+	if m.Val != nil {
+		val = m.Val.ToMap()
+	}
+
+	if m.Id != "" {
+		w.WriteMapHeader(3)
+		w.WriteString("id")
+		w.WriteString(m.Id)
+	} else {
+		w.WriteMapHeader(2)
+	}
+	w.WriteString("cmd")
+	w.WriteString(m.Cmd)
+	w.WriteString("val")
+	w.WriteMapHeader(len(val))
+	for key, v := range val {
+		w.WriteString(key)
+		w.WriteString(v)
+	}
+
+	return w.Bytes(), nil
+}
+
+/**
+ * MsgpackCodec.Decode([]byte) (*SocketMessage, errors.Error)
+ */
+func (codec *MsgpackCodec) Decode(data []byte) (*SocketMessage, errors.Error) {
+	r := &msgpackReader{data, 0}
+	m := CreateSocketMessage("", storage.CreateDataRecord())
+
+	n, err := r.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+			case "cmd":
+				if m.Cmd, err = r.ReadString(); err != nil {
+					return nil, err
+				}
+			case "id":
+				if m.Id, err = r.ReadString(); err != nil {
+					return nil, err
+				}
+			case "val":
+				if m.Val, err = r.ReadStringMap(); err != nil {
+					return nil, err
+				}
+			default:
+				if err = r.Skip(); err != nil {
+					return nil, err
+				}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,112 @@
+package tcp
+
+import (
+	"strings"
+	"testing"
+	"../storage"
+)
+
+func createTestMessage() *SocketMessage {
+	record := storage.CreateDataRecord()
+	record.Set("TXT", "hello")
+	record.Set("LIST", "a,b;c")
+	record.Set("EXPR", "x=1, y=2")
+	record.Set("MULTI", "first\nsecond\r\n[EXIT]")
+	record.Set("PCT", "100%2C%")
+	record.Set("KEY=WITH,SEP", "[a#b]")
+	record.Set("UTF", "zażółć")
+	record.Set("EMPTY", "")
+
+	message := CreateSocketMessage("MSG", record)
+	message.Id = "42"
+
+	return message
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, name := range []string{CODEC_TEXT2, CODEC_JSON, CODEC_MSGPACK} {
+		codec := GetCodec(name)
+		message := createTestMessage()
+
+		frame, err := codec.Encode(message)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %s", name, err.GetMessage())
+		}
+		if !codec.IsBinary() && strings.ContainsAny(string(frame), "\n") {
+			t.Fatalf("%s: frame contains raw newline: %q", name, frame)
+		}
+
+		decoded, err := codec.Decode(frame)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %s", name, err.GetMessage())
+		}
+		if decoded.GetCmd() != message.GetCmd() || decoded.GetId() != message.GetId() {
+			t.Fatalf("%s: got %s#%s, want %s#%s", name, decoded.GetCmd(), decoded.GetId(), message.GetCmd(), message.GetId())
+		}
+		if !decoded.GetRecord().Equals(message.GetRecord()) || len(decoded.GetRecord().ToMap()) != len(message.GetRecord().ToMap()) {
+			t.Fatalf("%s: got %v, want %v", name, decoded.GetRecord().ToMap(), message.GetRecord().ToMap())
+		}
+	}
+}
+
+func TestTextCodecEscapesFrameCharacters(t *testing.T) {
+	codec := CreateEscapedTextCodec()
+
+	record := storage.CreateDataRecord()
+	record.Set("TEXT", "a,b=c\n[EXIT]")
+	message := CreateSocketMessage("SEND", record)
+	message.Id = "1#2"
+
+	frame, _ := codec.Encode(message)
+	if string(frame) != "[SEND#1%232]TEXT=a%2Cb%3Dc%0A%5BEXIT%5D" {
+		t.Fatalf("unexpected frame %q", frame)
+	}
+
+	decoded, err := codec.Decode(frame)
+	if err != nil {
+		t.Fatalf("decode failed: %s", err.GetMessage())
+	}
+	if decoded.GetRecord().Get("TEXT") != "a,b=c\n[EXIT]" || decoded.GetId() != "1#2" {
+		t.Fatalf("unexpected message %s#%s %v", decoded.GetCmd(), decoded.GetId(), decoded.GetRecord().ToMap())
+	}
+}
+
+func TestTextCodecDecodesLegacyFrames(t *testing.T) {
+	codec := CreateTextCodec()
+
+	decoded, err := codec.Decode([]byte("[MSG]TXT=hello world,N=1"))
+	if err != nil {
+		t.Fatalf("decode failed: %s", err.GetMessage())
+	}
+	if decoded.GetCmd() != "MSG" || decoded.GetId() != "" || decoded.GetRecord().Get("TXT") != "hello world" || decoded.GetRecord().Get("N") != "1" {
+		t.Fatalf("unexpected message %s %v", decoded.GetCmd(), decoded.GetRecord().ToMap())
+	}
+
+	decoded, _ = codec.Decode([]byte("[MSG]PCT=100%2C"))
+	if decoded.GetRecord().Get("PCT") != "100%2C" {
+		t.Fatalf("legacy value has been unescaped to %q", decoded.GetRecord().Get("PCT"))
+	}
+
+	if _, err := codec.Decode([]byte("MSG]TXT=x")); err == nil {
+		t.Fatalf("malformed frame has been accepted")
+	}
+	if _, err := codec.Decode([]byte("[MSG]TXT")); err == nil {
+		t.Fatalf("value without separator has been accepted")
+	}
+}
+
+func TestTextCodecKeepsLegacyBytes(t *testing.T) {
+	record := storage.CreateDataRecord()
+	record.Set("TXT", "50% done")
+	message := CreateSocketMessage("MSG", record)
+
+	frame, _ := CreateTextCodec().Encode(message)
+	if string(frame) != "[MSG]TXT=50% done" {
+		t.Fatalf("unexpected frame %q", frame)
+	}
+
+	frame, _ = CreateEscapedTextCodec().Encode(message)
+	if string(frame) != "[MSG]TXT=50%25 done" {
+		t.Fatalf("unexpected frame %q", frame)
+	}
+}
@@ -0,0 +1,344 @@
+package tcp
+
+import (
+	"io"
+	"sync"
+	"bytes"
+	"io/ioutil"
+	"sync/atomic"
+	"compress/gzip"
+	"compress/flate"
+	"encoding/base64"
+	"../errors"
+)
+
+const (
+	COMPRESSION_GZIP			 string = "gzip"
+	COMPRESSION_DEFLATE			 string = "deflate"
+)
+
+const (
+	COMPRESSED_FRAME_FLAG		 uint32 = 1 << 31
+	COMPRESSED_LINE_PREFIX		 byte = '~'
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketCompressor interface
+ *
+ * Compresses whole frames produced by codec. Algorithms other than the stdlib ones, zstd for example, can be plugged
+ * in with RegisterCompressor, peers only need to register them under the same name.
+ */
+type SocketCompressor interface {
+	GetName()					string
+	Compress([]byte, int)		([]byte, errors.Error)
+	Decompress([]byte, int)		([]byte, errors.Error)
+}
+
+var compressors = map[string]SocketCompressor{}
+var compressorsLock sync.RWMutex
+
+func init() {
+	RegisterCompressor(CreateGzipCompressor())
+	RegisterCompressor(CreateDeflateCompressor())
+}
+
+/**
+ * RegisterCompressor(SocketCompressor)
+ */
+func RegisterCompressor(compressor SocketCompressor) {
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+
+	compressors[compressor.GetName()] = compressor
+}
+
+/**
+ * GetCompressor(string) SocketCompressor
+ */
+func GetCompressor(name string) SocketCompressor {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+
+	return compressors[name]
+}
+
+/**
+ * SelectCompressor([]string, []string) SocketCompressor
+ *
+ * Picks the first offered algorithm which is also accepted and registered. Returns nil when there is none.
+ */
+func SelectCompressor(offered []string, accepted []string) SocketCompressor {
+	for _, name := range intersectList(offered, accepted) {
+		if compressor := GetCompressor(name); compressor != nil {
+			return compressor
+		}
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * GzipCompressor class
+ */
+type GzipCompressor struct {}
+
+/**
+ * GzipCompressor constructor
+ */
+func CreateGzipCompressor() *GzipCompressor {
+	return &GzipCompressor{}
+}
+
+/**
+ * GzipCompressor.GetName() string
+ */
+func (compressor *GzipCompressor) GetName() string {
+	return COMPRESSION_GZIP
+}
+
+/**
+ * GzipCompressor.Compress([]byte, int) ([]byte, errors.Error)
+ */
+func (compressor *GzipCompressor) Compress(data []byte, level int) ([]byte, errors.Error) {
+	var buf bytes.Buffer
+
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+
+	return closeCompressed(&buf, w, data)
+}
+
+/**
+ * GzipCompressor.Decompress([]byte, int) ([]byte, errors.Error)
+ */
+func (compressor *GzipCompressor) Decompress(data []byte, limit int) ([]byte, errors.Error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+	defer r.Close()
+
+	return readDecompressed(r, limit)
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * DeflateCompressor class
+ */
+type DeflateCompressor struct {}
+
+/**
+ * DeflateCompressor constructor
+ */
+func CreateDeflateCompressor() *DeflateCompressor {
+	return &DeflateCompressor{}
+}
+
+/**
+ * DeflateCompressor.GetName() string
+ */
+func (compressor *DeflateCompressor) GetName() string {
+	return COMPRESSION_DEFLATE
+}
+
+/**
+ * DeflateCompressor.Compress([]byte, int) ([]byte, errors.Error)
+ */
+func (compressor *DeflateCompressor) Compress(data []byte, level int) ([]byte, errors.Error) {
+	var buf bytes.Buffer
+
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+
+	return closeCompressed(&buf, w, data)
+}
+
+/**
+ * DeflateCompressor.Decompress([]byte, int) ([]byte, errors.Error)
+ */
+func (compressor *DeflateCompressor) Decompress(data []byte, limit int) ([]byte, errors.Error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return readDecompressed(r, limit)
+}
+
+func closeCompressed(buf *bytes.Buffer, w io.WriteCloser, data []byte) ([]byte, errors.Error) {
+	if _, err := w.Write(data); err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func readDecompressed(r io.Reader, limit int) ([]byte, errors.Error) {
+	if limit > 0 {
+		r = io.LimitReader(r, int64(limit) + 1)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_COMPRESSION, err.Error())
+	}
+	if limit > 0 && len(data) > limit {
+		return nil, frameTooLarge(limit)
+	}
+
+	return data, nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketCompressionStats class
+ *
+ * Raw bytes are frames as produced by codec, wire bytes are what has been actually transferred, so ratios below one
+ * mean compression pays off.
+ */
+type SocketCompressionStats struct {
+	Algorithm			string
+	FramesSent			uint64
+	FramesCompressed	uint64
+	BytesSentRaw		uint64
+	BytesSentWire		uint64
+	FramesReceived		uint64
+	FramesDecompressed	uint64
+	BytesReceivedRaw	uint64
+	BytesReceivedWire	uint64
+}
+
+/**
+ * SocketCompressionStats.GetSentRatio() float64
+ */
+func (stats *SocketCompressionStats) GetSentRatio() float64 {
+	if stats.BytesSentRaw == 0 {
+		return 1
+	}
+
+	return float64(stats.BytesSentWire) / float64(stats.BytesSentRaw)
+}
+
+/**
+ * SocketCompressionStats.GetReceivedRatio() float64
+ */
+func (stats *SocketCompressionStats) GetReceivedRatio() float64 {
+	if stats.BytesReceivedRaw == 0 {
+		return 1
+	}
+
+	return float64(stats.BytesReceivedWire) / float64(stats.BytesReceivedRaw)
+}
+
+/**
+ * SocketCompressionCounters class
+ */
+type SocketCompressionCounters struct {
+	framesSent			uint64
+	framesCompressed	uint64
+	bytesSentRaw		uint64
+	bytesSentWire		uint64
+	framesReceived		uint64
+	framesDecompressed	uint64
+	bytesReceivedRaw	uint64
+	bytesReceivedWire	uint64
+}
+
+/**
+ * SocketClient.GetCompressionStats() *SocketCompressionStats
+ */
+func (c *SocketClient) GetCompressionStats() *SocketCompressionStats {
+	counters := c.compressionCounters
+	stats := &SocketCompressionStats{}
+
+	if c.compressor != nil {
+		stats.Algorithm = c.compressor.GetName()
+	}
+
+	stats.FramesSent         = atomic.LoadUint64(&counters.framesSent)
+	stats.FramesCompressed   = atomic.LoadUint64(&counters.framesCompressed)
+	stats.BytesSentRaw       = atomic.LoadUint64(&counters.bytesSentRaw)
+	stats.BytesSentWire      = atomic.LoadUint64(&counters.bytesSentWire)
+	stats.FramesReceived     = atomic.LoadUint64(&counters.framesReceived)
+	stats.FramesDecompressed = atomic.LoadUint64(&counters.framesDecompressed)
+	stats.BytesReceivedRaw   = atomic.LoadUint64(&counters.bytesReceivedRaw)
+	stats.BytesReceivedWire  = atomic.LoadUint64(&counters.bytesReceivedWire)
+
+	return stats
+}
+
+/**
+ * SocketClient.compressFrame([]byte) ([]byte, bool)
+ *
+ * Compresses frame when compression has been negotiated and frame is over the threshold. Frames which would not get
+ * any smaller are sent as they are.
+ */
+func (c *SocketClient) compressFrame(frame []byte) ([]byte, bool) {
+	counters := c.compressionCounters
+	config := c.sock.Config
+
+	atomic.AddUint64(&counters.framesSent, 1)
+	atomic.AddUint64(&counters.bytesSentRaw, uint64(len(frame)))
+
+	out, compressed := frame, false
+
+	if c.compressor != nil && len(frame) >= config.CompressionThreshold {
+		data, err := c.compressor.Compress(frame, config.CompressionLevel)
+		if err == nil && c.wireSize(data, true) < len(frame) {
+			out, compressed = data, true
+			atomic.AddUint64(&counters.framesCompressed, 1)
+		}
+	}
+
+	atomic.AddUint64(&counters.bytesSentWire, uint64(c.wireSize(out, compressed)))
+
+	return out, compressed
+}
+
+/**
+ * SocketClient.decompressFrame([]byte, bool) ([]byte, errors.Error)
+ */
+func (c *SocketClient) decompressFrame(frame []byte, compressed bool) ([]byte, errors.Error) {
+	counters := c.compressionCounters
+
+	atomic.AddUint64(&counters.framesReceived, 1)
+	atomic.AddUint64(&counters.bytesReceivedWire, uint64(c.wireSize(frame, compressed)))
+
+	if compressed {
+		if c.compressor == nil {
+			return nil, errors.New(SOCKET_ERR_COMPRESSION, "Compressed frame received, but compression has not been negotiated.")
+		}
+
+		data, err := c.compressor.Decompress(frame, c.sock.Config.MaxMessageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		frame = data
+		atomic.AddUint64(&counters.framesDecompressed, 1)
+	}
+
+	atomic.AddUint64(&counters.bytesReceivedRaw, uint64(len(frame)))
+
+	return frame, nil
+}
+
+/**
+ * SocketClient.wireSize([]byte, bool) int
+ *
+ * Size of frame payload on the wire, compressed frames of line codecs travel base64 encoded behind a marker.
+ */
+func (c *SocketClient) wireSize(frame []byte, compressed bool) int {
+	if compressed && !c.codec.IsBinary() {
+		return 1 + base64.StdEncoding.EncodedLen(len(frame))
+	}
+
+	return len(frame)
+}
@@ -0,0 +1,125 @@
+package tcp
+
+import (
+	"time"
+	"bytes"
+	"strings"
+	"testing"
+	"compress/flate"
+	"../storage"
+)
+
+func TestCompressorsRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("log line with stuff ", 1000))
+
+	for _, name := range []string{COMPRESSION_GZIP, COMPRESSION_DEFLATE} {
+		compressor := GetCompressor(name)
+
+		packed, err := compressor.Compress(data, flate.DefaultCompression)
+		if err != nil {
+			t.Fatalf("%s: compress: %s", name, err.GetMessage())
+		}
+		if len(packed) >= len(data) {
+			t.Errorf("%s: data has not been compressed, %d bytes", name, len(packed))
+		}
+
+		unpacked, err := compressor.Decompress(packed, 0)
+		if err != nil || !bytes.Equal(unpacked, data) {
+			t.Errorf("%s: unexpected result of decompression %v", name, err)
+		}
+	}
+}
+
+func TestDecompressionIsCapped(t *testing.T) {
+	bomb := []byte(strings.Repeat("a", 5 << 20))
+
+	for _, name := range []string{COMPRESSION_GZIP, COMPRESSION_DEFLATE} {
+		compressor := GetCompressor(name)
+		packed, _ := compressor.Compress(bomb, flate.BestCompression)
+
+		if _, err := compressor.Decompress(packed, 1 << 20); err == nil || err.GetCode() != SOCKET_ERR_MESSAGE_TOO_LARGE {
+			t.Errorf("%s: frame inflating over limit returned %v", name, err)
+		}
+		if _, err := compressor.Decompress(packed, len(bomb)); err != nil {
+			t.Errorf("%s: frame at limit has been refused: %s", name, err.GetMessage())
+		}
+	}
+}
+
+func TestCompressionIsNegotiated(t *testing.T) {
+	got := make(chan int, 4)
+
+	srv := CreateSocket()
+	srv.Config.Compression = []string{COMPRESSION_GZIP, COMPRESSION_DEFLATE}
+	srv.Config.MaxMessageSize = 1 << 20
+	srv.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		got <- len(m.GetRecord().Get("P"))
+	})
+	if err := srv.Listen("127.0.0.1", "19301"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	cases := []struct {
+		offered		[]string
+		algorithm	string
+	}{
+		{[]string{}, ""},
+		{[]string{"zstd", COMPRESSION_DEFLATE}, COMPRESSION_DEFLATE},
+		{[]string{COMPRESSION_GZIP}, COMPRESSION_GZIP},
+	}
+
+	for _, tc := range cases {
+		cl := CreateSocket()
+		cl.Config.Compression = tc.offered
+		if err := cl.Connect("127.0.0.1", "19301"); err != nil {
+			t.Fatalf("%v: connect: %s", tc.offered, err.GetMessage())
+		}
+
+		record := storage.CreateDataRecord()
+		record.Set("P", strings.Repeat("log line with stuff ", 10000))
+		cl.WriteMessage(cl.Conn.Client, CreateSocketMessage("MSG", record))
+
+		select {
+			case size := <-got:
+				if size != 200000 {
+					t.Errorf("%v: received %d bytes", tc.offered, size)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("%v: message has not arrived", tc.offered)
+		}
+
+		stats := cl.Conn.Client.GetCompressionStats()
+		if stats.Algorithm != tc.algorithm || (tc.algorithm != "") != (stats.FramesCompressed > 0) {
+			t.Errorf("%v: unexpected stats %+v", tc.offered, stats)
+		}
+
+		cl.Close()
+	}
+
+	// peer sending frame which inflates over MaxMessageSize is disconnected
+	reasons := make(chan string, 1)
+
+	cl := CreateSocket()
+	cl.Config.Compression = []string{COMPRESSION_GZIP}
+	cl.OnDisconnect(func(c *SocketClient) {
+		reasons <- c.GetCloseReason()
+	})
+	if err := cl.Connect("127.0.0.1", "19301"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	record := storage.CreateDataRecord()
+	record.Set("P", strings.Repeat("a", 5 << 20))
+	cl.WriteMessage(cl.Conn.Client, CreateSocketMessage("MSG", record))
+
+	select {
+		case <-reasons:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("peer has not been disconnected")
+	}
+	if len(got) != 0 {
+		t.Errorf("oversized message has been dispatched")
+	}
+}
@@ -0,0 +1,282 @@
+package tcp
+
+import (
+	"time"
+	"strings"
+	"strconv"
+	"../storage"
+	"../errors"
+)
+
+const (
+	PROTOCOL_VERSION			 int = 1
+	PROTOCOL_LEGACY				 int = 0
+)
+
+const (
+	FEATURE_HEARTBEAT			 string = "heartbeat"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketHandshake class
+ *
+ * Result of the connection handshake, as seen from our side of connection.
+ */
+type SocketHandshake struct {
+	Version		int
+	Node		string
+	Codec		string
+	Features	[]string
+	Compression	string
+}
+
+/**
+ * SocketHandshake constructor
+ */
+func CreateSocketHandshake() *SocketHandshake {
+	handshake := &SocketHandshake{}
+
+	handshake.Version     = PROTOCOL_LEGACY
+	handshake.Node        = ""
+	handshake.Codec       = CODEC_TEXT
+	handshake.Features    = []string{}
+	handshake.Compression = ""
+
+	return handshake
+}
+
+/**
+ * SocketHandshake.IsLegacy() bool
+ */
+func (h *SocketHandshake) IsLegacy() bool {
+	return h.Version == PROTOCOL_LEGACY
+}
+
+/**
+ * SocketHandshake.HasFeature(string) bool
+ */
+func (h *SocketHandshake) HasFeature(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.offerHandshake(*SocketClient) errors.Error
+ *
+ * Client side of the handshake. Sends HELLO and waits for WELCOME or REJECT. Legacy servers do not take part in the
+ * handshake at all, so any other reply, or no reply within LegacyTimeout, leaves the connection on text codec. Such
+ * reply is kept and dispatched as a regular message once reading of the connection starts.
+ */
+func (sock *Socket) offerHandshake(c *SocketClient) errors.Error {
+	config := sock.Config
+
+	record := storage.CreateDataRecord()
+	record.Set(MESSAGE_VERSION, strconv.Itoa(PROTOCOL_VERSION))
+	record.Set(MESSAGE_NODE, config.Node)
+	record.Set(MESSAGE_CODECS, joinList(config.Codecs))
+	record.Set(MESSAGE_FEATURES, joinList(config.Features))
+	record.Set(MESSAGE_COMPRESSION, joinList(config.Compression))
+
+	if err := c.WriteMessage(CreateSocketMessage(SOCKET_HELLO, record)); err != nil {
+		return err
+	}
+
+	// legacy servers stay silent until asked, waiting for them the whole handshake timeout would only delay the fallback
+	timeout := config.HandshakeTimeout
+	if config.AllowLegacy && config.LegacyTimeout > 0 && config.LegacyTimeout < timeout {
+		timeout = config.LegacyTimeout
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	message, err := c.ReadMessage()
+	if err != nil && err.GetCode() == SOCKET_ERR_TIMEOUT && config.AllowLegacy {
+		c.handshake = CreateSocketHandshake()
+		return nil
+	}
+	if err != nil {
+		return errors.New(SOCKET_ERR_HANDSHAKE, err.GetMessage())
+	}
+
+	switch message.GetCmd() {
+		case SOCKET_WELCOME:
+			if err := sock.applyHandshake(c, message.GetRecord()); err != nil {
+				return err
+			}
+			if message.GetRecord().Get(MESSAGE_AUTH) != "" {
+				return sock.answerAuth(c, message.GetRecord())
+			}
+			return nil
+
+		case SOCKET_REJECT:
+			code, _ := strconv.Atoi(message.GetRecord().Get(MESSAGE_CODE))
+			if code == 0 {
+				code = SOCKET_ERR_REJECTED
+			}
+			return errors.New(code, message.GetRecord().Get(MESSAGE_REASON))
+
+		default:
+			if !config.AllowLegacy {
+				return errors.New(SOCKET_ERR_INCOMPATIBLE, "Server does not support handshake.")
+			}
+			c.handshake = CreateSocketHandshake()
+			c.pending = message
+	}
+
+	return nil
+}
+
+/**
+ * Socket.acceptHandshake(*SocketClient) errors.Error
+ *
+ * Server side of the handshake. Clients which start talking without HELLO are legacy ones, their first message is
+ * dispatched as usual once reading of the connection starts and the connection stays on text codec.
+ */
+func (sock *Socket) acceptHandshake(c *SocketClient) errors.Error {
+	config := sock.Config
+
+	// legacy clients may stay silent, unless server requires them to authenticate first
+	if !config.AllowLegacy || sock.requiresAuth() {
+		c.conn.SetReadDeadline(time.Now().Add(config.HandshakeTimeout))
+		defer c.conn.SetReadDeadline(time.Time{})
+	}
+
+	message, err := c.ReadMessage()
+	if err != nil {
+		if err.GetCode() == SOCKET_ERR_TIMEOUT && sock.requiresAuth() {
+			return sock.rejectHandshake(c, SOCKET_ERR_UNAUTHORIZED, "Authentication timed out.")
+		}
+		return err
+	}
+
+	if message.GetCmd() != SOCKET_HELLO {
+		if !config.AllowLegacy || sock.requiresAuth() {
+			return sock.rejectHandshake(c, SOCKET_ERR_INCOMPATIBLE, "Handshake is required.")
+		}
+		c.handshake = CreateSocketHandshake()
+		c.pending = message
+		return nil
+	}
+
+	hello := message.GetRecord()
+
+	version, _ := strconv.Atoi(hello.Get(MESSAGE_VERSION))
+	if version != PROTOCOL_VERSION {
+		return sock.rejectHandshake(c, SOCKET_ERR_INCOMPATIBLE, "Unsupported protocol version " + hello.Get(MESSAGE_VERSION) + ".")
+	}
+
+	codec := SelectCodec(splitList(hello.Get(MESSAGE_CODECS)), config.Codecs)
+	if codec == nil {
+		return sock.rejectHandshake(c, SOCKET_ERR_INCOMPATIBLE, "No common codec.")
+	}
+
+	record := storage.CreateDataRecord()
+	record.Set(MESSAGE_VERSION, strconv.Itoa(PROTOCOL_VERSION))
+	record.Set(MESSAGE_NODE, config.Node)
+	record.Set(MESSAGE_CODEC, codec.GetName())
+	record.Set(MESSAGE_FEATURES, joinList(intersectList(splitList(hello.Get(MESSAGE_FEATURES)), config.Features)))
+
+	if compressor := SelectCompressor(splitList(hello.Get(MESSAGE_COMPRESSION)), config.Compression); compressor != nil {
+		record.Set(MESSAGE_COMPRESSION, compressor.GetName())
+	}
+
+	challenge := ""
+	if sock.requiresAuth() {
+		challenge = createChallenge()
+		record.Set(MESSAGE_AUTH, joinList(config.Auth.GetMethods()))
+		record.Set(MESSAGE_CHALLENGE, challenge)
+	}
+
+	if err := c.WriteMessage(CreateSocketMessage(SOCKET_WELCOME, record)); err != nil {
+		return err
+	}
+
+	record.Set(MESSAGE_NODE, hello.Get(MESSAGE_NODE))
+
+	if err := sock.applyHandshake(c, record); err != nil {
+		return err
+	}
+
+	if challenge != "" {
+		return sock.challengeAuth(c, challenge)
+	}
+
+	return nil
+}
+
+/**
+ * Socket.applyHandshake(*SocketClient, *storage.DataRecord) errors.Error
+ */
+func (sock *Socket) applyHandshake(c *SocketClient, record *storage.DataRecord) errors.Error {
+	codec := GetCodec(record.Get(MESSAGE_CODEC))
+	if codec == nil {
+		return errors.New(SOCKET_ERR_INCOMPATIBLE, "Peer selected unsupported codec.")
+	}
+
+	handshake := CreateSocketHandshake()
+	handshake.Version, _  = strconv.Atoi(record.Get(MESSAGE_VERSION))
+	handshake.Node        = record.Get(MESSAGE_NODE)
+	handshake.Codec       = codec.GetName()
+	handshake.Features    = splitList(record.Get(MESSAGE_FEATURES))
+	handshake.Compression = record.Get(MESSAGE_COMPRESSION)
+
+	compressor := GetCompressor(handshake.Compression)
+	if handshake.Compression != "" && compressor == nil {
+		return errors.New(SOCKET_ERR_INCOMPATIBLE, "Peer selected unsupported compression.")
+	}
+
+	c.SetCodec(codec)
+	c.compressor = compressor
+	c.handshake = handshake
+
+	return nil
+}
+
+/**
+ * Socket.rejectHandshake(*SocketClient, int, string) errors.Error
+ */
+func (sock *Socket) rejectHandshake(c *SocketClient, code int, reason string) errors.Error {
+	record := storage.CreateDataRecord()
+	record.Set(MESSAGE_CODE, strconv.Itoa(code))
+	record.Set(MESSAGE_REASON, reason)
+
+	c.WriteMessage(CreateSocketMessage(SOCKET_REJECT, record))
+
+	return errors.New(code, reason)
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+func joinList(list []string) string {
+	return strings.Join(list, ";")
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+
+	return strings.Split(list, ";")
+}
+
+func intersectList(a []string, b []string) []string {
+	list := []string{}
+
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				list = append(list, x)
+				break
+			}
+		}
+	}
+
+	return list
+}
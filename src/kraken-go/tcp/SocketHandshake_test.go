@@ -0,0 +1,127 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"bufio"
+	"strings"
+	"strconv"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+func listenLegacy(t *testing.T, port string, greeting string) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:" + port)
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	lines := make(chan string, 8)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		if greeting != "" {
+			conn.Write([]byte(greeting))
+		}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+
+	return listener, lines
+}
+
+func TestHandshakeFallsBackOnSilentLegacyServer(t *testing.T) {
+	listener, lines := listenLegacy(t, "19201", "")
+	defer listener.Close()
+
+	cl := CreateSocket()
+	cl.Config.HandshakeTimeout = 5 * time.Second
+	cl.Config.LegacyTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	if err := cl.Connect("127.0.0.1", "19201"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	if elapsed := time.Since(start); elapsed > 2 * time.Second {
+		t.Errorf("fallback took %s", elapsed)
+	}
+	if !cl.Conn.Client.GetHandshake().IsLegacy() {
+		t.Fatalf("connection is not legacy: %+v", cl.Conn.Client.GetHandshake())
+	}
+
+	record := storage.CreateDataRecord()
+	record.Set("TXT", "hi")
+	cl.WriteMessage(cl.Conn.Client, CreateSocketMessage("MSG", record))
+
+	<-lines
+	if line := <-lines; line != "[MSG]TXT=hi" {
+		t.Errorf("unexpected legacy frame %q", line)
+	}
+}
+
+func TestHandshakeDispatchesFirstLegacyFrameAfterSetup(t *testing.T) {
+	listener, _ := listenLegacy(t, "19202", "[MSG]TXT=first\n")
+	defer listener.Close()
+
+	ready := make(chan bool, 1)
+
+	cl := CreateSocket()
+	cl.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		ready <- cl.Conn != nil && cl.Conn.Client == c && m.GetRecord().Get("TXT") == "first"
+	})
+
+	if err := cl.Connect("127.0.0.1", "19202"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	select {
+		case ok := <-ready:
+			if !ok {
+				t.Errorf("first legacy frame has been dispatched before connection was set up")
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("first legacy frame has not been dispatched")
+	}
+}
+
+func TestHandshakeDispatchesFirstFrameOfLegacyClient(t *testing.T) {
+	srv := CreateSocket()
+	srv.Handle("PING", func(c *SocketClient, m *SocketMessage) errors.Error {
+		record := storage.CreateDataRecord()
+		record.Set("CLIENTS", strconv.Itoa(srv.Conn.Clients.Count()))
+		return srv.WriteMessage(c, CreateSocketMessage("PONG", record))
+	})
+	if err := srv.Listen("127.0.0.1", "19203"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19203")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("[PING]\n"))
+
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	if strings.TrimSpace(line) != "[PONG]CLIENTS=1" {
+		t.Errorf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,131 @@
+package tcp
+
+import (
+	"time"
+	"sync/atomic"
+	"../storage"
+)
+
+const (
+	CLOSE_REASON_PEER			 string = "closed by peer"
+	CLOSE_REASON_LOCAL			 string = "closed locally"
+	CLOSE_REASON_HEARTBEAT		 string = "heartbeat timeout"
+	CLOSE_REASON_IDLE			 string = "idle timeout"
+	CLOSE_REASON_READ_TIMEOUT	 string = "read timeout"
+	CLOSE_REASON_SHUTDOWN		 string = "socket shutdown"
+	CLOSE_REASON_GOODBYE		 string = "peer shutdown"
+	CLOSE_REASON_WRITE_ERROR	 string = "write error"
+	CLOSE_REASON_SLOW_CONSUMER	 string = "send queue full"
+	CLOSE_REASON_MESSAGE_TOO_LARGE string = "message too large"
+)
+
+/**
+ * SocketClient.GetCloseReason() string
+ */
+func (c *SocketClient) GetCloseReason() string {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	return c.closeReason
+}
+
+/**
+ * SocketClient.closeWithReason(string)
+ *
+ * Closes connection remembering why. Only the first reason given is kept.
+ */
+func (c *SocketClient) closeWithReason(reason string) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+/**
+ * SocketClient.touch(bool)
+ *
+ * Records that a frame has been received. Heartbeat frames keep connection alive, but do not count as activity for
+ * idle timeout.
+ */
+func (c *SocketClient) touch(activity bool) {
+	now := time.Now().UnixNano()
+
+	atomic.StoreInt64(&c.lastSeen, now)
+	if activity {
+		atomic.StoreInt64(&c.lastActive, now)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.handleHeartbeat(*SocketClient, *SocketMessage) bool
+ *
+ * Answers PING frames and swallows PONG ones. Returns false for any other frame.
+ */
+func (sock *Socket) handleHeartbeat(c *SocketClient, m *SocketMessage) bool {
+	switch m.GetCmd() {
+		case SOCKET_PING:
+			c.WriteMessage(CreateSocketMessage(SOCKET_PONG, storage.CreateDataRecord()))
+			return true
+		case SOCKET_PONG:
+			return true
+	}
+
+	return false
+}
+
+/**
+ * Socket.watchConnection(*SocketClient, chan struct{})
+ *
+ * Sends PING when peer has been silent for a heartbeat interval and closes the connection once it missed configured
+ * number of them or stayed idle for too long. Heartbeats are sent only to peers which negotiated them in handshake.
+ */
+func (sock *Socket) watchConnection(c *SocketClient, stop chan struct{}) {
+	config := sock.Config
+
+	heartbeat := config.HeartbeatInterval > 0 && c.HasFeature(FEATURE_HEARTBEAT)
+	if !heartbeat && config.IdleTimeout <= 0 {
+		return
+	}
+
+	tick := config.HeartbeatInterval
+	if !heartbeat || (config.IdleTimeout > 0 && config.IdleTimeout < tick) {
+		tick = config.IdleTimeout
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-stop:
+				return
+			case <-ticker.C:
+		}
+
+		now := time.Now()
+
+		if config.IdleTimeout > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastActive))) >= config.IdleTimeout {
+			c.closeWithReason(CLOSE_REASON_IDLE)
+			return
+		}
+
+		if !heartbeat {
+			continue
+		}
+
+		silence := now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastSeen)))
+		if silence >= time.Duration(config.HeartbeatMisses) * config.HeartbeatInterval {
+			c.closeWithReason(CLOSE_REASON_HEARTBEAT)
+			return
+		}
+		if silence >= config.HeartbeatInterval {
+			c.WriteMessage(CreateSocketMessage(SOCKET_PING, storage.CreateDataRecord()))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"testing"
+)
+
+func expectCloseReason(t *testing.T, stopped chan string, want string, within time.Duration) {
+	select {
+		case reason := <-stopped:
+			if reason != want {
+				t.Errorf("connection closed with %q, want %q", reason, want)
+			}
+		case <-time.After(within):
+			t.Fatalf("connection has not been closed within %s", within)
+	}
+}
+
+func TestHeartbeatClosesSilentPeer(t *testing.T) {
+	stopped := make(chan string, 4)
+
+	srv := CreateSocket()
+	srv.Config.HeartbeatInterval = 100 * time.Millisecond
+	srv.Config.HeartbeatMisses = 2
+	srv.OnClientStop(func(c *SocketClient) {
+		stopped <- c.GetCloseReason()
+	})
+	if err := srv.Listen("127.0.0.1", "19241"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	// peer negotiates heartbeat but never answers PING
+	conn, err := net.Dial("tcp", "127.0.0.1:19241")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("[HELLO]VERSION=1,CODECS=text,FEATURES=heartbeat\n"))
+
+	expectCloseReason(t, stopped, CLOSE_REASON_HEARTBEAT, 2 * time.Second)
+
+	// peer answering PING stays connected
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19241"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	select {
+		case reason := <-stopped:
+			t.Errorf("responsive peer has been closed with %q", reason)
+		case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestIdleTimeoutClosesQuietPeer(t *testing.T) {
+	stopped := make(chan string, 4)
+
+	srv := CreateSocket()
+	srv.Config.IdleTimeout = 200 * time.Millisecond
+	srv.OnClientStop(func(c *SocketClient) {
+		stopped <- c.GetCloseReason()
+	})
+	if err := srv.Listen("127.0.0.1", "19242"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	// heartbeats keep connection alive, but they do not count as activity
+	cl := CreateSocket()
+	cl.Config.HeartbeatInterval = 50 * time.Millisecond
+	if err := cl.Connect("127.0.0.1", "19242"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	expectCloseReason(t, stopped, CLOSE_REASON_IDLE, 2 * time.Second)
+}
@@ -0,0 +1,165 @@
+package tcp
+
+import (
+	"net"
+	"sync"
+	"time"
+	"math"
+	"bufio"
+	"strconv"
+	"../errors"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketRateLimiter class
+ *
+ * Token bucket, refilled with rate tokens per second up to burst tokens.
+ */
+type SocketRateLimiter struct {
+	lock		sync.Mutex
+	rate		float64
+	burst		float64
+	tokens		float64
+	last		time.Time
+}
+
+/**
+ * SocketRateLimiter constructor
+ */
+func CreateSocketRateLimiter(rate float64, burst int) *SocketRateLimiter {
+	limiter := &SocketRateLimiter{}
+
+	limiter.rate   = rate
+	limiter.burst  = float64(burst)
+	limiter.last   = time.Now()
+
+	if limiter.burst < 1 {
+		limiter.burst = math.Max(1, math.Ceil(rate))
+	}
+	limiter.tokens = limiter.burst
+
+	return limiter
+}
+
+/**
+ * SocketRateLimiter.GetRate() float64
+ */
+func (limiter *SocketRateLimiter) GetRate() float64 {
+	return limiter.rate
+}
+
+/**
+ * SocketRateLimiter.Allow() bool
+ *
+ * Takes one token from the bucket, returns false when it is empty.
+ */
+func (limiter *SocketRateLimiter) Allow() bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+
+	limiter.tokens = math.Min(limiter.burst, limiter.tokens + now.Sub(limiter.last).Seconds() * limiter.rate)
+	limiter.last   = now
+
+	if limiter.tokens < 1 {
+		return false
+	}
+
+	limiter.tokens--
+
+	return true
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketClient.GetRemoteIP() string
+ *
+ * Returns empty string for connections without IP address, such as unix sockets.
+ */
+func (c *SocketClient) GetRemoteIP() string {
+	host, _, err := net.SplitHostPort(c.remoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
+
+/**
+ * SocketClient.readLine(int) ([]byte, errors.Error)
+ *
+ * Reads newline terminated frame, failing once it grows over limit instead of buffering it whole.
+ */
+func (c *SocketClient) readLine(limit int) ([]byte, errors.Error) {
+	var line []byte
+
+	for {
+		chunk, err := c.cout.ReadSlice('\n')
+
+		if limit > 0 && len(line) + len(chunk) > limit + 1 {
+			return nil, frameTooLarge(limit)
+		}
+		line = append(line, chunk...)
+
+		if err == nil {
+			return line, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, readError(err)
+		}
+	}
+}
+
+func frameTooLarge(limit int) errors.Error {
+	return errors.New(SOCKET_ERR_MESSAGE_TOO_LARGE, "Message exceeds limit of " + strconv.Itoa(limit) + " bytes.")
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.checkLimits(*SocketClient) errors.Error
+ *
+ * Must be called with socket lock held.
+ */
+func (sock *Socket) checkLimits(c *SocketClient) errors.Error {
+	config := sock.Config
+
+	if config.MaxConnections > 0 && len(sock.conns) >= config.MaxConnections {
+		return errors.New(SOCKET_ERR_TOO_MANY_CONNECTIONS, "Limit of " + strconv.Itoa(config.MaxConnections) + " connections reached.")
+	}
+
+	ip := c.GetRemoteIP()
+	if config.MaxConnectionsPerIP > 0 && ip != "" && sock.perIP[ip] >= config.MaxConnectionsPerIP {
+		return errors.New(SOCKET_ERR_TOO_MANY_CONNECTIONS, "Limit of " + strconv.Itoa(config.MaxConnectionsPerIP) + " connections from " + ip + " reached.")
+	}
+
+	return nil
+}
+
+/**
+ * Socket.refuseConnection(*SocketClient, errors.Error)
+ *
+ * Tells peer over the limits why it is refused and drops it.
+ */
+func (sock *Socket) refuseConnection(c *SocketClient, err errors.Error) {
+	sock.Events.Violation(c, err)
+
+	if c.handshakeTLS(sock.Config.HandshakeTimeout) == nil {
+		c.conn.SetWriteDeadline(time.Now().Add(sock.Config.HandshakeTimeout))
+		sock.rejectHandshake(c, err.GetCode(), err.GetMessage())
+	}
+
+	c.closeWithReason(err.GetMessage())
+}
+
+/**
+ * Socket.createRateLimiter() *SocketRateLimiter
+ */
+func (sock *Socket) createRateLimiter() *SocketRateLimiter {
+	if sock.Config.RateLimit <= 0 {
+		return nil
+	}
+
+	return CreateSocketRateLimiter(sock.Config.RateLimit, sock.Config.RateBurst)
+}
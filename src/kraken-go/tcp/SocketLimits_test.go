@@ -0,0 +1,152 @@
+package tcp
+
+import (
+	"time"
+	"strings"
+	"context"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+func TestMaxMessageSizeRejectsLargeFrames(t *testing.T) {
+	violations := make(chan int, 8)
+
+	srv := CreateSocket()
+	srv.Config.MaxMessageSize = 1024
+	srv.OnViolation(func(c *SocketClient, err errors.Error) {
+		violations <- err.GetCode()
+	})
+	if err := srv.Listen("127.0.0.1", "19271"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	// length prefixed frame is refused before its body is read
+	for _, codec := range []string{CODEC_JSON, CODEC_MSGPACK} {
+		reasons := make(chan string, 1)
+
+		cl := CreateSocket()
+		cl.Config.Codecs = []string{codec}
+		cl.OnDisconnect(func(c *SocketClient) {
+			reasons <- c.GetCloseReason()
+		})
+		if err := cl.Connect("127.0.0.1", "19271"); err != nil {
+			t.Fatalf("%s: connect: %s", codec, err.GetMessage())
+		}
+
+		record := storage.CreateDataRecord()
+		record.Set("P", strings.Repeat("x", 4096))
+		cl.WriteMessage(cl.Conn.Client, CreateSocketMessage("MSG", record))
+
+		select {
+			case <-reasons:
+			case <-time.After(3 * time.Second):
+				t.Errorf("%s: connection has not been closed", codec)
+		}
+		expectViolation(t, violations, SOCKET_ERR_MESSAGE_TOO_LARGE)
+
+		cl.Close()
+	}
+
+	// text line is refused once it exceeds the limit, without waiting for its end
+	conn, reader := dialLegacy(t, "19271")
+	defer conn.Close()
+
+	if line := exchangeLegacy(conn, reader, "[HELLO]VERSION=1,CODECS=text"); !strings.HasPrefix(line, "[WELCOME]") {
+		t.Fatalf("unexpected reply %q", line)
+	}
+
+	conn.Write([]byte("[MSG]TXT=" + strings.Repeat("y", 100000)))
+	line, _ := reader.ReadString('\n')
+	if !strings.Contains(line, "CODE=22") {
+		t.Errorf("unexpected reply %q", line)
+	}
+	expectViolation(t, violations, SOCKET_ERR_MESSAGE_TOO_LARGE)
+}
+
+func expectViolation(t *testing.T, violations chan int, want int) {
+	select {
+		case code := <-violations:
+			if code != want {
+				t.Errorf("unexpected violation %d, want %d", code, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("violation %d has not been reported", want)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	srv := CreateSocket()
+	srv.Config.MaxConnections = 3
+	srv.Config.MaxConnectionsPerIP = 2
+	if err := srv.Listen("127.0.0.1", "19272"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	connect := func() (*Socket, errors.Error) {
+		cl := CreateSocket()
+		return cl, cl.Connect("127.0.0.1", "19272")
+	}
+
+	a, err := connect()
+	if err != nil {
+		t.Fatalf("first connection: %s", err.GetMessage())
+	}
+	defer a.Close()
+
+	b, err := connect()
+	if err != nil {
+		t.Fatalf("second connection: %s", err.GetMessage())
+	}
+
+	if _, err := connect(); err == nil || err.GetCode() != SOCKET_ERR_TOO_MANY_CONNECTIONS {
+		t.Errorf("connection over per address limit returned %v", err)
+	}
+
+	b.Close()
+	for i := 0; i < 100 && srv.Conn.Clients.Count() > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c, err := connect()
+	if err != nil {
+		t.Fatalf("connection after another one left: %s", err.GetMessage())
+	}
+	c.Close()
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := CreateSocket()
+	srv.Config.RateLimit = 20
+	srv.Config.RateBurst = 5
+	srv.RegisterMethod("PING", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		return nil, nil
+	})
+	if err := srv.Listen("127.0.0.1", "19273"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19273"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	limited := 0
+	for i := 0; i < 20; i++ {
+		if _, err := cl.Call(context.Background(), "PING", nil); err != nil && err.GetCode() == SOCKET_ERR_RATE_LIMITED {
+			limited++
+		}
+	}
+	if limited == 0 {
+		t.Errorf("burst over rate limit has not been limited")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if _, err := cl.Call(context.Background(), "PING", nil); err != nil {
+		t.Errorf("call after refill failed: %s", err.GetMessage())
+	}
+}
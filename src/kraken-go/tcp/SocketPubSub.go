@@ -0,0 +1,355 @@
+package tcp
+
+import (
+	"sync"
+	"strings"
+	"context"
+	"../storage"
+	"../errors"
+)
+
+const (
+	TOPIC_SEPARATOR				 string = "."
+	TOPIC_ANY_SEGMENT			 string = "*"
+	TOPIC_ANY_SUFFIX			 string = "#"
+)
+
+/**
+ * SocketTopicHandler
+ *
+ * Receives events published to topic matching subscribed pattern. Client is the publisher when event came from
+ * connection of listening socket, nil otherwise.
+ */
+type SocketTopicHandler func(c *SocketClient, topic string, record *storage.DataRecord)
+
+/**
+ * SocketSubscription class
+ */
+type SocketSubscription struct {
+	Pattern		string
+	Handler		SocketTopicHandler
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketPubSub class
+ *
+ * Topic based publish/subscribe on top of Socket. Topics are dot separated, in patterns * matches exactly one segment
+ * and # matches any number of trailing segments. Listening socket fans events out to remote subscribers and to its
+ * local handlers, connecting socket forwards subscriptions and publications to the server. Events of one publisher
+ * reach every subscriber in the order they have been published.
+ */
+type SocketPubSub struct {
+	sock		*Socket
+	lock		sync.RWMutex
+	remote		map[*SocketClient]map[string]bool
+	local		[]*SocketSubscription
+}
+
+/**
+ * SocketPubSub constructor
+ */
+func CreateSocketPubSub(sock *Socket) *SocketPubSub {
+	ps := &SocketPubSub{}
+
+	ps.sock   = sock
+	ps.remote = map[*SocketClient]map[string]bool{}
+	ps.local  = []*SocketSubscription{}
+
+	sock.rpc.Register(SOCKET_SUBSCRIBE, ps.handleSubscribe)
+	sock.rpc.Register(SOCKET_UNSUBSCRIBE, ps.handleUnsubscribe)
+	sock.rpc.Register(SOCKET_PUBLISH, ps.handlePublish)
+
+	sock.router.Handle(SOCKET_SUBSCRIBE, notifyHandler(ps.handleSubscribe))
+	sock.router.Handle(SOCKET_UNSUBSCRIBE, notifyHandler(ps.handleUnsubscribe))
+	sock.router.Handle(SOCKET_PUBLISH, notifyHandler(ps.handlePublish))
+	sock.router.Handle(SOCKET_EVENT, ps.handleEvent)
+
+	return ps
+}
+
+/**
+ * SocketPubSub.Subscribe(*SocketClient, string, SocketTopicHandler) errors.Error
+ *
+ * Registers local handler. When client is given, subscription is forwarded to the server and confirmed by it first.
+ */
+func (ps *SocketPubSub) Subscribe(c *SocketClient, pattern string, handler SocketTopicHandler) errors.Error {
+	if err := validatePattern(pattern); err != nil {
+		return err
+	}
+
+	if c != nil {
+		record := storage.CreateDataRecord()
+		record.Set(MESSAGE_PATTERN, pattern)
+
+		if _, err := ps.sock.rpc.Call(context.Background(), c, SOCKET_SUBSCRIBE, record); err != nil {
+			return err
+		}
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.local = append(ps.local, &SocketSubscription{pattern, handler})
+
+	return nil
+}
+
+/**
+ * SocketPubSub.Unsubscribe(*SocketClient, string) errors.Error
+ *
+ * Removes every local handler of the pattern.
+ */
+func (ps *SocketPubSub) Unsubscribe(c *SocketClient, pattern string) errors.Error {
+	ps.lock.Lock()
+	local := []*SocketSubscription{}
+	for _, subscription := range ps.local {
+		if subscription.Pattern != pattern {
+			local = append(local, subscription)
+		}
+	}
+	ps.local = local
+	ps.lock.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	record := storage.CreateDataRecord()
+	record.Set(MESSAGE_PATTERN, pattern)
+
+	_, err := ps.sock.rpc.Call(context.Background(), c, SOCKET_UNSUBSCRIBE, record)
+
+	return err
+}
+
+/**
+ * SocketPubSub.Publish(*SocketClient, string, *storage.DataRecord) errors.Error
+ *
+ * Sends event to the server when client is given, otherwise fans it out to subscribers of this socket.
+ */
+func (ps *SocketPubSub) Publish(c *SocketClient, topic string, record *storage.DataRecord) errors.Error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+
+	event := storage.CreateDataRecord()
+	if record != nil {
+		event = event.FromMap(record.ToMap())
+	}
+	event.Set(MESSAGE_TOPIC, topic)
+
+	if c != nil {
+		return ps.sock.WriteMessage(c, CreateSocketMessage(SOCKET_PUBLISH, event))
+	}
+
+	ps.fanOut(nil, event)
+
+	return nil
+}
+
+/**
+ * SocketPubSub.GetSubscriptions(*SocketClient) []string
+ *
+ * Returns patterns remote client has subscribed to.
+ */
+func (ps *SocketPubSub) GetSubscriptions(c *SocketClient) []string {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	patterns := []string{}
+	for pattern := range ps.remote[c] {
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+/**
+ * SocketPubSub.resubscribe(*SocketClient)
+ *
+ * Repeats local subscriptions on fresh connection of connecting socket. Confirmations are not awaited, as this runs
+ * on the goroutine which reads them.
+ */
+func (ps *SocketPubSub) resubscribe(c *SocketClient) {
+	ps.lock.RLock()
+	patterns := map[string]bool{}
+	for _, subscription := range ps.local {
+		patterns[subscription.Pattern] = true
+	}
+	ps.lock.RUnlock()
+
+	for pattern := range patterns {
+		record := storage.CreateDataRecord()
+		record.Set(MESSAGE_PATTERN, pattern)
+
+		c.WriteMessage(CreateSocketMessage(SOCKET_SUBSCRIBE, record))
+	}
+}
+
+/**
+ * SocketPubSub.drop(*SocketClient)
+ */
+func (ps *SocketPubSub) drop(c *SocketClient) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.remote, c)
+}
+
+/**
+ * SocketPubSub.fanOut(*SocketClient, *storage.DataRecord)
+ */
+func (ps *SocketPubSub) fanOut(publisher *SocketClient, event *storage.DataRecord) {
+	topic := event.Get(MESSAGE_TOPIC)
+
+	ps.lock.RLock()
+	subscribers := []*SocketClient{}
+	for c, patterns := range ps.remote {
+		for pattern := range patterns {
+			if MatchTopic(pattern, topic) {
+				subscribers = append(subscribers, c)
+				break
+			}
+		}
+	}
+	handlers := []SocketTopicHandler{}
+	for _, subscription := range ps.local {
+		if MatchTopic(subscription.Pattern, topic) {
+			handlers = append(handlers, subscription.Handler)
+		}
+	}
+	ps.lock.RUnlock()
+
+	message := CreateSocketMessage(SOCKET_EVENT, event)
+	for _, c := range subscribers {
+		ps.sock.WriteMessage(c, message)
+	}
+	for _, handler := range handlers {
+		handler(publisher, topic, event)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketPubSub.handleSubscribe(*SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (ps *SocketPubSub) handleSubscribe(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	pattern := record.Get(MESSAGE_PATTERN)
+	if err := validatePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.remote[c] == nil {
+		ps.remote[c] = map[string]bool{}
+	}
+	ps.remote[c][pattern] = true
+
+	return nil, nil
+}
+
+/**
+ * SocketPubSub.handleUnsubscribe(*SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (ps *SocketPubSub) handleUnsubscribe(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.remote[c], record.Get(MESSAGE_PATTERN))
+
+	return nil, nil
+}
+
+/**
+ * SocketPubSub.handlePublish(*SocketClient, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (ps *SocketPubSub) handlePublish(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if err := validateTopic(record.Get(MESSAGE_TOPIC)); err != nil {
+		return nil, err
+	}
+
+	ps.fanOut(c, record)
+
+	return nil, nil
+}
+
+/**
+ * SocketPubSub.handleEvent(*SocketClient, *SocketMessage) errors.Error
+ */
+func (ps *SocketPubSub) handleEvent(c *SocketClient, m *SocketMessage) errors.Error {
+	topic := m.GetRecord().Get(MESSAGE_TOPIC)
+
+	ps.lock.RLock()
+	handlers := []SocketTopicHandler{}
+	for _, subscription := range ps.local {
+		if MatchTopic(subscription.Pattern, topic) {
+			handlers = append(handlers, subscription.Handler)
+		}
+	}
+	ps.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(nil, topic, m.GetRecord())
+	}
+
+	return nil
+}
+
+/**
+ * notifyHandler(SocketRpcHandler) SocketHandler
+ *
+ * Serves rpc method for frames sent without id, which expect no response.
+ */
+func notifyHandler(handler SocketRpcHandler) SocketHandler {
+	return func(c *SocketClient, m *SocketMessage) errors.Error {
+		_, err := handler(c, m.GetRecord())
+		return err
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * MatchTopic(string, string) bool
+ *
+ * Topics are dot separated segments. In patterns * stands for exactly one segment and trailing # for zero or more of
+ * them, as in AMQP, so process.# matches process itself as well as process.started.
+ */
+func MatchTopic(pattern string, topic string) bool {
+	return matchSegments(strings.Split(pattern, TOPIC_SEPARATOR), strings.Split(topic, TOPIC_SEPARATOR))
+}
+
+func matchSegments(pattern []string, topic []string) bool {
+	for i, segment := range pattern {
+		if segment == TOPIC_ANY_SUFFIX {
+			return true
+		}
+		if i >= len(topic) || (segment != TOPIC_ANY_SEGMENT && segment != topic[i]) {
+			return false
+		}
+	}
+
+	return len(pattern) == len(topic)
+}
+
+func validatePattern(pattern string) errors.Error {
+	segments := strings.Split(pattern, TOPIC_SEPARATOR)
+
+	for i, segment := range segments {
+		if segment == "" || (segment == TOPIC_ANY_SUFFIX && i != len(segments) - 1) {
+			return errors.New(SOCKET_ERR_INVALID_TOPIC, "Invalid topic pattern " + pattern + ".")
+		}
+	}
+
+	return nil
+}
+
+func validateTopic(topic string) errors.Error {
+	if topic == "" || strings.ContainsAny(topic, TOPIC_ANY_SEGMENT + TOPIC_ANY_SUFFIX) {
+		return errors.New(SOCKET_ERR_INVALID_TOPIC, "Invalid topic " + topic + ".")
+	}
+
+	return validatePattern(topic)
+}
@@ -0,0 +1,116 @@
+package tcp
+
+import (
+	"time"
+	"strconv"
+	"testing"
+	"../storage"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern		string
+		topic		string
+		match		bool
+	}{
+		{"process.started", "process.started", true},
+		{"process.started", "process.stopped", false},
+		{"process.*", "process.started", true},
+		{"process.*", "process", false},
+		{"process.*", "process.started.w1", false},
+		{"*.started", "process.started", true},
+		{"*.*", "process", false},
+		{"process.#", "process", true},
+		{"process.#", "process.started", true},
+		{"process.#", "process.started.w1", true},
+		{"process.#", "config.reloaded", false},
+		{"process.*.#", "process", false},
+		{"process.*.#", "process.started.w1", true},
+		{"#", "config.reloaded", true},
+		{"process", "process.started", false},
+	}
+
+	for _, tc := range cases {
+		if MatchTopic(tc.pattern, tc.topic) != tc.match {
+			t.Errorf("MatchTopic(%q, %q) = %v", tc.pattern, tc.topic, !tc.match)
+		}
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	for _, pattern := range []string{"", "a..b", "a.#.b", "."} {
+		if validatePattern(pattern) == nil {
+			t.Errorf("pattern %q has been accepted", pattern)
+		}
+	}
+	for _, topic := range []string{"a.*", "a.#", "#"} {
+		if validateTopic(topic) == nil {
+			t.Errorf("topic %q has been accepted", topic)
+		}
+	}
+	if validatePattern("a.*.#") != nil || validateTopic("a.b") != nil {
+		t.Errorf("valid topic has been rejected")
+	}
+}
+
+func TestPublishFansOutToMatchingSubscribers(t *testing.T) {
+	srv := CreateSocket()
+	if err := srv.Listen("127.0.0.1", "19266"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	connect := func() *Socket {
+		cl := CreateSocket()
+		if err := cl.Connect("127.0.0.1", "19266"); err != nil {
+			t.Fatalf("connect: %s", err.GetMessage())
+		}
+		return cl
+	}
+
+	started := make(chan string, 64)
+	everything := make(chan string, 64)
+
+	a := connect()
+	defer a.Close()
+	b := connect()
+	defer b.Close()
+	publisher := connect()
+	defer publisher.Close()
+
+	a.Subscribe("process.*", func(c *SocketClient, topic string, record *storage.DataRecord) {
+		started <- topic + "/" + record.Get("SEQ")
+	})
+	b.Subscribe("process.#", func(c *SocketClient, topic string, record *storage.DataRecord) {
+		everything <- topic + "/" + record.Get("SEQ")
+	})
+
+	topics := []string{"process", "process.started", "config.reloaded", "process.started.w1"}
+	for i := 0; i < 10; i++ {
+		record := storage.CreateDataRecord()
+		record.Set("SEQ", strconv.Itoa(i))
+		publisher.Publish(topics[i % len(topics)], record)
+	}
+
+	expect := func(name string, events chan string, want []string) {
+		for _, w := range want {
+			select {
+				case got := <-events:
+					if got != w {
+						t.Errorf("%s: got %s, want %s", name, got, w)
+					}
+				case <-time.After(3 * time.Second):
+					t.Fatalf("%s: event %s has not arrived", name, w)
+			}
+		}
+		select {
+			case got := <-events:
+				t.Errorf("%s: unexpected event %s", name, got)
+			case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	expect("process.*", started, []string{"process.started/1", "process.started/5", "process.started/9"})
+	expect("process.#", everything, []string{"process/0", "process.started/1", "process.started.w1/3", "process/4",
+		"process.started/5", "process.started.w1/7", "process/8", "process.started/9"})
+}
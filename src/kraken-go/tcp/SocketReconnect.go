@@ -0,0 +1,177 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"math/rand"
+	"../errors"
+)
+
+/**
+ * Socket.dial() (*SocketClient, errors.Error)
+ *
+ * Opens connection to socket address, secures it when TLS is configured and performs handshake on it.
+ */
+func (sock *Socket) dial() (*SocketClient, errors.Error) {
+	raw, err := net.Dial(sock.Type, sock.address())
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+	}
+
+	conn, cerr := sock.dialTLS(raw)
+	if cerr != nil {
+		raw.Close()
+		return nil, cerr
+	}
+
+	client := CreateSocketClient(sock, conn)
+	if err := client.handshakeTLS(sock.Config.HandshakeTimeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := sock.offerHandshake(client); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+/**
+ * Socket.reconnect(*SocketClient) bool
+ *
+ * Re-establishes lost connection of a connector socket with exponential backoff. The connection is swapped inside
+ * the existing client, so pointers held by callers stay valid. Messages written meanwhile are queued and flushed
+ * after handshake. Returns false when socket has been closed or all attempts failed.
+ */
+func (sock *Socket) reconnect(c *SocketClient) bool {
+	config := sock.Config
+
+	c.startQueue()
+
+	for attempt := 1; config.ReconnectMaxAttempts == 0 || attempt <= config.ReconnectMaxAttempts; attempt++ {
+		select {
+			case <-time.After(sock.backoff(attempt)):
+			case <-sock.done:
+				return false
+		}
+
+		fresh, err := sock.dial()
+		if err != nil {
+			continue
+		}
+
+		if !sock.isOpen() {
+			fresh.Close()
+			return false
+		}
+
+		c.replace(fresh)
+		sock.pubsub.resubscribe(c)
+		sock.Events.Reconnect(c, attempt)
+
+		return true
+	}
+
+	c.dropQueue()
+
+	return false
+}
+
+/**
+ * Socket.backoff(int) time.Duration
+ */
+func (sock *Socket) backoff(attempt int) time.Duration {
+	config := sock.Config
+
+	delay := config.ReconnectDelay
+	for i := 1; i < attempt && delay < config.ReconnectMaxDelay; i++ {
+		delay = delay * 2
+	}
+	if delay > config.ReconnectMaxDelay {
+		delay = config.ReconnectMaxDelay
+	}
+
+	if config.ReconnectJitter > 0 {
+		delay = delay - time.Duration(rand.Float64() * config.ReconnectJitter * float64(delay))
+	}
+
+	return delay
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketClient.startQueue()
+ */
+func (c *SocketClient) startQueue() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.flags.IsReconnecting = true
+}
+
+/**
+ * SocketClient.dropQueue()
+ */
+func (c *SocketClient) dropQueue() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.flags.IsReconnecting = false
+	c.queue = nil
+}
+
+/**
+ * SocketClient.enqueue(*SocketMessage) errors.Error
+ *
+ * Must be called with client lock held.
+ */
+func (c *SocketClient) enqueue(m *SocketMessage) errors.Error {
+	if len(c.queue) >= c.sock.Config.ReconnectQueueSize {
+		return errors.New(SOCKET_ERR_QUEUE_FULL, "Outbound queue is full.")
+	}
+
+	c.queue = append(c.queue, m)
+
+	return nil
+}
+
+/**
+ * SocketClient.replace(*SocketClient)
+ *
+ * Takes over connection of freshly dialed client and flushes messages queued while reconnecting.
+ */
+func (c *SocketClient) replace(fresh *SocketClient) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.connLock.Lock()
+	c.conn        = fresh.conn
+	c.handshake   = fresh.handshake
+	c.closeReason = ""
+	c.connLock.Unlock()
+
+	c.cin         = fresh.cin
+	c.cout        = fresh.cout
+	c.codec       = fresh.codec
+	c.pending     = fresh.pending
+	c.compressor  = fresh.compressor
+	c.remoteAddr  = fresh.remoteAddr
+	c.connectedAt = fresh.connectedAt
+	c.identity    = fresh.identity
+	c.credentials = fresh.credentials
+	c.principal   = fresh.principal
+	c.permissions = fresh.permissions
+
+	queue := c.queue
+	c.queue = nil
+	c.flags.IsReconnecting = false
+
+	for i, m := range queue {
+		if err := c.send(m); err != nil {
+			c.queue = queue[i:]
+			c.flags.IsReconnecting = true
+			break
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package tcp
+
+import (
+	"time"
+	"testing"
+	"../storage"
+)
+
+func createTextMessage(text string) *SocketMessage {
+	record := storage.CreateDataRecord()
+	record.Set("TXT", text)
+
+	return CreateSocketMessage("MSG", record)
+}
+
+func listenCollect(t *testing.T, port string, got chan string) *Socket {
+	srv := CreateSocket()
+	srv.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		got <- m.GetRecord().Get("TXT")
+	})
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	return srv
+}
+
+func expectText(t *testing.T, got chan string, want string) {
+	select {
+		case text := <-got:
+			if text != want {
+				t.Errorf("got %q, want %q", text, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("message %q has not arrived", want)
+	}
+}
+
+func TestReconnectAfterServerRestart(t *testing.T) {
+	got := make(chan string, 16)
+	srv := listenCollect(t, "19231", got)
+
+	reconnected := make(chan int, 1)
+
+	cl := CreateSocket()
+	cl.Config.Reconnect = true
+	cl.Config.ReconnectDelay = 50 * time.Millisecond
+	cl.Config.ReconnectMaxAttempts = 40
+	cl.OnReconnect(func(c *SocketClient, attempt int) {
+		reconnected <- attempt
+	})
+	if err := cl.Connect("127.0.0.1", "19231"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	client := cl.Conn.Client
+	cl.WriteMessage(client, createTextMessage("a"))
+	expectText(t, got, "a")
+
+	srv.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// written while server is down, flushed in order once connection is back
+	if err := cl.WriteMessage(client, createTextMessage("b")); err != nil {
+		t.Fatalf("write while reconnecting: %s", err.GetMessage())
+	}
+	cl.WriteMessage(client, createTextMessage("c"))
+
+	srv = listenCollect(t, "19231", got)
+	defer srv.Close()
+
+	select {
+		case <-reconnected:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("client has not reconnected")
+	}
+
+	expectText(t, got, "b")
+	expectText(t, got, "c")
+
+	if cl.Conn.Client != client {
+		t.Errorf("client has been replaced on reconnect")
+	}
+	cl.WriteMessage(client, createTextMessage("d"))
+	expectText(t, got, "d")
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	got := make(chan string, 16)
+	srv := listenCollect(t, "19232", got)
+
+	stopped := make(chan struct{})
+
+	cl := CreateSocket()
+	cl.Config.Reconnect = true
+	cl.Config.ReconnectDelay = 20 * time.Millisecond
+	cl.Config.ReconnectMaxAttempts = 3
+	cl.OnStop(func() {
+		close(stopped)
+	})
+	if err := cl.Connect("127.0.0.1", "19232"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+
+	srv.Close()
+
+	select {
+		case <-stopped:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("client keeps reconnecting after last attempt")
+	}
+	if cl.IsConnected {
+		t.Errorf("socket is still connected")
+	}
+}
@@ -0,0 +1,108 @@
+package tcp
+
+import (
+	"sync"
+	"strconv"
+)
+
+/**
+ * SocketRegistry class
+ *
+ * Concurrency-safe set of clients connected to listening socket, addressed by their ids.
+ */
+type SocketRegistry struct {
+	lock		sync.RWMutex
+	counter		uint64
+	clients		map[string]*SocketClient
+	order		[]string
+}
+
+/**
+ * SocketRegistry constructor
+ */
+func CreateSocketRegistry() *SocketRegistry {
+	registry := &SocketRegistry{}
+
+	registry.counter = 0
+	registry.clients = map[string]*SocketClient{}
+	registry.order   = []string{}
+
+	return registry
+}
+
+/**
+ * SocketRegistry.Add(*SocketClient) string
+ *
+ * Assigns id to the client and registers it.
+ */
+func (r *SocketRegistry) Add(c *SocketClient) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.counter++
+	c.id = strconv.FormatUint(r.counter, 10)
+
+	r.clients[c.id] = c
+	r.order = append(r.order, c.id)
+
+	return c.id
+}
+
+/**
+ * SocketRegistry.Remove(*SocketClient) bool
+ */
+func (r *SocketRegistry) Remove(c *SocketClient) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.clients[c.id]; !ok {
+		return false
+	}
+
+	delete(r.clients, c.id)
+	for i, id := range r.order {
+		if id == c.id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+/**
+ * SocketRegistry.Get(string) *SocketClient
+ */
+func (r *SocketRegistry) Get(id string) *SocketClient {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.clients[id]
+}
+
+/**
+ * SocketRegistry.GetAll() []*SocketClient
+ *
+ * Returns snapshot of registered clients in order of their connection.
+ */
+func (r *SocketRegistry) GetAll() []*SocketClient {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	clients := make([]*SocketClient, 0, len(r.order))
+	for _, id := range r.order {
+		clients = append(clients, r.clients[id])
+	}
+
+	return clients
+}
+
+/**
+ * SocketRegistry.Count() int
+ */
+func (r *SocketRegistry) Count() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return len(r.clients)
+}
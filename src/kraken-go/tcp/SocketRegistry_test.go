@@ -0,0 +1,132 @@
+package tcp
+
+import (
+	"sync"
+	"time"
+	"testing"
+)
+
+func TestSocketRegistryConcurrentAccess(t *testing.T) {
+	registry := CreateSocketRegistry()
+
+	var wg sync.WaitGroup
+	clients := make([]*SocketClient, 100)
+	for i := range clients {
+		clients[i] = &SocketClient{}
+		wg.Add(1)
+		go func(c *SocketClient) {
+			defer wg.Done()
+			registry.Add(c)
+		}(clients[i])
+	}
+	wg.Wait()
+
+	if registry.Count() != len(clients) {
+		t.Fatalf("registry holds %d clients", registry.Count())
+	}
+
+	ids := map[string]bool{}
+	for _, c := range clients {
+		if ids[c.GetId()] || registry.Get(c.GetId()) != c {
+			t.Fatalf("client id %q is not unique", c.GetId())
+		}
+		ids[c.GetId()] = true
+	}
+
+	for _, c := range clients[:50] {
+		if !registry.Remove(c) {
+			t.Errorf("client %s has not been removed", c.GetId())
+		}
+	}
+	if registry.Remove(clients[0]) {
+		t.Errorf("client has been removed twice")
+	}
+	if registry.Get(clients[0].GetId()) != nil || len(registry.GetAll()) != 50 {
+		t.Errorf("removed clients are still registered")
+	}
+}
+
+func TestBroadcastAndSendTo(t *testing.T) {
+	srv := CreateSocket()
+	if err := srv.Listen("127.0.0.1", "19321"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	got := make([]chan string, 3)
+	for i := range got {
+		got[i] = make(chan string, 4)
+
+		cl := CreateSocket()
+		received := got[i]
+		cl.OnMessage(func(c *SocketClient, m *SocketMessage) {
+			received <- m.GetRecord().Get("TXT")
+		})
+		if err := cl.Connect("127.0.0.1", "19321"); err != nil {
+			t.Fatalf("connect: %s", err.GetMessage())
+		}
+		defer cl.Close()
+
+		// clients are registered in order of connection
+		for j := 0; j < 100 && srv.Conn.Clients.Count() <= i; j++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	clients := srv.Conn.Clients.GetAll()
+	if len(clients) != 3 {
+		t.Fatalf("%d clients are registered", len(clients))
+	}
+	clients[0].SetMeta("role", "admin")
+	if clients[0].GetMeta("role") != "admin" || clients[0].GetConnectedAt().IsZero() || clients[0].GetRemoteAddr() == "" {
+		t.Errorf("client details are missing")
+	}
+
+	srv.Broadcast(createTextMessage("all"))
+	srv.BroadcastExcept(clients[1], createTextMessage("others"))
+	if err := srv.SendTo(clients[2].GetId(), createTextMessage("direct")); err != nil {
+		t.Errorf("send to client: %s", err.GetMessage())
+	}
+
+	expectText(t, got[0], "all")
+	expectText(t, got[0], "others")
+	expectText(t, got[1], "all")
+	expectText(t, got[2], "all")
+	expectText(t, got[2], "others")
+	expectText(t, got[2], "direct")
+	if len(got[1]) != 0 {
+		t.Errorf("excluded client received %q", <-got[1])
+	}
+
+	if err := srv.SendTo("unknown", createTextMessage("lost")); err == nil || err.GetCode() != SOCKET_ERR_UNKNOWN_CLIENT {
+		t.Errorf("send to unknown client returned %v", err)
+	}
+}
+
+func TestDisconnectedClientIsRemoved(t *testing.T) {
+	stopped := make(chan string, 1)
+
+	srv := CreateSocket()
+	srv.OnClientStop(func(c *SocketClient) {
+		stopped <- c.GetId()
+	})
+	if err := srv.Listen("127.0.0.1", "19322"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19322"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	cl.Close()
+
+	select {
+		case id := <-stopped:
+			if srv.Conn.Clients.Get(id) != nil || srv.Conn.Clients.Count() != 0 {
+				t.Errorf("disconnected client %s is still registered", id)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("client has not been stopped")
+	}
+}
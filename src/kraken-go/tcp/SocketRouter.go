@@ -0,0 +1,210 @@
+package tcp
+
+import (
+	"io"
+	"fmt"
+	"sync"
+	"time"
+	"../errors"
+)
+
+/**
+ * SocketHandler
+ */
+type SocketHandler func(c *SocketClient, m *SocketMessage) errors.Error
+
+/**
+ * SocketMiddleware
+ */
+type SocketMiddleware func(next SocketHandler) SocketHandler
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketRouter class
+ *
+ * Dispatches incoming messages to handlers registered per SocketMessage.Cmd. Every message, rpc requests included,
+ * passes through the middleware chain first. Errors returned by handlers are sent back to the client as ERR frames.
+ * Commands without handler are rejected, unless default handler is replaced or forwarding to OnMessage callback and
+ * Incoming channel is turned on.
+ */
+type SocketRouter struct {
+	sock		*Socket
+	lock		sync.RWMutex
+	handlers	map[string]SocketHandler
+	fallback	SocketHandler
+	forward		bool
+	middleware	[]SocketMiddleware
+}
+
+/**
+ * SocketRouter constructor
+ */
+func CreateSocketRouter(sock *Socket) *SocketRouter {
+	router := &SocketRouter{}
+
+	router.sock       = sock
+	router.handlers   = map[string]SocketHandler{}
+	router.fallback   = nil
+	router.forward    = false
+	router.middleware = []SocketMiddleware{}
+
+	return router
+}
+
+/**
+ * SocketRouter.Handle(string, SocketHandler)
+ */
+func (router *SocketRouter) Handle(cmd string, handler SocketHandler) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	router.handlers[cmd] = handler
+}
+
+/**
+ * SocketRouter.HandleDefault(SocketHandler)
+ */
+func (router *SocketRouter) HandleDefault(handler SocketHandler) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	router.fallback = handler
+}
+
+/**
+ * SocketRouter.Forward(bool)
+ *
+ * Passes commands without handler to OnMessage callback or Incoming channel instead of rejecting them. Handler set by
+ * HandleDefault still takes precedence.
+ */
+func (router *SocketRouter) Forward(enabled bool) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	router.forward = enabled
+}
+
+/**
+ * SocketRouter.Use(...SocketMiddleware)
+ */
+func (router *SocketRouter) Use(middleware ...SocketMiddleware) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	router.middleware = append(router.middleware, middleware...)
+}
+
+/**
+ * SocketRouter.Dispatch(*SocketClient, *SocketMessage)
+ */
+func (router *SocketRouter) Dispatch(c *SocketClient, m *SocketMessage) {
+	router.lock.RLock()
+	handler := SocketHandler(router.route)
+	for i := len(router.middleware) - 1; i >= 0; i-- {
+		handler = router.middleware[i](handler)
+	}
+	router.lock.RUnlock()
+
+	err := handler(c, m)
+	if err == nil || m.GetCmd() == SOCKET_RESPONSE || m.GetCmd() == SOCKET_ERROR {
+		return
+	}
+
+	reply := errorReply(err)
+	reply.Id = m.GetId()
+
+	router.sock.WriteMessage(c, reply)
+}
+
+/**
+ * SocketRouter.route(*SocketClient, *SocketMessage) errors.Error
+ */
+func (router *SocketRouter) route(c *SocketClient, m *SocketMessage) errors.Error {
+	if router.sock.rpc.dispatch(c, m) {
+		return nil
+	}
+
+	router.lock.RLock()
+	handler, ok := router.handlers[m.GetCmd()]
+	if !ok && router.fallback != nil {
+		handler = router.fallback
+	} else if !ok && router.forward {
+		handler = router.sock.forwardMessage
+	} else if !ok {
+		handler = UnknownCommandHandler
+	}
+	router.lock.RUnlock()
+
+	return handler(c, m)
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * UnknownCommandHandler(*SocketClient, *SocketMessage) errors.Error
+ *
+ * Default handler which rejects every command without registered handler. Requests carrying correlation id are
+ * rejected as unknown rpc methods.
+ */
+func UnknownCommandHandler(c *SocketClient, m *SocketMessage) errors.Error {
+	if m.GetId() != "" {
+		return errors.New(SOCKET_ERR_UNKNOWN_METHOD, "Unknown method " + m.GetCmd() + ".")
+	}
+
+	return errors.New(SOCKET_ERR_UNKNOWN_COMMAND, "Unknown command " + m.GetCmd() + ".")
+}
+
+/**
+ * LogMiddleware(io.Writer) SocketMiddleware
+ */
+func LogMiddleware(w io.Writer) SocketMiddleware {
+	return func(next SocketHandler) SocketHandler {
+		return func(c *SocketClient, m *SocketMessage) errors.Error {
+			start := time.Now()
+			err := next(c, m)
+
+			if err != nil {
+				fmt.Fprintf(w, "%s [%s] %s Error[%d] = %s\n", c.GetRemoteAddr(), m.GetCmd(), time.Since(start), err.GetCode(), err.GetMessage())
+			} else {
+				fmt.Fprintf(w, "%s [%s] %s\n", c.GetRemoteAddr(), m.GetCmd(), time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+/**
+ * GuardMiddleware(func(*SocketClient, *SocketMessage) bool) SocketMiddleware
+ *
+ * Lets through only messages accepted by given predicate.
+ */
+func GuardMiddleware(allow func(c *SocketClient, m *SocketMessage) bool) SocketMiddleware {
+	return func(next SocketHandler) SocketHandler {
+		return func(c *SocketClient, m *SocketMessage) errors.Error {
+			if !allow(c, m) {
+				return errors.New(SOCKET_ERR_FORBIDDEN, "Command " + m.GetCmd() + " is not allowed.")
+			}
+
+			return next(c, m)
+		}
+	}
+}
+
+/**
+ * RecoverMiddleware() SocketMiddleware
+ *
+ * Turns panic raised by handler into an error, so single bad message does not bring down the whole socket.
+ */
+func RecoverMiddleware() SocketMiddleware {
+	return func(next SocketHandler) SocketHandler {
+		return func(c *SocketClient, m *SocketMessage) (err errors.Error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = errors.New(SOCKET_ERR_HANDLER_PANIC, fmt.Sprintf("Handler for %s panicked: %v", m.GetCmd(), r))
+				}
+			}()
+
+			return next(c, m)
+		}
+	}
+}
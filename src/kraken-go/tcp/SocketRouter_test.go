@@ -0,0 +1,155 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"bufio"
+	"strings"
+	"testing"
+	"../errors"
+)
+
+func dialLegacy(t *testing.T, port string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", "127.0.0.1:" + port)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn, bufio.NewReader(conn)
+}
+
+func exchangeLegacy(conn net.Conn, reader *bufio.Reader, frame string) string {
+	conn.Write([]byte(frame + "\n"))
+	line, _ := reader.ReadString('\n')
+
+	return strings.TrimSpace(line)
+}
+
+func TestRouterRejectsUnknownCommands(t *testing.T) {
+	srv := CreateSocket()
+	srv.Handle("PING", func(c *SocketClient, m *SocketMessage) errors.Error {
+		return srv.WriteMessage(c, CreateSocketMessage("PONG", nil))
+	})
+	if err := srv.Listen("127.0.0.1", "19221"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	conn, reader := dialLegacy(t, "19221")
+	defer conn.Close()
+
+	cases := map[string]string{
+		"[PING]":		"[PONG]",
+		"[NOPE]":		"CODE=13",
+		"[NOPE#7]":		"CODE=11",
+	}
+
+	for frame, want := range cases {
+		if line := exchangeLegacy(conn, reader, frame); !strings.Contains(line, want) {
+			t.Errorf("%s: unexpected reply %q", frame, line)
+		}
+	}
+}
+
+func TestRouterFallsThroughToDefaultHandler(t *testing.T) {
+	forwarded := make(chan string, 4)
+
+	srv := CreateSocket()
+	srv.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		forwarded <- m.GetCmd()
+		srv.WriteMessage(c, CreateSocketMessage("SEEN", nil))
+	})
+	if err := srv.Listen("127.0.0.1", "19222"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	conn, reader := dialLegacy(t, "19222")
+	defer conn.Close()
+
+	if line := exchangeLegacy(conn, reader, "[NOPE]"); line != "[SEEN]" || <-forwarded != "NOPE" {
+		t.Errorf("command has not been forwarded to OnMessage: %q", line)
+	}
+
+	// default handler takes precedence over forwarding
+	srv.HandleDefault(func(c *SocketClient, m *SocketMessage) errors.Error {
+		return errors.New(99, "Default.")
+	})
+
+	if line := exchangeLegacy(conn, reader, "[NOPE]"); !strings.Contains(line, "CODE=99") {
+		t.Errorf("unexpected reply %q", line)
+	}
+	if len(forwarded) != 0 {
+		t.Errorf("command has been forwarded despite default handler")
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	trace := make(chan string, 16)
+
+	tracer := func(name string) SocketMiddleware {
+		return func(next SocketHandler) SocketHandler {
+			return func(c *SocketClient, m *SocketMessage) errors.Error {
+				trace <- name + ">"
+				err := next(c, m)
+				trace <- "<" + name
+				return err
+			}
+		}
+	}
+
+	srv := CreateSocket()
+	srv.Use(tracer("a"), tracer("b"))
+	srv.Use(RecoverMiddleware(), GuardMiddleware(func(c *SocketClient, m *SocketMessage) bool {
+		return m.GetCmd() != "DENY"
+	}))
+	srv.Handle("PING", func(c *SocketClient, m *SocketMessage) errors.Error {
+		trace <- "PING"
+		return srv.WriteMessage(c, CreateSocketMessage("PONG", nil))
+	})
+	srv.Handle("DENY", func(c *SocketClient, m *SocketMessage) errors.Error {
+		trace <- "DENY"
+		return nil
+	})
+	srv.Handle("BOOM", func(c *SocketClient, m *SocketMessage) errors.Error {
+		panic("boom")
+	})
+	if err := srv.Listen("127.0.0.1", "19223"); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	conn, reader := dialLegacy(t, "19223")
+	defer conn.Close()
+
+	cases := []struct {
+		frame		string
+		reply		string
+		trace		string
+	}{
+		{"[PING]", "[PONG]", "a> b> PING <b <a"},
+		{"[DENY]", "CODE=15", "a> b> <b <a"},
+		{"[BOOM]", "CODE=14", "a> b> <b <a"},
+	}
+
+	for _, tc := range cases {
+		if line := exchangeLegacy(conn, reader, tc.frame); !strings.Contains(line, tc.reply) {
+			t.Errorf("%s: unexpected reply %q", tc.frame, line)
+		}
+
+		// handler may reply before middleware unwinds
+		steps := []string{}
+		for len(steps) < len(strings.Fields(tc.trace)) {
+			select {
+				case step := <-trace:
+					steps = append(steps, step)
+				case <-time.After(time.Second):
+					t.Fatalf("%s: incomplete trace %v", tc.frame, steps)
+			}
+		}
+		if strings.Join(steps, " ") != tc.trace {
+			t.Errorf("%s: unexpected order %v", tc.frame, steps)
+		}
+	}
+}
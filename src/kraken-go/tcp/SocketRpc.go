@@ -0,0 +1,203 @@
+package tcp
+
+import (
+	"sync"
+	"strconv"
+	"context"
+	"../storage"
+	"../errors"
+)
+
+/**
+ * SocketRpcHandler
+ *
+ * Handlers run on the goroutine reading the connection, so messages of one peer are handled in order and no further
+ * message of that peer is read until handler returns. Handler therefore must not Call the same peer and wait for the
+ * response, which could never be read; such calls have to be made from a goroutine started by the handler.
+ */
+type SocketRpcHandler func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error)
+
+/**
+ * SocketRpcCall class
+ */
+type SocketRpcCall struct {
+	client		*SocketClient
+	reply		chan *SocketMessage
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketRpc class
+ *
+ * Request/response layer on top of Socket. Requests carry a correlation id in the frame and the method name as their
+ * command, responses come back as RES or ERR frames with the same id. Frames without id are not touched by rpc layer.
+ */
+type SocketRpc struct {
+	sock		*Socket
+	lock		sync.Mutex
+	counter		uint64
+	methods		map[string]SocketRpcHandler
+	pending		map[string]*SocketRpcCall
+}
+
+/**
+ * SocketRpc constructor
+ */
+func CreateSocketRpc(sock *Socket) *SocketRpc {
+	rpc := &SocketRpc{}
+
+	rpc.sock    = sock
+	rpc.counter = 0
+	rpc.methods = map[string]SocketRpcHandler{}
+	rpc.pending = map[string]*SocketRpcCall{}
+
+	return rpc
+}
+
+/**
+ * SocketRpc.Register(string, SocketRpcHandler)
+ */
+func (rpc *SocketRpc) Register(method string, handler SocketRpcHandler) {
+	rpc.lock.Lock()
+	defer rpc.lock.Unlock()
+
+	rpc.methods[method] = handler
+}
+
+/**
+ * SocketRpc.Call(context.Context, *SocketClient, string, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (rpc *SocketRpc) Call(ctx context.Context, c *SocketClient, method string, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if c == nil {
+		return nil, errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot call method on null connection.")
+	}
+
+	if _, ok := ctx.Deadline(); !ok && rpc.sock.Config.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rpc.sock.Config.CallTimeout)
+		defer cancel()
+	}
+
+	call := &SocketRpcCall{c, make(chan *SocketMessage, 1)}
+
+	rpc.lock.Lock()
+	rpc.counter++
+	id := strconv.FormatUint(rpc.counter, 10)
+	rpc.pending[id] = call
+	rpc.lock.Unlock()
+
+	defer func() {
+		rpc.lock.Lock()
+		delete(rpc.pending, id)
+		rpc.lock.Unlock()
+	}()
+
+	if record == nil {
+		record = storage.CreateDataRecord()
+	}
+
+	request := CreateSocketMessage(method, record)
+	request.Id = id
+
+	if err := rpc.sock.WriteMessage(c, request); err != nil {
+		return nil, err
+	}
+
+	select {
+		case reply := <-call.reply:
+			if reply == nil {
+				return nil, errors.New(SOCKET_CLOSED_COUT, "Connection closed before response arrived.")
+			}
+			if reply.GetCmd() == SOCKET_ERROR {
+				return nil, replyError(reply.GetRecord())
+			}
+			return reply.GetRecord(), nil
+
+		case <-ctx.Done():
+			return nil, errors.New(SOCKET_ERR_TIMEOUT, "Call " + method + " failed: " + ctx.Err().Error())
+	}
+}
+
+/**
+ * SocketRpc.dispatch(*SocketClient, *SocketMessage) bool
+ *
+ * Returns false for frames which are not part of rpc exchange, requests for methods which are not registered included,
+ * so they can still be handled by the socket.
+ */
+func (rpc *SocketRpc) dispatch(c *SocketClient, m *SocketMessage) bool {
+	if m.GetId() == "" {
+		return false
+	}
+
+	if m.GetCmd() == SOCKET_RESPONSE || m.GetCmd() == SOCKET_ERROR {
+		rpc.lock.Lock()
+		call, ok := rpc.pending[m.GetId()]
+		rpc.lock.Unlock()
+
+		if ok && call.client == c {
+			select {
+				case call.reply <- m:
+				default:
+			}
+		}
+		return true
+	}
+
+	rpc.lock.Lock()
+	handler, ok := rpc.methods[m.GetCmd()]
+	rpc.lock.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	var reply *SocketMessage
+	if record, err := handler(c, m.GetRecord()); err != nil {
+		reply = errorReply(err)
+	} else {
+		if record == nil {
+			record = storage.CreateDataRecord()
+		}
+		reply = CreateSocketMessage(SOCKET_RESPONSE, record)
+	}
+
+	reply.Id = m.GetId()
+	rpc.sock.WriteMessage(c, reply)
+
+	return true
+}
+
+/**
+ * SocketRpc.release(*SocketClient)
+ *
+ * Fails all calls still waiting for response from closed client.
+ */
+func (rpc *SocketRpc) release(c *SocketClient) {
+	rpc.lock.Lock()
+	defer rpc.lock.Unlock()
+
+	for id, call := range rpc.pending {
+		if call.client == c {
+			select {
+				case call.reply <- nil:
+				default:
+			}
+			delete(rpc.pending, id)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+func errorReply(err errors.Error) *SocketMessage {
+	record := storage.CreateDataRecord()
+	record.Set(MESSAGE_CODE, strconv.Itoa(err.GetCode()))
+	record.Set(MESSAGE_REASON, err.GetMessage())
+
+	return CreateSocketMessage(SOCKET_ERROR, record)
+}
+
+func replyError(record *storage.DataRecord) errors.Error {
+	code, _ := strconv.Atoi(record.Get(MESSAGE_CODE))
+
+	return errors.New(code, record.Get(MESSAGE_REASON))
+}
@@ -0,0 +1,115 @@
+package tcp
+
+import (
+	"time"
+	"strconv"
+	"context"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+func listenRpc(t *testing.T, port string) *Socket {
+	srv := CreateSocket()
+	srv.RegisterMethod("ADD", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		a, _ := strconv.Atoi(record.Get("A"))
+		b, _ := strconv.Atoi(record.Get("B"))
+
+		reply := storage.CreateDataRecord()
+		reply.Set("SUM", strconv.Itoa(a + b))
+		return reply, nil
+	})
+	srv.RegisterMethod("FAIL", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		return nil, errors.New(77, "Boom.")
+	})
+	srv.RegisterMethod("SLOW", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		time.Sleep(300 * time.Millisecond)
+		return nil, nil
+	})
+
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	return srv
+}
+
+func TestRpcCall(t *testing.T) {
+	srv := listenRpc(t, "19211")
+	defer srv.Close()
+
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19211"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	record := storage.CreateDataRecord()
+	record.Set("A", "2")
+	record.Set("B", "40")
+
+	reply, err := cl.Call(context.Background(), "ADD", record)
+	if err != nil {
+		t.Fatalf("call: %s", err.GetMessage())
+	}
+	if reply.Get("SUM") != "42" {
+		t.Errorf("unexpected reply %v", reply.ToMap())
+	}
+}
+
+func TestRpcCallErrors(t *testing.T) {
+	srv := listenRpc(t, "19212")
+	defer srv.Close()
+
+	cl := CreateSocket()
+	if err := cl.Connect("127.0.0.1", "19212"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	cases := map[string]int{
+		"FAIL":		77,
+		"MISSING":	SOCKET_ERR_UNKNOWN_METHOD,
+	}
+
+	for method, code := range cases {
+		_, err := cl.Call(context.Background(), method, nil)
+		if err == nil || err.GetCode() != code {
+			t.Errorf("%s: unexpected error %v", method, err)
+		}
+	}
+}
+
+func TestRpcCallTimeout(t *testing.T) {
+	srv := listenRpc(t, "19213")
+	defer srv.Close()
+
+	cl := CreateSocket()
+	cl.Config.CallTimeout = 100 * time.Millisecond
+	if err := cl.Connect("127.0.0.1", "19213"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	start := time.Now()
+	_, err := cl.Call(context.Background(), "SLOW", nil)
+	if err == nil || err.GetCode() != SOCKET_ERR_TIMEOUT {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250 * time.Millisecond {
+		t.Errorf("call timed out after %s", elapsed)
+	}
+
+	// late response of timed out call must not be taken for response of the next one
+	reply, err := cl.Call(context.Background(), "SLOW", nil)
+	if err == nil {
+		t.Errorf("unexpected reply %v", reply.ToMap())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+	defer cancel()
+
+	if _, err := cl.Call(ctx, "SLOW", nil); err != nil {
+		t.Errorf("call with own deadline failed: %s", err.GetMessage())
+	}
+}
@@ -0,0 +1,274 @@
+package tcp
+
+import (
+	"time"
+	"context"
+	"sync/atomic"
+	"../storage"
+	"../errors"
+)
+
+const (
+	ACCEPT_RETRY_DELAY			 time.Duration = 50 * time.Millisecond
+)
+
+/**
+ * Socket.Shutdown(context.Context) errors.Error
+ *
+ * Stops accepting connections, sends BYE to every peer and stops reading from them, so that handlers already running
+ * can finish and write their replies. Connections still busy when context is done are closed forcibly. Returns only
+ * when every goroutine of the socket is gone; error is returned when connections had to be closed forcibly.
+ */
+func (sock *Socket) Shutdown(ctx context.Context) errors.Error {
+	if !sock.markClosed() {
+		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot shut down null connection.")
+	}
+
+	// listener
+	if sock.Conn.Client == nil {
+		sock.Conn.Close()
+	}
+
+	clients := sock.Conn.Clients.GetAll()
+	if sock.Conn.Client != nil {
+		clients = append(clients, sock.Conn.Client)
+	}
+	for _, c := range clients {
+		c.sayGoodbye()
+	}
+	for _, c := range sock.tracked() {
+		c.stopListening()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		sock.wg.Wait()
+		close(drained)
+	}()
+
+	var err errors.Error
+
+	select {
+		case <-drained:
+		case <-ctx.Done():
+			for _, c := range sock.tracked() {
+				c.closeWithReason(CLOSE_REASON_SHUTDOWN)
+			}
+			sock.haltChannels()
+			<-drained
+			err = errors.New(SOCKET_ERR_TIMEOUT, "Shutdown deadline exceeded, remaining connections have been closed.")
+	}
+
+	// connector
+	if sock.Conn.Client != nil {
+		sock.Conn.Close()
+	}
+
+	sock.lock.Lock()
+	sock.conns = map[*SocketClient]bool{}
+	sock.perIP = map[string]int{}
+	sock.lock.Unlock()
+
+	sock.closeChannels()
+	sock.Events.Stop()
+
+	return err
+}
+
+/**
+ * Socket.isOpen() bool
+ */
+func (sock *Socket) isOpen() bool {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	if sock.done == nil {
+		return false
+	}
+
+	select {
+		case <-sock.done:
+			return false
+		default:
+			return true
+	}
+}
+
+/**
+ * Socket.markClosed() bool
+ *
+ * Switches socket to closed state. Returns false when it has been closed already.
+ */
+func (sock *Socket) markClosed() bool {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	if !sock.IsConnected {
+		return false
+	}
+
+	sock.IsConnected = false
+	close(sock.done)
+
+	return true
+}
+
+/**
+ * Socket.spawn(func())
+ *
+ * Runs function in goroutine Shutdown waits for.
+ */
+func (sock *Socket) spawn(f func()) {
+	sock.wg.Add(1)
+
+	go func() {
+		defer sock.wg.Done()
+		f()
+	}()
+}
+
+/**
+ * Socket.track(*SocketClient) errors.Error
+ *
+ * Remembers connection until closeConnection is called. Fails when socket is being closed or connection limits would
+ * be exceeded.
+ */
+func (sock *Socket) track(c *SocketClient) errors.Error {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	if !sock.IsConnected {
+		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Socket is being closed.")
+	}
+	if err := sock.checkLimits(c); err != nil {
+		return err
+	}
+
+	sock.conns[c] = true
+	sock.traffic.accept()
+	if ip := c.GetRemoteIP(); ip != "" {
+		sock.perIP[ip]++
+	}
+
+	return nil
+}
+
+/**
+ * Socket.untrack(*SocketClient)
+ */
+func (sock *Socket) untrack(c *SocketClient) {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	if !sock.conns[c] {
+		return
+	}
+
+	delete(sock.conns, c)
+	if ip := c.GetRemoteIP(); ip != "" {
+		if sock.perIP[ip]--; sock.perIP[ip] <= 0 {
+			delete(sock.perIP, ip)
+		}
+	}
+}
+
+/**
+ * Socket.isServing(*SocketClient) bool
+ */
+func (sock *Socket) isServing(c *SocketClient) bool {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	return sock.conns[c]
+}
+
+/**
+ * Socket.tracked() []*SocketClient
+ */
+func (sock *Socket) tracked() []*SocketClient {
+	sock.lock.Lock()
+	defer sock.lock.Unlock()
+
+	clients := make([]*SocketClient, 0, len(sock.conns))
+	for c := range sock.conns {
+		clients = append(clients, c)
+	}
+
+	return clients
+}
+
+/**
+ * Socket.handleGoodbye(*SocketClient, *SocketMessage) bool
+ *
+ * Remembers that peer is shutting down. Connection is kept open, so replies to requests already sent can still
+ * arrive. Returns false for any other frame.
+ */
+func (sock *Socket) handleGoodbye(c *SocketClient, m *SocketMessage) bool {
+	if m.GetCmd() != SOCKET_GOODBYE {
+		return false
+	}
+
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if c.closeReason == "" {
+		c.closeReason = CLOSE_REASON_GOODBYE
+	}
+
+	return true
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketClient.sayGoodbye()
+ *
+ * Queues BYE for peers which completed handshake, legacy peers would not understand it. BYE is skipped when send
+ * queue is full, so that shutdown never waits for slow peer here.
+ */
+func (c *SocketClient) sayGoodbye() {
+	c.connLock.Lock()
+	handshake := c.handshake
+	c.connLock.Unlock()
+
+	if handshake == nil || handshake.IsLegacy() || atomic.LoadInt32(&c.writerState) != WRITER_RUNNING {
+		return
+	}
+
+	select {
+		case c.sendQueue <- CreateSocketMessage(SOCKET_GOODBYE, storage.CreateDataRecord()):
+		default:
+	}
+}
+
+/**
+ * SocketClient.prepareRead() bool
+ *
+ * Arms read timeout before next frame is read. Returns false once client stopped listening.
+ */
+func (c *SocketClient) prepareRead() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if !c.flags.IsListening {
+		return false
+	}
+
+	if c.sock.Config.ReadTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.sock.Config.ReadTimeout))
+	}
+
+	return true
+}
+
+/**
+ * SocketClient.stopListening()
+ *
+ * Interrupts pending read without touching handler which might be running, so it can still write its reply.
+ */
+func (c *SocketClient) stopListening() {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	c.flags.IsListening = false
+	c.conn.SetReadDeadline(time.Now())
+}
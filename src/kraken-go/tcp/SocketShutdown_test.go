@@ -0,0 +1,107 @@
+package tcp
+
+import (
+	"time"
+	"context"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+func listenSlow(t *testing.T, port string, delay time.Duration) *Socket {
+	srv := CreateSocket()
+	srv.RegisterMethod("SLOW", func(c *SocketClient, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+		time.Sleep(delay)
+
+		reply := storage.CreateDataRecord()
+		reply.Set("OK", "1")
+		return reply, nil
+	})
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	return srv
+}
+
+func callAsync(cl *Socket, method string) chan errors.Error {
+	result := make(chan errors.Error, 1)
+	go func() {
+		_, err := cl.Call(context.Background(), method, nil)
+		result <- err
+	}()
+
+	return result
+}
+
+func TestShutdownDrainsRunningHandlers(t *testing.T) {
+	srv := listenSlow(t, "19251", 300 * time.Millisecond)
+
+	reasons := make(chan string, 1)
+
+	cl := CreateSocket()
+	cl.OnDisconnect(func(c *SocketClient) {
+		reasons <- c.GetCloseReason()
+	})
+	if err := cl.Connect("127.0.0.1", "19251"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	result := callAsync(cl, "SLOW")
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %s", err.GetMessage())
+	}
+	if err := <-result; err != nil {
+		t.Errorf("call running during shutdown failed: %s", err.GetMessage())
+	}
+
+	select {
+		case reason := <-reasons:
+			if reason != CLOSE_REASON_GOODBYE {
+				t.Errorf("client disconnected with %q", reason)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("client has not been disconnected")
+	}
+
+	if err := srv.Shutdown(context.Background()); err == nil || err.GetCode() != SOCKET_ERR_NOT_CONNECTED {
+		t.Errorf("second shutdown returned %v", err)
+	}
+}
+
+func TestShutdownClosesConnectionsAfterDeadline(t *testing.T) {
+	srv := listenSlow(t, "19252", time.Second)
+
+	cl := CreateSocket()
+	cl.Config.CallTimeout = 5 * time.Second
+	if err := cl.Connect("127.0.0.1", "19252"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	result := callAsync(cl, "SLOW")
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200 * time.Millisecond)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err == nil || err.GetCode() != SOCKET_ERR_TIMEOUT {
+		t.Errorf("unexpected shutdown result %v", err)
+	}
+
+	select {
+		case err := <-result:
+			if err == nil {
+				t.Errorf("call has been answered by closed connection")
+			}
+		case <-time.After(4 * time.Second):
+			t.Fatalf("call is still waiting for closed connection")
+	}
+}
@@ -0,0 +1,336 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"bytes"
+	"math/big"
+	"io/ioutil"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/pem"
+	"encoding/hex"
+	"../errors"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketTLSConfig class
+ *
+ * Certificates can be given either as file paths or as PEM data. When CA bundle is set, only peers signed by it are
+ * trusted, system roots are not consulted.
+ */
+type SocketTLSConfig struct {
+	CertFile		string
+	KeyFile			string
+	CAFile			string
+	CertPEM			[]byte
+	KeyPEM			[]byte
+	CAPEM			[]byte
+	ServerName		string
+	VerifyClient	bool
+}
+
+/**
+ * SocketTLSConfig constructor
+ */
+func CreateSocketTLSConfig() *SocketTLSConfig {
+	config := &SocketTLSConfig{}
+
+	config.ServerName   = ""
+	config.VerifyClient = false
+
+	return config
+}
+
+/**
+ * SocketTLSConfig.ServerConfig() (*tls.Config, errors.Error)
+ */
+func (config *SocketTLSConfig) ServerConfig() (*tls.Config, errors.Error) {
+	cert, err := config.loadCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, errors.New(SOCKET_ERR_TLS, "Server certificate is required.")
+	}
+
+	pool, err := config.loadCA()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+	tlsConfig.MinVersion   = tls.VersionTLS12
+	tlsConfig.Certificates = []tls.Certificate{*cert}
+	tlsConfig.ClientCAs    = pool
+
+	switch {
+		case config.VerifyClient:
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		case pool != nil:
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			tlsConfig.ClientAuth = tls.NoClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+/**
+ * SocketTLSConfig.ClientConfig(string) (*tls.Config, errors.Error)
+ */
+func (config *SocketTLSConfig) ClientConfig(host string) (*tls.Config, errors.Error) {
+	cert, err := config.loadCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := config.loadCA()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+	tlsConfig.MinVersion = tls.VersionTLS12
+	tlsConfig.RootCAs    = pool
+	tlsConfig.ServerName = config.ServerName
+
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	return tlsConfig, nil
+}
+
+/**
+ * SocketTLSConfig.loadCertificate() (*tls.Certificate, errors.Error)
+ */
+func (config *SocketTLSConfig) loadCertificate() (*tls.Certificate, errors.Error) {
+	certPEM, err := readPEM(config.CertPEM, config.CertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readPEM(config.KeyPEM, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if certPEM == nil && keyPEM == nil {
+		return nil, nil
+	}
+
+	cert, cerr := tls.X509KeyPair(certPEM, keyPEM)
+	if cerr != nil {
+		return nil, errors.New(SOCKET_ERR_TLS, cerr.Error())
+	}
+
+	return &cert, nil
+}
+
+/**
+ * SocketTLSConfig.loadCA() (*x509.CertPool, errors.Error)
+ */
+func (config *SocketTLSConfig) loadCA() (*x509.CertPool, errors.Error) {
+	caPEM, err := readPEM(config.CAPEM, config.CAFile)
+	if err != nil || caPEM == nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New(SOCKET_ERR_TLS, "CA bundle does not contain any certificate.")
+	}
+
+	return pool, nil
+}
+
+func readPEM(data []byte, path string) ([]byte, errors.Error) {
+	if data != nil || path == "" {
+		return data, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	return data, nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketIdentity class
+ *
+ * Identity of peer taken from the certificate it presented during TLS handshake.
+ */
+type SocketIdentity struct {
+	CommonName		string
+	Organization	[]string
+	DNSNames		[]string
+	Fingerprint		string
+	Certificate		*x509.Certificate
+}
+
+/**
+ * SocketIdentity constructor
+ */
+func CreateSocketIdentity(cert *x509.Certificate) *SocketIdentity {
+	identity := &SocketIdentity{}
+
+	sum := sha256.Sum256(cert.Raw)
+
+	identity.CommonName   = cert.Subject.CommonName
+	identity.Organization = cert.Subject.Organization
+	identity.DNSNames     = cert.DNSNames
+	identity.Fingerprint  = hex.EncodeToString(sum[:])
+	identity.Certificate  = cert
+
+	return identity
+}
+
+/**
+ * SocketClient.GetIdentity() *SocketIdentity
+ *
+ * Returns nil for plain connections and for peers which did not present a certificate.
+ */
+func (c *SocketClient) GetIdentity() *SocketIdentity {
+	return c.identity
+}
+
+/**
+ * SocketClient.handshakeTLS(time.Duration) errors.Error
+ */
+func (c *SocketClient) handshakeTLS(timeout time.Duration) errors.Error {
+	conn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := conn.Handshake(); err != nil {
+		return errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) > 0 {
+		c.identity = CreateSocketIdentity(state.PeerCertificates[0])
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.listenTLS(net.Listener) (net.Listener, errors.Error)
+ */
+func (sock *Socket) listenTLS(listener net.Listener) (net.Listener, errors.Error) {
+	if sock.Config.TLS == nil {
+		return listener, nil
+	}
+
+	tlsConfig, err := sock.Config.TLS.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewListener(listener, tlsConfig), nil
+}
+
+/**
+ * Socket.dialTLS(net.Conn) (net.Conn, errors.Error)
+ */
+func (sock *Socket) dialTLS(conn net.Conn) (net.Conn, errors.Error) {
+	if sock.Config.TLS == nil {
+		return conn, nil
+	}
+
+	tlsConfig, err := sock.Config.TLS.ClientConfig(sock.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Client(conn, tlsConfig), nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * CreateCertificate(string, []string, []byte, []byte) ([]byte, []byte, errors.Error)
+ *
+ * Generates PEM encoded certificate and key, valid for given hosts for one year. Certificate is self-signed and can
+ * act as a CA when parent is nil, otherwise it is signed by PEM encoded parent certificate and key.
+ */
+func CreateCertificate(commonName string, hosts []string, parentCertPEM []byte, parentKeyPEM []byte) ([]byte, []byte, errors.Error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	template := &x509.Certificate{}
+	template.SerialNumber = serial
+	template.Subject      = pkix.Name{CommonName: commonName, Organization: []string{"kraken"}}
+	template.NotBefore    = time.Now().Add(-time.Minute)
+	template.NotAfter     = time.Now().Add(365 * 24 * time.Hour)
+	template.KeyUsage     = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage  = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	signer := template
+	signerKey := interface{}(key)
+
+	if parentCertPEM == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = template.KeyUsage | x509.KeyUsageCertSign
+	} else {
+		certBlock, _ := pem.Decode(parentCertPEM)
+		keyBlock, _  := pem.Decode(parentKeyPEM)
+		if certBlock == nil || keyBlock == nil {
+			return nil, nil, errors.New(SOCKET_ERR_TLS, "Parent certificate is not PEM encoded.")
+		}
+		if signer, err = x509.ParseCertificate(certBlock.Bytes); err != nil {
+			return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+		}
+		if signerKey, err = x509.ParseECPrivateKey(keyBlock.Bytes); err != nil {
+			return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.New(SOCKET_ERR_TLS, err.Error())
+	}
+
+	var certPEM, keyPEM bytes.Buffer
+	pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(&keyPEM, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return certPEM.Bytes(), keyPEM.Bytes(), nil
+}
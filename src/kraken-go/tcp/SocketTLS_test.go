@@ -0,0 +1,114 @@
+package tcp
+
+import (
+	"time"
+	"testing"
+	"../storage"
+	"../errors"
+)
+
+type testPKI struct {
+	caCert		[]byte
+	caKey		[]byte
+	srvCert		[]byte
+	srvKey		[]byte
+	cliCert		[]byte
+	cliKey		[]byte
+}
+
+func createTestPKI(t *testing.T) *testPKI {
+	pki := &testPKI{}
+
+	var err errors.Error
+	if pki.caCert, pki.caKey, err = CreateCertificate("kraken-ca", nil, nil, nil); err != nil {
+		t.Fatalf("ca: %s", err.GetMessage())
+	}
+	if pki.srvCert, pki.srvKey, err = CreateCertificate("server", []string{"127.0.0.1", "localhost"}, pki.caCert, pki.caKey); err != nil {
+		t.Fatalf("server: %s", err.GetMessage())
+	}
+	if pki.cliCert, pki.cliKey, err = CreateCertificate("worker-1", nil, pki.caCert, pki.caKey); err != nil {
+		t.Fatalf("client: %s", err.GetMessage())
+	}
+
+	return pki
+}
+
+func listenTLS(t *testing.T, port string, pki *testPKI, got chan string) *Socket {
+	srv := CreateSocket()
+	srv.Config.TLS = &SocketTLSConfig{CertPEM: pki.srvCert, KeyPEM: pki.srvKey, CAPEM: pki.caCert, VerifyClient: true}
+	srv.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		got <- c.GetIdentity().CommonName + " " + m.GetRecord().Get("TXT")
+	})
+
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	return srv
+}
+
+func TestTLSHandshake(t *testing.T) {
+	pki := createTestPKI(t)
+	got := make(chan string, 1)
+
+	srv := listenTLS(t, "19281", pki, got)
+	defer srv.Close()
+
+	cl := CreateSocket()
+	cl.Config.TLS = &SocketTLSConfig{CertPEM: pki.cliCert, KeyPEM: pki.cliKey, CAPEM: pki.caCert}
+	if err := cl.Connect("127.0.0.1", "19281"); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	if identity := cl.Conn.Client.GetIdentity(); identity == nil || identity.CommonName != "server" {
+		t.Fatalf("unexpected server identity %v", identity)
+	}
+
+	record := storage.CreateDataRecord()
+	record.Set("TXT", "secure")
+	cl.WriteMessage(cl.Conn.Client, CreateSocketMessage("MSG", record))
+
+	select {
+		case line := <-got:
+			if line != "worker-1 secure" {
+				t.Fatalf("unexpected message %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message has not arrived")
+	}
+}
+
+func TestTLSRejectsUntrustedPeers(t *testing.T) {
+	pki := createTestPKI(t)
+	other := createTestPKI(t)
+
+	srv := listenTLS(t, "19282", pki, make(chan string, 1))
+	defer srv.Close()
+
+	cases := map[string]*SocketTLSConfig{
+		"client signed by other ca":	&SocketTLSConfig{CertPEM: other.cliCert, KeyPEM: other.cliKey, CAPEM: pki.caCert},
+		"client without certificate":	&SocketTLSConfig{CAPEM: pki.caCert},
+		"server signed by other ca":	&SocketTLSConfig{CertPEM: pki.cliCert, KeyPEM: pki.cliKey, CAPEM: other.caCert},
+	}
+
+	for name, config := range cases {
+		cl := CreateSocket()
+		cl.Config.TLS = config
+
+		if err := cl.Connect("127.0.0.1", "19282"); err == nil {
+			cl.Close()
+			t.Errorf("%s: connection has been accepted", name)
+		}
+	}
+}
+
+func TestTLSServerRequiresCertificate(t *testing.T) {
+	srv := CreateSocket()
+	srv.Config.TLS = CreateSocketTLSConfig()
+
+	if err := srv.Listen("127.0.0.1", "19283"); err == nil {
+		srv.Close()
+		t.Fatalf("listening without certificate has been allowed")
+	}
+}
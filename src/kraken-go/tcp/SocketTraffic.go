@@ -0,0 +1,73 @@
+package tcp
+
+import (
+	"sync/atomic"
+)
+
+/**
+ * SocketTrafficStats class
+ *
+ * Totals since socket has been created. Bytes include framing, so they match what has been transferred.
+ */
+type SocketTrafficStats struct {
+	Connections		int
+	Accepted		uint64
+	MessagesIn		uint64
+	MessagesOut		uint64
+	BytesIn			uint64
+	BytesOut		uint64
+}
+
+/**
+ * SocketTrafficCounters class
+ */
+type SocketTrafficCounters struct {
+	accepted		uint64
+	messagesIn		uint64
+	messagesOut		uint64
+	bytesIn			uint64
+	bytesOut		uint64
+}
+
+/**
+ * Socket.GetTrafficStats() *SocketTrafficStats
+ */
+func (sock *Socket) GetTrafficStats() *SocketTrafficStats {
+	counters := sock.traffic
+	stats := &SocketTrafficStats{}
+
+	sock.lock.Lock()
+	stats.Connections = len(sock.conns)
+	sock.lock.Unlock()
+
+	stats.Accepted    = atomic.LoadUint64(&counters.accepted)
+	stats.MessagesIn  = atomic.LoadUint64(&counters.messagesIn)
+	stats.MessagesOut = atomic.LoadUint64(&counters.messagesOut)
+	stats.BytesIn     = atomic.LoadUint64(&counters.bytesIn)
+	stats.BytesOut    = atomic.LoadUint64(&counters.bytesOut)
+
+	return stats
+}
+
+/**
+ * SocketTrafficCounters.accept()
+ */
+func (counters *SocketTrafficCounters) accept() {
+	atomic.AddUint64(&counters.accepted, 1)
+}
+
+/**
+ * SocketTrafficCounters.received(int)
+ */
+func (counters *SocketTrafficCounters) received(bytes int) {
+	atomic.AddUint64(&counters.messagesIn, 1)
+	atomic.AddUint64(&counters.bytesIn, uint64(bytes))
+}
+
+/**
+ * SocketTrafficCounters.sent(int)
+ */
+func (counters *SocketTrafficCounters) sent(bytes int) {
+	atomic.AddUint64(&counters.messagesOut, 1)
+	atomic.AddUint64(&counters.bytesOut, uint64(bytes))
+}
@@ -0,0 +1,158 @@
+package tcp
+
+import (
+	"os"
+	"net"
+	"strconv"
+	"strings"
+	"crypto/tls"
+	"../errors"
+)
+
+const (
+	SOCKET_TYPE_TCP				 string = "tcp"
+	SOCKET_TYPE_UNIX			 string = "unix"
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketCredentials class
+ *
+ * Credentials of the process on the other end of unix socket, as reported by the kernel.
+ */
+type SocketCredentials struct {
+	Pid		int
+	Uid		int
+	Gid		int
+}
+
+/**
+ * SocketClient.GetCredentials() *SocketCredentials
+ *
+ * Returns nil for connections other than unix ones.
+ */
+func (c *SocketClient) GetCredentials() *SocketCredentials {
+	return c.credentials
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.ListenUnix(string) errors.Error
+ *
+ * Listens on unix socket under given path. Paths starting with @ live in the abstract namespace and have no file.
+ */
+func (sock *Socket) ListenUnix(path string) errors.Error {
+	sock.Type = SOCKET_TYPE_UNIX
+
+	return sock.Listen(path, "")
+}
+
+/**
+ * Socket.ConnectUnix(string) errors.Error
+ */
+func (sock *Socket) ConnectUnix(path string) errors.Error {
+	sock.Type = SOCKET_TYPE_UNIX
+
+	return sock.Connect(path, "")
+}
+
+/**
+ * Socket.address() string
+ */
+func (sock *Socket) address() string {
+	if sock.Type == SOCKET_TYPE_UNIX {
+		return sock.Host
+	}
+
+	return sock.Host + ":" + sock.Port
+}
+
+/**
+ * Socket.listen() (net.Listener, errors.Error)
+ */
+func (sock *Socket) listen() (net.Listener, errors.Error) {
+	path := sock.address()
+	isFile := sock.Type == SOCKET_TYPE_UNIX && !strings.HasPrefix(path, "@")
+
+	// socket file left behind by a crashed process blocks the path, but only if nobody listens on it anymore
+	if isFile {
+		if _, err := os.Stat(path); err == nil {
+			if conn, err := net.Dial(sock.Type, path); err == nil {
+				conn.Close()
+				return nil, errors.New(SOCKET_ERR_NOT_STARTED, "Socket " + path + " is already in use.")
+			}
+			os.Remove(path)
+		}
+
+		return listenUnixFile(path, sock.Config.UnixMode)
+	}
+
+	listener, err := net.Listen(sock.Type, path)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+	}
+
+	return listener, nil
+}
+
+/**
+ * listenUnixFile(string, os.FileMode) (net.Listener, errors.Error)
+ *
+ * Socket file is created with given mode already, so there is no moment in which other users could connect to it.
+ */
+func listenUnixFile(path string, mode os.FileMode) (net.Listener, errors.Error) {
+	listener, err := listenWithUmask(path, mode)
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+	}
+
+	// platforms without umask get the mode only here
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+	}
+
+	return listener, nil
+}
+
+/**
+ * Socket.checkCredentials(*SocketClient) errors.Error
+ *
+ * Reads peer credentials of unix connection and lets through only allowed users. Without explicit list, only the
+ * user running the socket and root are allowed.
+ */
+func (sock *Socket) checkCredentials(c *SocketClient) errors.Error {
+	if sock.Type != SOCKET_TYPE_UNIX {
+		return nil
+	}
+
+	conn := c.conn
+	if secure, ok := conn.(*tls.Conn); ok {
+		conn = secure.NetConn()
+	}
+
+	credentials, err := peerCredentials(conn)
+	if err == nil {
+		c.credentials = credentials
+	}
+
+	if !sock.Config.UnixPeerCheck {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	allowed := sock.Config.UnixAllowedUids
+	if allowed == nil {
+		allowed = []int{os.Getuid(), 0}
+	}
+
+	for _, uid := range allowed {
+		if uid == credentials.Uid {
+			return nil
+		}
+	}
+
+	return errors.New(SOCKET_ERR_FORBIDDEN, "User " + strconv.Itoa(credentials.Uid) + " is not allowed to connect.")
+}
@@ -0,0 +1,56 @@
+package tcp
+
+import (
+	"os"
+	"net"
+	"sync"
+	"syscall"
+	"../errors"
+)
+
+var umaskLock sync.Mutex
+
+/**
+ * listenWithUmask(string, os.FileMode) (net.Listener, error)
+ *
+ * Umask is shared by the whole process, so it is restricted only for the moment socket file is being created.
+ */
+func listenWithUmask(path string, mode os.FileMode) (net.Listener, error) {
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
+
+	mask := syscall.Umask(int(0777 &^ mode.Perm()))
+	defer syscall.Umask(mask)
+
+	return net.Listen(SOCKET_TYPE_UNIX, path)
+}
+
+/**
+ * peerCredentials(net.Conn) (*SocketCredentials, errors.Error)
+ */
+func peerCredentials(conn net.Conn) (*SocketCredentials, errors.Error) {
+	unix, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New(SOCKET_ERR_FORBIDDEN, "Peer credentials are available only for unix connections.")
+	}
+
+	raw, err := unix.SyscallConn()
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_FORBIDDEN, err.Error())
+	}
+
+	var ucred *syscall.Ucred
+	var uerr error
+
+	err = raw.Control(func(fd uintptr) {
+		ucred, uerr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return nil, errors.New(SOCKET_ERR_FORBIDDEN, err.Error())
+	}
+
+	return &SocketCredentials{int(ucred.Pid), int(ucred.Uid), int(ucred.Gid)}, nil
+}
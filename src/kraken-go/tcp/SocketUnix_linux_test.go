@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"os"
+	"time"
+	"syscall"
+	"testing"
+	"path/filepath"
+)
+
+func TestUnixSocketIsCreatedWithMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kraken.sock")
+
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+
+	srv := CreateSocket()
+	srv.Config.UnixMode = 0600
+	if err := srv.ListenUnix(path); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("socket has mode %s", info.Mode().Perm())
+	}
+
+	restored := syscall.Umask(0)
+	syscall.Umask(restored)
+	if restored != mask {
+		t.Errorf("umask has been left at %o, want %o", restored, mask)
+	}
+}
+
+func TestUnixCredentialsOverTLS(t *testing.T) {
+	pki := createTestPKI(t)
+	path := filepath.Join(t.TempDir(), "kraken.sock")
+
+	pids := make(chan int, 1)
+
+	srv := CreateSocket()
+	srv.Config.TLS = &SocketTLSConfig{CertPEM: pki.srvCert, KeyPEM: pki.srvKey, CAPEM: pki.caCert}
+	srv.OnMessage(func(c *SocketClient, m *SocketMessage) {
+		if credentials := c.GetCredentials(); credentials != nil {
+			pids <- credentials.Pid
+		} else {
+			pids <- 0
+		}
+	})
+	if err := srv.ListenUnix(path); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+	defer srv.Close()
+
+	cl := CreateSocket()
+	cl.Config.TLS = &SocketTLSConfig{CAPEM: pki.caCert, ServerName: "localhost"}
+	if err := cl.ConnectUnix(path); err != nil {
+		t.Fatalf("connect: %s", err.GetMessage())
+	}
+	defer cl.Close()
+
+	cl.WriteMessage(cl.Conn.Client, createTextMessage("hi"))
+
+	select {
+		case pid := <-pids:
+			if pid != os.Getpid() {
+				t.Errorf("unexpected peer pid %d", pid)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("message has not arrived")
+	}
+}
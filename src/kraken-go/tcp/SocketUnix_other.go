@@ -0,0 +1,27 @@
+// +build !linux
+
+package tcp
+
+import (
+	"os"
+	"net"
+	"../errors"
+)
+
+/**
+ * listenWithUmask(string, os.FileMode) (net.Listener, error)
+ *
+ * Umask is not available on every platform, socket file gets its mode only once it exists.
+ */
+func listenWithUmask(path string, mode os.FileMode) (net.Listener, error) {
+	return net.Listen(SOCKET_TYPE_UNIX, path)
+}
+
+/**
+ * peerCredentials(net.Conn) (*SocketCredentials, errors.Error)
+ *
+ * SO_PEERCRED is Linux specific, other platforms cannot verify peers of unix connections.
+ */
+func peerCredentials(conn net.Conn) (*SocketCredentials, errors.Error) {
+	return nil, errors.New(SOCKET_ERR_FORBIDDEN, "Peer credentials are not supported on this platform.")
+}
@@ -0,0 +1,217 @@
+package tcp
+
+import (
+	"time"
+	"sync/atomic"
+	"../errors"
+)
+
+const (
+	SEND_POLICY_BLOCK			 string = "block"
+	SEND_POLICY_DROP_OLDEST		 string = "drop-oldest"
+	SEND_POLICY_DISCONNECT		 string = "disconnect"
+)
+
+const (
+	WRITER_IDLE					 int32 = 0
+	WRITER_RUNNING				 int32 = 1
+	WRITER_STOPPED				 int32 = 2
+)
+
+const (
+	WRITER_DRAIN_TIMEOUT		 time.Duration = 5 * time.Second
+)
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketQueueStats class
+ */
+type SocketQueueStats struct {
+	Depth		int
+	Capacity	int
+	Peak		int
+	Sent		uint64
+	Dropped		uint64
+}
+
+/**
+ * SocketClient.GetQueueStats() *SocketQueueStats
+ */
+func (c *SocketClient) GetQueueStats() *SocketQueueStats {
+	stats := &SocketQueueStats{}
+
+	stats.Depth    = len(c.sendQueue)
+	stats.Capacity = cap(c.sendQueue)
+	stats.Peak     = int(atomic.LoadInt64(&c.peak))
+	stats.Sent     = atomic.LoadUint64(&c.sent)
+	stats.Dropped  = atomic.LoadUint64(&c.dropped)
+
+	return stats
+}
+
+/**
+ * SocketClient.GetQueueDepth() int
+ */
+func (c *SocketClient) GetQueueDepth() int {
+	return len(c.sendQueue)
+}
+
+/**
+ * Socket.GetQueueStats() *SocketQueueStats
+ *
+ * Sums up send queues of all connected clients, Peak holds the deepest queue seen on any of them.
+ */
+func (sock *Socket) GetQueueStats() *SocketQueueStats {
+	stats := &SocketQueueStats{}
+
+	for _, c := range sock.tracked() {
+		client := c.GetQueueStats()
+
+		stats.Depth    += client.Depth
+		stats.Capacity += client.Capacity
+		stats.Sent     += client.Sent
+		stats.Dropped  += client.Dropped
+
+		if client.Peak > stats.Peak {
+			stats.Peak = client.Peak
+		}
+	}
+
+	return stats
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * Socket.startWriter(*SocketClient)
+ *
+ * Starts goroutine which writes messages from send queue of client. From now on WriteMessage only queues messages.
+ */
+func (sock *Socket) startWriter(c *SocketClient) {
+	c.writerLock.Lock()
+	defer c.writerLock.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&c.writerState, WRITER_IDLE, WRITER_RUNNING) {
+		return
+	}
+
+	done := make(chan struct{})
+	c.writerDone = done
+
+	sock.spawn(func() {
+		defer close(done)
+
+		for {
+			select {
+				case m := <-c.sendQueue:
+					c.write(m)
+				case <-c.stopped:
+					for {
+						select {
+							case m := <-c.sendQueue:
+								c.write(m)
+							default:
+								return
+						}
+					}
+			}
+		}
+	})
+}
+
+/**
+ * SocketClient.stopWriter()
+ *
+ * Stops writer goroutine once it has written everything queued so far. Peer which stopped reading would block the
+ * writer forever, so connection is closed when queue is not drained within WRITER_DRAIN_TIMEOUT.
+ */
+func (c *SocketClient) stopWriter() {
+	c.writerLock.Lock()
+	if atomic.CompareAndSwapInt32(&c.writerState, WRITER_RUNNING, WRITER_STOPPED) {
+		close(c.stopped)
+	} else {
+		atomic.CompareAndSwapInt32(&c.writerState, WRITER_IDLE, WRITER_STOPPED)
+	}
+	done := c.writerDone
+	c.writerLock.Unlock()
+
+	if done == nil {
+		return
+	}
+
+	select {
+		case <-done:
+		case <-time.After(WRITER_DRAIN_TIMEOUT):
+			c.closeWithReason(CLOSE_REASON_WRITE_ERROR)
+			<-done
+	}
+}
+
+/**
+ * SocketClient.write(*SocketMessage)
+ */
+func (c *SocketClient) write(m *SocketMessage) {
+	if err := c.deliver(m); err != nil {
+		c.closeWithReason(CLOSE_REASON_WRITE_ERROR)
+		return
+	}
+
+	atomic.AddUint64(&c.sent, 1)
+}
+
+/**
+ * SocketClient.push(*SocketMessage) errors.Error
+ *
+ * Puts message to send queue, handling full queue according to send policy of socket.
+ */
+func (c *SocketClient) push(m *SocketMessage) errors.Error {
+	switch c.sock.Config.SendPolicy {
+		case SEND_POLICY_DROP_OLDEST:
+			for {
+				select {
+					case c.sendQueue <- m:
+						c.updatePeak()
+						return nil
+					default:
+				}
+
+				select {
+					case <-c.sendQueue:
+						atomic.AddUint64(&c.dropped, 1)
+					default:
+				}
+			}
+
+		case SEND_POLICY_DISCONNECT:
+			select {
+				case c.sendQueue <- m:
+					c.updatePeak()
+					return nil
+				default:
+					atomic.AddUint64(&c.dropped, 1)
+					c.closeWithReason(CLOSE_REASON_SLOW_CONSUMER)
+					return errors.New(SOCKET_ERR_QUEUE_FULL, "Send queue is full, client has been disconnected.")
+			}
+	}
+
+	select {
+		case c.sendQueue <- m:
+			c.updatePeak()
+			return nil
+		case <-c.stopped:
+			return errors.New(SOCKET_CLOSED_CIN, "Connection has been closed.")
+	}
+}
+
+/**
+ * SocketClient.updatePeak()
+ */
+func (c *SocketClient) updatePeak() {
+	depth := int64(len(c.sendQueue))
+
+	for {
+		peak := atomic.LoadInt64(&c.peak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&c.peak, peak, depth) {
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package tcp
+
+import (
+	"net"
+	"time"
+	"strings"
+	"context"
+	"testing"
+	"../storage"
+)
+
+// listenStuck returns server client of a peer which completes handshake and then never reads
+func listenStuck(t *testing.T, port string, policy string, timeout time.Duration, stopped chan string) (*Socket, *SocketClient, net.Conn) {
+	srv := CreateSocket()
+	srv.Config.SendQueueSize = 4
+	srv.Config.SendPolicy = policy
+	srv.Config.WriteTimeout = timeout
+	srv.OnClientStop(func(c *SocketClient) {
+		stopped <- c.GetCloseReason()
+	})
+	if err := srv.Listen("127.0.0.1", port); err != nil {
+		t.Fatalf("listen: %s", err.GetMessage())
+	}
+
+	raw, err := net.Dial("tcp", "127.0.0.1:" + port)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	raw.Write([]byte("[HELLO]VERSION=1,CODECS=text\n"))
+
+	for i := 0; i < 100 && srv.Conn.Clients.Count() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.Conn.Clients.Count() == 0 {
+		t.Fatalf("peer has not connected")
+	}
+
+	return srv, srv.Conn.Clients.GetAll()[0], raw
+}
+
+// flood writes large messages until socket buffers and send queue are full, returns number of failed writes
+func flood(srv *Socket, c *SocketClient, count int) int {
+	record := storage.CreateDataRecord()
+	record.Set("P", strings.Repeat("x", 64 * 1024))
+
+	failed := 0
+	for i := 0; i < count; i++ {
+		if err := srv.WriteMessage(c, CreateSocketMessage("MSG", record)); err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+func TestSendPolicyDropOldest(t *testing.T) {
+	stopped := make(chan string, 1)
+	srv, c, raw := listenStuck(t, "19261", SEND_POLICY_DROP_OLDEST, time.Second, stopped)
+	defer srv.Close()
+	defer raw.Close()
+
+	start := time.Now()
+	if failed := flood(srv, c, 200); failed != 0 {
+		t.Errorf("%d writes failed", failed)
+	}
+	if elapsed := time.Since(start); elapsed > 500 * time.Millisecond {
+		t.Errorf("writes have been blocked for %s", elapsed)
+	}
+
+	stats := c.GetQueueStats()
+	if stats.Dropped == 0 || stats.Depth > stats.Capacity {
+		t.Errorf("unexpected queue stats %+v", stats)
+	}
+}
+
+func TestSendPolicyDisconnect(t *testing.T) {
+	stopped := make(chan string, 1)
+	srv, c, raw := listenStuck(t, "19262", SEND_POLICY_DISCONNECT, time.Second, stopped)
+	defer srv.Close()
+	defer raw.Close()
+
+	if failed := flood(srv, c, 200); failed == 0 {
+		t.Errorf("writes to slow consumer have not failed")
+	}
+
+	expectCloseReason(t, stopped, CLOSE_REASON_SLOW_CONSUMER, 3 * time.Second)
+}
+
+func TestSendPolicyBlock(t *testing.T) {
+	stopped := make(chan string, 1)
+	srv, c, raw := listenStuck(t, "19263", SEND_POLICY_BLOCK, time.Second, stopped)
+	defer srv.Close()
+	defer raw.Close()
+
+	// writer gives up after WriteTimeout, which releases blocked senders
+	start := time.Now()
+	flood(srv, c, 200)
+	if elapsed := time.Since(start); elapsed < 500 * time.Millisecond {
+		t.Errorf("writes have not been blocked, took %s", elapsed)
+	}
+
+	if stats := c.GetQueueStats(); stats.Dropped != 0 {
+		t.Errorf("blocking policy dropped %d messages", stats.Dropped)
+	}
+
+	expectCloseReason(t, stopped, CLOSE_REASON_WRITE_ERROR, 3 * time.Second)
+}
+
+func TestStopWriterIsBoundedForStuckPeer(t *testing.T) {
+	stopped := make(chan string, 1)
+	// without write timeout only draining bound keeps writer from waiting for the peer forever
+	srv, c, raw := listenStuck(t, "19264", SEND_POLICY_BLOCK, 0, stopped)
+	defer raw.Close()
+
+	go flood(srv, c, 100)
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * WRITER_DRAIN_TIMEOUT)
+	defer cancel()
+
+	start := time.Now()
+	srv.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 2 * WRITER_DRAIN_TIMEOUT {
+		t.Errorf("shutdown waited for stuck peer for %s", elapsed)
+	}
+
+	expectCloseReason(t, stopped, CLOSE_REASON_WRITE_ERROR, time.Second)
+}
@@ -0,0 +1,271 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"../storage"
+	"../errors"
+)
+
+/**
+ * msgpackWriter class
+ */
+type msgpackWriter struct {
+	buf		bytes.Buffer
+}
+
+/**
+ * msgpackWriter.WriteMapHeader(int)
+ */
+func (w *msgpackWriter) WriteMapHeader(n int) {
+	switch {
+		case n < 16:
+			w.buf.WriteByte(0x80 | byte(n))
+		case n < 1 << 16:
+			w.buf.WriteByte(0xde)
+			w.writeUint16(uint16(n))
+		default:
+			w.buf.WriteByte(0xdf)
+			w.writeUint32(uint32(n))
+	}
+}
+
+/**
+ * msgpackWriter.WriteString(string)
+ */
+func (w *msgpackWriter) WriteString(s string) {
+	n := len(s)
+
+	switch {
+		case n < 32:
+			w.buf.WriteByte(0xa0 | byte(n))
+		case n < 1 << 8:
+			w.buf.WriteByte(0xd9)
+			w.buf.WriteByte(byte(n))
+		case n < 1 << 16:
+			w.buf.WriteByte(0xda)
+			w.writeUint16(uint16(n))
+		default:
+			w.buf.WriteByte(0xdb)
+			w.writeUint32(uint32(n))
+	}
+
+	w.buf.WriteString(s)
+}
+
+/**
+ * msgpackWriter.Bytes() []byte
+ */
+func (w *msgpackWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *msgpackWriter) writeUint16(n uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], n)
+	w.buf.Write(b[:])
+}
+
+func (w *msgpackWriter) writeUint32(n uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	w.buf.Write(b[:])
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * msgpackReader class
+ */
+type msgpackReader struct {
+	data	[]byte
+	pos		int
+}
+
+/**
+ * msgpackReader.ReadMapHeader() (int, errors.Error)
+ */
+func (r *msgpackReader) ReadMapHeader() (int, errors.Error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+		case b & 0xf0 == 0x80:
+			return int(b & 0x0f), nil
+		case b == 0xde:
+			return r.readLength(2)
+		case b == 0xdf:
+			return r.readLength(4)
+	}
+
+	return 0, r.malformed()
+}
+
+/**
+ * msgpackReader.ReadString() (string, errors.Error)
+ */
+func (r *msgpackReader) ReadString() (string, errors.Error) {
+	b, err := r.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	n := 0
+	switch {
+		case b & 0xe0 == 0xa0:
+			n = int(b & 0x1f)
+		case b == 0xd9 || b == 0xc4:
+			n, err = r.readLength(1)
+		case b == 0xda || b == 0xc5:
+			n, err = r.readLength(2)
+		case b == 0xdb || b == 0xc6:
+			n, err = r.readLength(4)
+		case b == 0xc0:
+			return "", nil
+		default:
+			return "", r.malformed()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := r.readBytes(n)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+/**
+ * msgpackReader.ReadStringMap() (*storage.DataRecord, errors.Error)
+ */
+func (r *msgpackReader) ReadStringMap() (*storage.DataRecord, errors.Error) {
+	record := storage.CreateDataRecord()
+
+	n, err := r.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		val, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		record.Set(key, val)
+	}
+
+	return record, nil
+}
+
+/**
+ * msgpackReader.Skip() errors.Error
+ */
+func (r *msgpackReader) Skip() errors.Error {
+	b, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	size  := 0
+	items := 0
+
+	switch {
+		case b <= 0x7f || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+		case b & 0xf0 == 0x80:
+			items = 2 * int(b & 0x0f)
+		case b & 0xf0 == 0x90:
+			items = int(b & 0x0f)
+		case b & 0xe0 == 0xa0:
+			size = int(b & 0x1f)
+		case b == 0xcc || b == 0xd0:
+			size = 1
+		case b == 0xcd || b == 0xd1:
+			size = 2
+		case b == 0xce || b == 0xd2 || b == 0xca:
+			size = 4
+		case b == 0xcf || b == 0xd3 || b == 0xcb:
+			size = 8
+		case b == 0xd9 || b == 0xc4:
+			size, err = r.readLength(1)
+		case b == 0xda || b == 0xc5:
+			size, err = r.readLength(2)
+		case b == 0xdb || b == 0xc6:
+			size, err = r.readLength(4)
+		case b == 0xdc:
+			items, err = r.readLength(2)
+		case b == 0xdd:
+			items, err = r.readLength(4)
+		case b == 0xde:
+			items, err = r.readLength(2)
+			items = 2 * items
+		case b == 0xdf:
+			items, err = r.readLength(4)
+			items = 2 * items
+		default:
+			return r.malformed()
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.readBytes(size); err != nil {
+		return err
+	}
+
+	for i := 0; i < items; i++ {
+		if err = r.Skip(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *msgpackReader) readByte() (byte, errors.Error) {
+	if r.pos >= len(r.data) {
+		return 0, r.malformed()
+	}
+
+	b := r.data[r.pos]
+	r.pos++
+
+	return b, nil
+}
+
+func (r *msgpackReader) readBytes(n int) ([]byte, errors.Error) {
+	if n < 0 || r.pos + n > len(r.data) {
+		return nil, r.malformed()
+	}
+
+	data := r.data[r.pos:r.pos + n]
+	r.pos += n
+
+	return data, nil
+}
+
+func (r *msgpackReader) readLength(n int) (int, errors.Error) {
+	data, err := r.readBytes(n)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+		case 1:
+			return int(data[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(data)), nil
+		default:
+			return int(binary.BigEndian.Uint32(data)), nil
+	}
+}
+
+func (r *msgpackReader) malformed() errors.Error {
+	return errors.New(SOCKET_ERR_MALFORMED_MESSAGE, "Malformed msgpack message.")
+}
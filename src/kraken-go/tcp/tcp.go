@@ -1,9 +1,19 @@
 package tcp
 
 import (
+	"io"
+	"os"
 	"net"
+	"sync"
+	"time"
 	"bufio"
 	"strings"
+	"context"
+	"strconv"
+	"sync/atomic"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
 	"../storage"
 	"../errors"
 )
@@ -15,11 +25,43 @@ const (
 	SOCKET_ERR_NOT_STARTED		 int = 4
 	SOCKET_ERR_NOT_CONNECTED	 int = 5
 	SOCKET_ERR_ALREADY_CONNECTED int = 6
+	SOCKET_ERR_MALFORMED_MESSAGE int = 7
+	SOCKET_ERR_HANDSHAKE		 int = 8
+	SOCKET_ERR_INCOMPATIBLE		 int = 9
+	SOCKET_ERR_REJECTED			 int = 10
+	SOCKET_ERR_UNKNOWN_METHOD	 int = 11
+	SOCKET_ERR_TIMEOUT			 int = 12
+	SOCKET_ERR_UNKNOWN_COMMAND	 int = 13
+	SOCKET_ERR_HANDLER_PANIC	 int = 14
+	SOCKET_ERR_FORBIDDEN		 int = 15
+	SOCKET_ERR_UNKNOWN_CLIENT	 int = 16
+	SOCKET_ERR_QUEUE_FULL		 int = 17
+	SOCKET_ERR_TLS				 int = 18
+	SOCKET_ERR_UNAUTHORIZED		 int = 19
+	SOCKET_ERR_INVALID_TOPIC	 int = 20
+	SOCKET_ERR_TOO_MANY_CONNECTIONS int = 21
+	SOCKET_ERR_MESSAGE_TOO_LARGE int = 22
+	SOCKET_ERR_RATE_LIMITED		 int = 23
+	SOCKET_ERR_COMPRESSION		 int = 24
 )
 
 const (
 	SOCKET_MESSAGE			 	 string = "MSG"
 	SOCKET_COMMAND			 	 string = "CMD"
+	SOCKET_HELLO			 	 string = "HELLO"
+	SOCKET_WELCOME			 	 string = "WELCOME"
+	SOCKET_REJECT			 	 string = "REJECT"
+	SOCKET_RESPONSE			 	 string = "RES"
+	SOCKET_ERROR			 	 string = "ERR"
+	SOCKET_PING			 	 	 string = "HBPING"
+	SOCKET_PONG			 	 	 string = "HBPONG"
+	SOCKET_AUTH			 	 	 string = "AUTH"
+	SOCKET_AUTH_OK			 	 string = "AUTHOK"
+	SOCKET_GOODBYE			 	 string = "BYE"
+	SOCKET_SUBSCRIBE		 	 string = "SUB"
+	SOCKET_UNSUBSCRIBE		 	 string = "UNSUB"
+	SOCKET_PUBLISH			 	 string = "PUB"
+	SOCKET_EVENT			 	 string = "EVT"
 )
 
 const (
@@ -28,6 +70,21 @@ const (
 
 const (
 	MESSAGE_TEXT				 string = "TXT"
+	MESSAGE_VERSION				 string = "VERSION"
+	MESSAGE_NODE				 string = "NODE"
+	MESSAGE_CODEC				 string = "CODEC"
+	MESSAGE_CODECS				 string = "CODECS"
+	MESSAGE_FEATURES			 string = "FEATURES"
+	MESSAGE_CODE				 string = "CODE"
+	MESSAGE_REASON				 string = "REASON"
+	MESSAGE_AUTH				 string = "AUTH"
+	MESSAGE_CHALLENGE			 string = "CHALLENGE"
+	MESSAGE_METHOD				 string = "METHOD"
+	MESSAGE_DIGEST				 string = "DIGEST"
+	MESSAGE_TOKEN				 string = "TOKEN"
+	MESSAGE_TOPIC				 string = "TOPIC"
+	MESSAGE_PATTERN				 string = "PATTERN"
+	MESSAGE_COMPRESSION			 string = "COMPRESSION"
 )
 
 //--------------------------------------------------------------------------------------------------------------------//
@@ -37,13 +94,21 @@ const (
 type SocketMessage struct {
 	Cmd		string
 	Val		*storage.DataRecord
+	Id		string
 }
 
 /**
  * SocketMessage constructor
  */
 func CreateSocketMessage(cmd string, val *storage.DataRecord) *SocketMessage {
-	return &SocketMessage{cmd, val}
+	return &SocketMessage{cmd, val, ""}
+}
+
+/**
+ * SocketMessage.GetId() string
+ */
+func (message *SocketMessage) GetId() string {
+	return message.Id
 }
 
 /**
@@ -89,6 +154,9 @@ type SocketEvents struct {
 	Message     		func(c *SocketClient, s *SocketMessage)
 	ClientStart			func(c *SocketClient)
 	ClientStop			func(c *SocketClient)
+	Disconnect			func(c *SocketClient)
+	Reconnect			func(c *SocketClient, attempt int)
+	Violation			func(c *SocketClient, err errors.Error)
 }
 
 /**
@@ -102,16 +170,103 @@ func CreateSocketEvents() *SocketEvents {
 	events.Message  	= func(c *SocketClient, s *SocketMessage) {}
 	events.ClientStart	= func(c *SocketClient) {}
 	events.ClientStop	= func(c *SocketClient) {}
+	events.Disconnect	= func(c *SocketClient) {}
+	events.Reconnect	= func(c *SocketClient, attempt int) {}
+	events.Violation	= func(c *SocketClient, err errors.Error) {}
 
 	return events
 }
 
+//--------------------------------------------------------------------------------------------------------------------//
+/**
+ * SocketConfig class
+ */
+type SocketConfig struct {
+	Node				string
+	Codecs				[]string
+	Features			[]string
+	AllowLegacy			bool
+	HandshakeTimeout	time.Duration
+	LegacyTimeout		time.Duration
+	CallTimeout			time.Duration
+	Reconnect			bool
+	ReconnectDelay		time.Duration
+	ReconnectMaxDelay	time.Duration
+	ReconnectJitter		float64
+	ReconnectMaxAttempts int
+	ReconnectQueueSize	int
+	HeartbeatInterval	time.Duration
+	HeartbeatMisses		int
+	ReadTimeout			time.Duration
+	WriteTimeout		time.Duration
+	IdleTimeout			time.Duration
+	TLS					*SocketTLSConfig
+	UnixMode			os.FileMode
+	UnixPeerCheck		bool
+	UnixAllowedUids		[]int
+	Auth				*SocketAuthConfig
+	SendQueueSize		int
+	SendPolicy			string
+	MaxConnections		int
+	MaxConnectionsPerIP	int
+	MaxMessageSize		int
+	RateLimit			float64
+	RateBurst			int
+	Compression			[]string
+	CompressionThreshold int
+	CompressionLevel	int
+}
+
+/**
+ * SocketConfig constructor
+ */
+func CreateSocketConfig() *SocketConfig {
+	config := &SocketConfig{}
+
+	config.Node, _			= os.Hostname()
+	config.Codecs			= []string{CODEC_JSON, CODEC_MSGPACK, CODEC_TEXT2, CODEC_TEXT}
+	config.Features			= []string{FEATURE_HEARTBEAT}
+	config.AllowLegacy		= true
+	config.HandshakeTimeout	= 5 * time.Second
+	config.LegacyTimeout	= 1 * time.Second
+	config.CallTimeout		= 30 * time.Second
+	config.Reconnect		= false
+	config.ReconnectDelay	= 500 * time.Millisecond
+	config.ReconnectMaxDelay = 30 * time.Second
+	config.ReconnectJitter	= 0.2
+	config.ReconnectMaxAttempts = 0
+	config.ReconnectQueueSize = 1000
+	config.HeartbeatInterval = 15 * time.Second
+	config.HeartbeatMisses	= 3
+	config.ReadTimeout		= 0
+	config.WriteTimeout		= 0
+	config.IdleTimeout		= 0
+	config.TLS				= nil
+	config.UnixMode			= 0600
+	config.UnixPeerCheck	= true
+	config.UnixAllowedUids	= nil
+	config.Auth				= nil
+	config.SendQueueSize	= 256
+	config.SendPolicy		= SEND_POLICY_BLOCK
+	config.MaxConnections	= 0
+	config.MaxConnectionsPerIP = 0
+	config.MaxMessageSize	= 16 << 20
+	config.RateLimit		= 0
+	config.RateBurst		= 0
+	config.Compression		= []string{}
+	config.CompressionThreshold = 1024
+	config.CompressionLevel	= flate.DefaultCompression
+
+	return config
+}
+
 //--------------------------------------------------------------------------------------------------------------------//
 /**
  * SocketClientFlags class
  */
 type SocketClientFlags struct {
 	IsListening		bool
+	IsReconnecting	bool
 }
 
 /**
@@ -121,6 +276,7 @@ func CreateSocketClientFlags() *SocketClientFlags {
 	flags := &SocketClientFlags{}
 
 	flags.IsListening = true
+	flags.IsReconnecting = false
 
 	return flags
 }
@@ -130,11 +286,40 @@ func CreateSocketClientFlags() *SocketClientFlags {
  * SocketClient
  */
 type SocketClient struct {
+	lastSeen	int64
+	lastActive	int64
+	sent		uint64
+	dropped		uint64
+	peak		int64
+	writerState	int32
 	sock		*Socket
 	conn		net.Conn
 	cin			*bufio.Writer
 	cout		*bufio.Reader
 	flags		*SocketClientFlags
+	codec		SocketCodec
+	handshake	*SocketHandshake
+	id			string
+	remoteAddr	string
+	connectedAt	time.Time
+	meta		*storage.DataRecord
+	metaLock	sync.RWMutex
+	lock		sync.Mutex
+	connLock	sync.Mutex
+	writerLock	sync.Mutex
+	queue		[]*SocketMessage
+	closeReason	string
+	identity	*SocketIdentity
+	credentials	*SocketCredentials
+	principal	string
+	permissions	[]string
+	sendQueue	chan *SocketMessage
+	stopped		chan struct{}
+	writerDone	chan struct{}
+	limiter		*SocketRateLimiter
+	compressor	SocketCompressor
+	compressionCounters *SocketCompressionCounters
+	pending		*SocketMessage
 }
 
 /**
@@ -148,17 +333,106 @@ func CreateSocketClient(sock *Socket, conn net.Conn) *SocketClient {
 	client.cin	  = bufio.NewWriter(conn)
 	client.cout	  = bufio.NewReader(conn)
 	client.flags  = CreateSocketClientFlags()
+	client.codec  = GetCodec(CODEC_TEXT)
+	client.handshake = nil
+	client.id     = ""
+	client.remoteAddr  = ""
+	client.connectedAt = time.Now()
+	client.meta   = storage.CreateDataRecord()
+	client.closeReason = ""
+	client.identity    = nil
+	client.credentials = nil
+	client.principal   = ""
+	client.permissions = nil
+	client.sendQueue   = make(chan *SocketMessage, sock.Config.SendQueueSize)
+	client.stopped     = make(chan struct{})
+	client.writerDone  = nil
+	client.limiter     = nil
+	client.compressor  = nil
+	client.compressionCounters = &SocketCompressionCounters{}
+	client.pending     = nil
+
+	if conn != nil {
+		client.remoteAddr = conn.RemoteAddr().String()
+	}
 
 	return client
 }
 
+/**
+ * SocketClient.GetId() string
+ */
+func (c *SocketClient) GetId() string {
+	return c.id
+}
+
+/**
+ * SocketClient.GetConnectedAt() time.Time
+ */
+func (c *SocketClient) GetConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+/**
+ * SocketClient.GetMeta(string) string
+ */
+func (c *SocketClient) GetMeta(key string) string {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+
+	return c.meta.Get(key)
+}
+
+/**
+ * SocketClient.SetMeta(string, string)
+ */
+func (c *SocketClient) SetMeta(key string, val string) {
+	c.metaLock.Lock()
+	defer c.metaLock.Unlock()
+
+	c.meta.Set(key, val)
+}
+
+/**
+ * SocketClient.GetCodec() SocketCodec
+ */
+func (c *SocketClient) GetCodec() SocketCodec {
+	return c.codec
+}
+
+/**
+ * SocketClient.SetCodec(SocketCodec)
+ */
+func (c *SocketClient) SetCodec(codec SocketCodec) {
+	c.codec = codec
+}
+
+/**
+ * SocketClient.GetHandshake() *SocketHandshake
+ */
+func (c *SocketClient) GetHandshake() *SocketHandshake {
+	return c.handshake
+}
+
+/**
+ * SocketClient.HasFeature(string) bool
+ */
+func (c *SocketClient) HasFeature(feature string) bool {
+	return c.handshake != nil && c.handshake.HasFeature(feature)
+}
+
+/**
+ * SocketClient.GetRemoteAddr() string
+ */
+func (c *SocketClient) GetRemoteAddr() string {
+	return c.remoteAddr
+}
+
 /**
  * SocketClient.Close()
  */
 func (c *SocketClient) Close() {
-	if c.conn != nil {
-		c.conn.Close()
-	}
+	c.closeWithReason(CLOSE_REASON_LOCAL)
 }
 
 /**
@@ -172,26 +446,154 @@ func (c *SocketClient) Reset() {
  * SocketClient.ReadMessage() (*SocketMessage, errors.Error)
  */
 func (c *SocketClient) ReadMessage() (*SocketMessage, errors.Error) {
-	line, err := c.cout.ReadString('\n')
+	frame, err := c.readFrame()
 	if err != nil {
-		return nil, errors.New(SOCKET_CLOSED_COUT, err.Error())
+		return nil, err
 	}
 
-	msg := strings.TrimSpace(line)
-
-	return CreateSocketMessage("",nil).FromString(msg), nil
+	return c.codec.Decode(frame)
 }
 
 /**
  * SocketClient.WriteMessage(*SocketMessage) errors.Error
+ *
+ * Once connection is established, message is put to send queue of client and written by its writer goroutine, so
+ * returned error only tells whether message has been queued. During handshake messages are written directly.
  */
 func (c *SocketClient) WriteMessage(m *SocketMessage) errors.Error {
-	_, err := c.cin.WriteString(m.ToString() + "\n")
+	switch atomic.LoadInt32(&c.writerState) {
+		case WRITER_RUNNING:
+			return c.push(m)
+		case WRITER_STOPPED:
+			return errors.New(SOCKET_CLOSED_CIN, "Connection has been closed.")
+	}
+
+	return c.deliver(m)
+}
+
+/**
+ * SocketClient.deliver(*SocketMessage) errors.Error
+ *
+ * Writes message to connection, or to reconnect queue while connector is reconnecting.
+ */
+func (c *SocketClient) deliver(m *SocketMessage) errors.Error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.flags.IsReconnecting {
+		return c.enqueue(m)
+	}
+
+	err := c.send(m)
+	if err != nil && err.GetCode() == SOCKET_CLOSED_CIN && c.sock.Config.Reconnect && c == c.sock.Conn.Client {
+		c.flags.IsReconnecting = true
+		return c.enqueue(m)
+	}
+
+	return err
+}
+
+/**
+ * SocketClient.send(*SocketMessage) errors.Error
+ *
+ * Must be called with client lock held.
+ */
+func (c *SocketClient) send(m *SocketMessage) errors.Error {
+	frame, err := c.codec.Encode(m)
 	if err != nil {
+		return err
+	}
+
+	return c.writeFrame(c.compressFrame(frame))
+}
+
+/**
+ * SocketClient.readFrame() ([]byte, errors.Error)
+ *
+ * Compressed frames are marked by the highest bit of length prefix for binary codecs and by ~ prefix of base64
+ * encoded line for the others.
+ */
+func (c *SocketClient) readFrame() ([]byte, errors.Error) {
+	limit := c.sock.Config.MaxMessageSize
+
+	if !c.codec.IsBinary() {
+		line, err := c.readLine(limit)
+		if err != nil {
+			return nil, err
+		}
+		c.sock.traffic.received(len(line))
+
+		frame := []byte(strings.TrimSpace(string(line)))
+		if len(frame) == 0 || frame[0] != COMPRESSED_LINE_PREFIX {
+			return c.decompressFrame(frame, false)
+		}
+
+		data, derr := base64.StdEncoding.DecodeString(string(frame[1:]))
+		if derr != nil {
+			return nil, errors.New(SOCKET_ERR_MALFORMED_MESSAGE, derr.Error())
+		}
+
+		return c.decompressFrame(data, true)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.cout, size[:]); err != nil {
+		return nil, readError(err)
+	}
+
+	length := binary.BigEndian.Uint32(size[:])
+	compressed := length & COMPRESSED_FRAME_FLAG != 0
+	length = length &^ COMPRESSED_FRAME_FLAG
+
+	if limit > 0 && uint64(length) > uint64(limit) {
+		return nil, frameTooLarge(limit)
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(c.cout, frame); err != nil {
+		return nil, readError(err)
+	}
+	c.sock.traffic.received(len(size) + len(frame))
+
+	return c.decompressFrame(frame, compressed)
+}
+
+/**
+ * SocketClient.writeFrame([]byte, bool) errors.Error
+ */
+func (c *SocketClient) writeFrame(frame []byte, compressed bool) errors.Error {
+	if c.sock.Config.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.sock.Config.WriteTimeout))
+	}
+
+	if c.codec.IsBinary() {
+		length := uint32(len(frame))
+		if compressed {
+			length = length | COMPRESSED_FRAME_FLAG
+		}
+
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], length)
+		c.cin.Write(size[:])
+		c.cin.Write(frame)
+	} else if compressed {
+		c.cin.WriteByte(COMPRESSED_LINE_PREFIX)
+		c.cin.WriteString(base64.StdEncoding.EncodeToString(frame))
+		c.cin.WriteByte('\n')
+	} else {
+		c.cin.Write(frame)
+		c.cin.WriteByte('\n')
+	}
+
+	if err := c.cin.Flush(); err != nil {
 		return errors.New(SOCKET_CLOSED_CIN, err.Error())
 	}
 
-	c.cin.Flush()
+	if c.codec.IsBinary() {
+		c.sock.traffic.sent(4 + len(frame))
+	} else {
+		c.sock.traffic.sent(c.wireSize(frame, compressed) + 1)
+	}
 
 	return nil
 }
@@ -202,7 +604,7 @@ func (c *SocketClient) WriteMessage(m *SocketMessage) errors.Error {
  */
 type SocketConn struct {
 	Client		*SocketClient
-	Clients		[]*SocketClient
+	Clients		*SocketRegistry
 	Accept		func() (net.Conn, error)
 	Close		func() (error)
 }
@@ -217,10 +619,24 @@ type Socket struct {
 	Host        string
 	Port        string
 	Sync        chan *SocketMessage
-	Cin         chan *SocketMessage
-	Cout        chan *SocketMessage
+	Cin         chan *SocketEnvelope
+	Cout        chan *SocketEnvelope
 	Conn        *SocketConn
 	Events      *SocketEvents
+	Config      *SocketConfig
+	done        chan struct{}
+	lock        sync.Mutex
+	wg          sync.WaitGroup
+	conns       map[*SocketClient]bool
+	perIP       map[string]int
+	rpc         *SocketRpc
+	router      *SocketRouter
+	pubsub      *SocketPubSub
+	traffic     *SocketTrafficCounters
+	streaming   bool
+	halt        chan struct{}
+	pumped      chan struct{}
+	retired     chan struct{}
 }
 
 /**
@@ -230,14 +646,26 @@ func CreateSocket() *Socket {
 	sock := &Socket{}
 
 	sock.IsConnected  = false
-	sock.Type         = "tcp"
+	sock.Type         = SOCKET_TYPE_TCP
 	sock.Host         = ""
 	sock.Port         = ""
 	sock.Sync         = make(chan *SocketMessage)
-	sock.Cin          = make(chan *SocketMessage)
-	sock.Cout         = make(chan *SocketMessage)
+	sock.Cin          = make(chan *SocketEnvelope)
+	sock.Cout         = make(chan *SocketEnvelope)
 	sock.Conn		  = nil
 	sock.Events       = CreateSocketEvents()
+	sock.Config       = CreateSocketConfig()
+	sock.done         = nil
+	sock.conns        = nil
+	sock.perIP        = nil
+	sock.rpc          = CreateSocketRpc(sock)
+	sock.router       = CreateSocketRouter(sock)
+	sock.pubsub       = CreateSocketPubSub(sock)
+	sock.traffic      = &SocketTrafficCounters{}
+	sock.streaming    = false
+	sock.halt         = nil
+	sock.pumped       = nil
+	sock.retired      = make(chan struct{})
 
 	return sock
 }
@@ -256,11 +684,37 @@ func (sock *Socket) OnStop(f func()) {
 	sock.Events.Stop = f
 }
 
+/**
+ * Socket.OnDisconnect(func(*SocketClient))
+ */
+func (sock *Socket) OnDisconnect(f func(c *SocketClient)) {
+	sock.Events.Disconnect = f
+}
+
+/**
+ * Socket.OnReconnect(func(*SocketClient, int))
+ */
+func (sock *Socket) OnReconnect(f func(c *SocketClient, attempt int)) {
+	sock.Events.Reconnect = f
+}
+
+/**
+ * Socket.OnViolation(func(*SocketClient, errors.Error))
+ *
+ * Reports clients refused or throttled because of connection, message size or rate limits.
+ */
+func (sock *Socket) OnViolation(f func(c *SocketClient, err errors.Error)) {
+	sock.Events.Violation = f
+}
+
 /**
  * Socket.OnMessage(func(*SocketClient, *SocketMessage))
+ *
+ * Registers callback for commands without handler, which are rejected with an error otherwise.
  */
 func (sock *Socket) OnMessage(f func(c *SocketClient, s *SocketMessage)) {
 	sock.Events.Message = f
+	sock.router.Forward(true)
 }
 
 /**
@@ -277,27 +731,130 @@ func (sock *Socket) OnClientStop(f func(c *SocketClient)) {
 	sock.Events.ClientStop = f
 }
 
+/**
+ * Socket.Handle(string, SocketHandler)
+ */
+func (sock *Socket) Handle(cmd string, handler SocketHandler) {
+	sock.router.Handle(cmd, handler)
+}
+
+/**
+ * Socket.HandleDefault(SocketHandler)
+ *
+ * Replaces handler for commands without registered handler, which by default rejects them with an error.
+ */
+func (sock *Socket) HandleDefault(handler SocketHandler) {
+	sock.router.HandleDefault(handler)
+}
+
+/**
+ * Socket.Use(...SocketMiddleware)
+ */
+func (sock *Socket) Use(middleware ...SocketMiddleware) {
+	sock.router.Use(middleware...)
+}
+
+/**
+ * Socket.RegisterMethod(string, SocketRpcHandler)
+ */
+func (sock *Socket) RegisterMethod(method string, handler SocketRpcHandler) {
+	sock.rpc.Register(method, handler)
+}
+
+/**
+ * Socket.Call(context.Context, string, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (sock *Socket) Call(ctx context.Context, method string, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	if !sock.isOpen() || sock.Conn.Client == nil {
+		return nil, errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot call method on null connection.")
+	}
+
+	return sock.rpc.Call(ctx, sock.Conn.Client, method, record)
+}
+
+/**
+ * Socket.CallClient(context.Context, *SocketClient, string, *storage.DataRecord) (*storage.DataRecord, errors.Error)
+ */
+func (sock *Socket) CallClient(ctx context.Context, c *SocketClient, method string, record *storage.DataRecord) (*storage.DataRecord, errors.Error) {
+	return sock.rpc.Call(ctx, c, method, record)
+}
+
+/**
+ * Socket.Subscribe(string, SocketTopicHandler) errors.Error
+ *
+ * Connecting socket waits for the server to confirm subscription, so it must not be called from within a handler.
+ */
+func (sock *Socket) Subscribe(pattern string, handler SocketTopicHandler) errors.Error {
+	return sock.pubsub.Subscribe(sock.upstream(), pattern, handler)
+}
+
+/**
+ * Socket.Unsubscribe(string) errors.Error
+ */
+func (sock *Socket) Unsubscribe(pattern string) errors.Error {
+	return sock.pubsub.Unsubscribe(sock.upstream(), pattern)
+}
+
+/**
+ * Socket.Publish(string, *storage.DataRecord) errors.Error
+ */
+func (sock *Socket) Publish(topic string, record *storage.DataRecord) errors.Error {
+	return sock.pubsub.Publish(sock.upstream(), topic, record)
+}
+
+/**
+ * Socket.GetSubscriptions(*SocketClient) []string
+ */
+func (sock *Socket) GetSubscriptions(c *SocketClient) []string {
+	return sock.pubsub.GetSubscriptions(c)
+}
+
+/**
+ * Socket.upstream() *SocketClient
+ *
+ * Returns connection to the server of connecting socket, nil for listening or closed socket.
+ */
+func (sock *Socket) upstream() *SocketClient {
+	if !sock.isOpen() {
+		return nil
+	}
+
+	return sock.Conn.Client
+}
+
 /**
  * Socket.Listen(string, string) errors.Error
  */
 func (sock *Socket) Listen(host string, port string) errors.Error {
-	if sock.IsConnected {
+	if sock.isOpen() {
 		return errors.New(SOCKET_ERR_ALREADY_CONNECTED, "Socket connection has been already estabilished.")
 	}
 
 	sock.Host = host
 	sock.Port = port
 
-	conn, err := net.Listen(sock.Type, sock.Host + ":" + sock.Port)
+	listener, err := sock.listen()
 	if err != nil {
-		return errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+		return err
+	}
+
+	conn, cerr := sock.listenTLS(listener)
+	if cerr != nil {
+		listener.Close()
+		return cerr
 	}
 
+	sock.done = make(chan struct{})
+	sock.conns = map[*SocketClient]bool{}
+	sock.perIP = map[string]int{}
 	sock.Conn = &SocketConn{}
 	sock.Conn.Client = nil
+	sock.Conn.Clients = CreateSocketRegistry()
 	sock.Conn.Accept = conn.Accept
 	sock.Conn.Close  = conn.Close
 
+	sock.openChannels()
+
 	sock.IsConnected = true
 	sock.Events.Start()
 
@@ -310,24 +867,35 @@ func (sock *Socket) Listen(host string, port string) errors.Error {
  * Socket.Connect(string, string) errors.Error
  */
 func (sock *Socket) Connect(host string, port string) errors.Error {
-	if sock.IsConnected {
+	if sock.isOpen() {
 		return errors.New(SOCKET_ERR_ALREADY_CONNECTED, "Socket connection has been already estabilished.")
 	}
 
 	sock.Host = host
 	sock.Port = port
 
-	conn, err := net.Dial(sock.Type, sock.Host + ":" + sock.Port)
+	client, err := sock.dial()
 	if err != nil {
-		return errors.New(SOCKET_ERR_NOT_STARTED, err.Error())
+		return err
 	}
 
+	sock.done = make(chan struct{})
+	sock.conns = map[*SocketClient]bool{client: true}
+	sock.perIP = map[string]int{}
 	sock.Conn = &SocketConn{}
-	sock.Conn.Client = CreateSocketClient(sock, conn)
+	sock.Conn.Client = client
+	sock.Conn.Clients = CreateSocketRegistry()
 	sock.Conn.Accept = func() (c net.Conn, err error) {
 		return nil, nil
 	}
-	sock.Conn.Close  = conn.Close
+	sock.Conn.Close  = func() error {
+		client.Close()
+		return nil
+	}
+
+	sock.startWriter(client)
+	sock.pubsub.resubscribe(client)
+	sock.openChannels()
 
 	sock.IsConnected = true
 	sock.Events.Start()
@@ -339,15 +907,17 @@ func (sock *Socket) Connect(host string, port string) errors.Error {
 
 /**
  * Socket.Close() errors.Error
+ *
+ * Shuts socket down without waiting for in-flight handlers. Like Shutdown, it returns once every goroutine of the
+ * socket is gone, so it must not be called from within a handler or event callback.
  */
 func (sock *Socket) Close() errors.Error {
-	if !sock.IsConnected {
-		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot close null connection.")
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
-	sock.Conn.Close()
-	sock.IsConnected = false
-	sock.Events.Stop()
+	if err := sock.Shutdown(ctx); err != nil && err.GetCode() != SOCKET_ERR_TIMEOUT {
+		return err
+	}
 
 	return nil
 }
@@ -356,25 +926,47 @@ func (sock *Socket) Close() errors.Error {
  * Socket.Accept() errors.Error
  */
 func (sock *Socket) Accept() errors.Error {
-	if !sock.IsConnected {
+	if !sock.isOpen() {
 		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot accept connection from closed connection.")
 	}
 
 	// listener
 	if sock.Conn.Client == nil {
-		go func() {
-			for sock.IsConnected {
-				sock.acceptConnection()
+		sock.spawn(func() {
+			for sock.acceptConnection() {
 			}
-		}()
+		})
 
 	// connector
 	} else {
-		go func() {
-			if sock.IsConnected {
-				sock.readConnection(sock.Conn.Client)
+		c := sock.Conn.Client
+		sock.spawn(func() {
+			stopped := false
+
+			for sock.isOpen() {
+				sock.readConnection(c)
+
+				if !sock.isOpen() {
+					break
+				}
+				sock.Events.Disconnect(c)
+
+				if !sock.Config.Reconnect || !sock.reconnect(c) {
+					if sock.markClosed() {
+						sock.untrack(c)
+						sock.Events.Stop()
+						stopped = true
+					}
+					break
+				}
+			}
+
+			c.stopWriter()
+
+			if stopped {
+				sock.closeChannels()
 			}
-		}()
+		})
 	}
 
 	return nil
@@ -384,7 +976,7 @@ func (sock *Socket) Accept() errors.Error {
  * Socket.Lock() errors.Error
  */
 func (sock *Socket) Lock() errors.Error {
-	if !sock.IsConnected {
+	if !sock.isOpen() {
 		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot lock closed connection.")
 	}
 
@@ -398,23 +990,80 @@ func (sock *Socket) Lock() errors.Error {
  * Socket.Unlock() errors.Error
  */
 func (sock *Socket) Unlock() errors.Error {
+	if !sock.isOpen() {
+		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot unlock closed connection.")
+	}
+
 	record := storage.CreateDataRecord()
 	record.Set("Command", COMMAND_EXIT)
-	sock.Sync <- CreateSocketMessage(SOCKET_COMMAND, record)
+
+	select {
+		case sock.Sync <- CreateSocketMessage(SOCKET_COMMAND, record):
+		case <-sock.done:
+	}
 
 	return nil
 }
 
 /**
  * Socket.WriteMessage(*SocketClient, *SocketMessage) errors.Error
+ *
+ * Writing is still possible while socket shuts down, so that running handlers can reply.
  */
 func (sock *Socket) WriteMessage(c *SocketClient, m *SocketMessage) errors.Error {
-	if sock.IsConnected && c != nil {
+	if c != nil && sock.isServing(c) {
 		return c.WriteMessage(m)
 	}
 	return nil
 }
 
+/**
+ * Socket.SendTo(string, *SocketMessage) errors.Error
+ */
+func (sock *Socket) SendTo(id string, m *SocketMessage) errors.Error {
+	if !sock.isOpen() {
+		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot write to closed connection.")
+	}
+
+	c := sock.Conn.Clients.Get(id)
+	if c == nil {
+		return errors.New(SOCKET_ERR_UNKNOWN_CLIENT, "Client " + id + " is not connected.")
+	}
+
+	return sock.WriteMessage(c, m)
+}
+
+/**
+ * Socket.Broadcast(*SocketMessage) errors.Error
+ */
+func (sock *Socket) Broadcast(m *SocketMessage) errors.Error {
+	return sock.BroadcastExcept(nil, m)
+}
+
+/**
+ * Socket.BroadcastExcept(*SocketClient, *SocketMessage) errors.Error
+ *
+ * Writes message to every connected client except the given one. Delivery does not stop on failed client, the first
+ * error met is returned.
+ */
+func (sock *Socket) BroadcastExcept(except *SocketClient, m *SocketMessage) errors.Error {
+	if !sock.isOpen() {
+		return errors.New(SOCKET_ERR_NOT_CONNECTED, "Cannot write to closed connection.")
+	}
+
+	var first errors.Error
+	for _, c := range sock.Conn.Clients.GetAll() {
+		if c == except {
+			continue
+		}
+		if err := sock.WriteMessage(c, m); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
 /**
  * Socket.ReadMessage(*SocketClient) (*SocketMessage, errors.Errror)
  */
@@ -423,31 +1072,67 @@ func (sock *Socket) ReadMessage(c *SocketClient) (*SocketMessage, errors.Error)
 }
 
 /**
- * Socket.acceptConnection()
+ * Socket.acceptConnection() bool
+ *
+ * Accepts single connection and serves it in its own goroutine. Returns false once listener has been closed.
  */
-func (sock *Socket) acceptConnection() {
-	listener, _ := sock.Conn.Accept()
+func (sock *Socket) acceptConnection() bool {
+	listener, err := sock.Conn.Accept()
+	if err != nil {
+		if !sock.isOpen() {
+			return false
+		}
+
+		time.Sleep(ACCEPT_RETRY_DELAY)
+		return true
+	}
 
 	client := CreateSocketClient(sock, listener)
-	sock.Conn.Clients = append(sock.Conn.Clients, client)
+	if err := sock.track(client); err != nil {
+		if err.GetCode() == SOCKET_ERR_NOT_CONNECTED {
+			listener.Close()
+			return false
+		}
+
+		sock.spawn(func() {
+			sock.refuseConnection(client, err)
+		})
+		return true
+	}
+	client.limiter = sock.createRateLimiter()
 	sock.Events.ClientStart(client)
 
-	go func(sock *Socket, client *SocketClient) {
+	sock.spawn(func() {
 		defer sock.closeConnection(client)
 
-		record := storage.CreateDataRecord()
-		record.Set(MESSAGE_TEXT, "Response")
-
-		sock.WriteMessage(client, CreateSocketMessage(SOCKET_MESSAGE, record))
+		if err := sock.checkCredentials(client); err != nil {
+			sock.rejectHandshake(client, err.GetCode(), err.GetMessage())
+			client.closeWithReason(err.GetMessage())
+			return
+		}
+		if err := client.handshakeTLS(sock.Config.HandshakeTimeout); err != nil {
+			return
+		}
+		if err := sock.acceptHandshake(client); err != nil {
+			return
+		}
+		sock.startWriter(client)
+		sock.Conn.Clients.Add(client)
 
 		sock.readConnection(client)
-	}(sock, client)
+	})
+
+	return true
 }
 
 /**
  * Socket.closeConnection(*SocketClient)
  */
 func (sock *Socket) closeConnection(c *SocketClient) {
+	sock.untrack(c)
+	sock.Conn.Clients.Remove(c)
+	sock.pubsub.drop(c)
+	c.stopWriter()
 	sock.Events.ClientStop(c)
 	c.Close()
 }
@@ -456,35 +1141,127 @@ func (sock *Socket) closeConnection(c *SocketClient) {
  * Socket.readConnection(*SocketClient)
  */
 func (sock *Socket) readConnection(c *SocketClient) {
+	c.touch(true)
+
+	stop := make(chan struct{})
+	watching := make(chan struct{})
+	sock.spawn(func() {
+		defer close(watching)
+		sock.watchConnection(c, stop)
+	})
+
+	// first message of legacy peer has been read during handshake, connection is fully set up only now
+	if c.pending != nil {
+		message := c.pending
+		c.pending = nil
+		sock.handleMessage(c, message)
+	}
+
 	stopFlag := false
-	for !stopFlag && sock.IsConnected {
-		message, _ := sock.ReadMessage(c)
+	for !stopFlag && c.prepareRead() {
+		message, err := sock.ReadMessage(c)
 
-		if message == nil {
+		if err != nil && err.GetCode() == SOCKET_ERR_MALFORMED_MESSAGE {
+			continue
+		} else if message == nil {
 			stopFlag = true
+
+			if !sock.isOpen() {
+				c.stopWriter()
+				c.closeWithReason(CLOSE_REASON_SHUTDOWN)
+			} else if err != nil && err.GetCode() == SOCKET_ERR_MESSAGE_TOO_LARGE {
+				sock.Events.Violation(c, err)
+				c.deliver(errorReply(err))
+				c.closeWithReason(CLOSE_REASON_MESSAGE_TOO_LARGE)
+			} else if err != nil && err.GetCode() == SOCKET_ERR_TIMEOUT {
+				c.closeWithReason(CLOSE_REASON_READ_TIMEOUT)
+			} else {
+				c.closeWithReason(CLOSE_REASON_PEER)
+			}
+		} else if sock.handleHeartbeat(c, message) || sock.handleGoodbye(c, message) {
+			c.touch(false)
 		} else {
-			sock.Events.Message(c, message)
+			c.touch(true)
+			sock.handleMessage(c, message)
 		}
 	}
+
+	close(stop)
+	<-watching
+	sock.rpc.release(c)
+}
+
+/**
+ * Socket.handleMessage(*SocketClient, *SocketMessage)
+ */
+func (sock *Socket) handleMessage(c *SocketClient, m *SocketMessage) {
+	if m.GetCmd() == SOCKET_RESPONSE || m.GetCmd() == SOCKET_ERROR {
+		sock.router.Dispatch(c, m)
+		return
+	}
+
+	var err errors.Error
+	if c.limiter != nil && !c.limiter.Allow() {
+		err = errors.New(SOCKET_ERR_RATE_LIMITED, "Rate limit of " + strconv.FormatFloat(c.limiter.GetRate(), 'f', -1, 64) + " messages per second exceeded.")
+		sock.Events.Violation(c, err)
+	} else if !c.IsAllowed(m.GetCmd()) {
+		err = errors.New(SOCKET_ERR_FORBIDDEN, "Command " + m.GetCmd() + " is not allowed for " + c.GetPrincipal() + ".")
+	}
+
+	if err != nil {
+		reply := errorReply(err)
+		reply.Id = m.GetId()
+		sock.WriteMessage(c, reply)
+		return
+	}
+
+	sock.router.Dispatch(c, m)
+}
+
+/**
+ * Socket.forwardMessage(*SocketClient, *SocketMessage) errors.Error
+ */
+func (sock *Socket) forwardMessage(c *SocketClient, m *SocketMessage) errors.Error {
+	if !sock.streamMessage(c, m) {
+		sock.Events.Message(c, m)
+	}
+
+	return nil
+}
+
+/**
+ * readError(error) errors.Error
+ */
+func readError(err error) errors.Error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return errors.New(SOCKET_ERR_TIMEOUT, err.Error())
+	}
+
+	return errors.New(SOCKET_CLOSED_COUT, err.Error())
 }
 
 /**
  * Socket.freeze()
+ *
+ * Blocks until EXIT command is sent by Unlock or socket stops on its own.
  */
 func (sock *Socket) freeze() {
 	stopFlag := false
 
-	for !stopFlag && sock.IsConnected {
-		message := <-sock.Sync
-
-		cmd 	:= message.GetCmd()
-		record  := message.GetRecord()
-
-		if cmd == SOCKET_COMMAND && record.Exists("Command") {
-			switch record.Get("Command")  {
-				case COMMAND_EXIT:
-					stopFlag = true
-			}
+	for !stopFlag {
+		select {
+			case message := <-sock.Sync:
+				cmd 	:= message.GetCmd()
+				record  := message.GetRecord()
+
+				if cmd == SOCKET_COMMAND && record.Exists("Command") {
+					switch record.Get("Command")  {
+						case COMMAND_EXIT:
+							stopFlag = true
+					}
+				}
+			case <-sock.done:
+				stopFlag = true
 		}
 	}
 }